@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -12,6 +13,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/alexflint/go-arg"
 	"github.com/ttl256/gophermart-loyalty/internal/accrual"
 	"github.com/ttl256/gophermart-loyalty/internal/auth"
@@ -58,18 +60,39 @@ func run() error {
 		return fmt.Errorf("migration: %w", err)
 	}
 
-	authSvc := service.NewAuthService(repo)
-	if cfg.Secret == "" {
-		cfg.Secret = rand.Text()
+	authSvc, err := newAuthService(cfg, repo, logger)
+	if err != nil {
+		return fmt.Errorf("initializing auth service: %w", err)
+	}
+	keys, err := buildKeyring(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("building jwt keyring: %w", err)
 	}
-	orderSvc := service.NewOrderService(repo)
+	orderCfg := service.DefaultOrderConfig()
+	orderCfg.AllowWithdrawalOrderCollision = cfg.WithdrawAllowOrderCollision
+	orderCfg.HoldTTL = cfg.HoldTTL
+	orderCfg.MaxHoldTTL = cfg.HoldMaxTTL
+	orderCfg.PointsTTLMonths = cfg.PointsTTLMonths
+	orderCfg.ExpiringSoonWindow = cfg.PointsExpiringSoonWindow
+	orderSvc := service.NewOrderService(repo, orderCfg)
 
 	// h := handler.NewHTTPHandler(authSvc, cfg.Secret, 1*time.Hour)
 	h := handler.HTTPHandler{
 		AuthService:  authSvc,
 		OrderService: orderSvc,
-		JWT:          auth.NewManager(cfg.Secret, 1*time.Hour),
+		JWT:          auth.NewManager(keys, cfg.AccessTokenTTL),
 		Logger:       slog.Default(),
+		Cookies: handler.CookieConfig{
+			Secure:   cfg.CookieSecure,
+			SameSite: cookieSameSite(cfg.CookieSameSite),
+			Domain:   cfg.CookieDomain,
+			MaxAge:   cfg.CookieMaxAge,
+		},
+		WithdrawStepUp: handler.StepUpConfig{
+			Enabled:   cfg.WithdrawTOTPRequired,
+			Threshold: cfg.WithdrawTOTPThreshold,
+		},
+		AdminToken: cfg.AdminToken,
 	}
 	srv := &http.Server{
 		Addr:         cfg.Address,
@@ -79,9 +102,24 @@ func run() error {
 		WriteTimeout: 30 * time.Second, //nolint: mnd //fine
 	}
 
-	const fetchAccrualFreq = 10 * time.Second
 	client := accrual.NewClient(cfg.AccrualAddress)
-	worker := accrual.NewWorker(repo, client, fetchAccrualFreq)
+	workerCfg := accrual.DefaultConfig()
+	if cfg.InstanceID != "" {
+		workerCfg.InstanceID = cfg.InstanceID
+	}
+	workerCfg.Lease = cfg.AccrualLease
+	workerCfg.BatchSize = cfg.AccrualBatchSize
+	workerCfg.Workers = cfg.AccrualWorkers
+	workerCfg.RateLimit = cfg.AccrualRateLimit
+	workerCfg.Burst = cfg.AccrualRateBurst
+	workerCfg.Recheck.Window = cfg.AccrualRecheckWindow
+	workerCfg.Recheck.Interval = cfg.AccrualRecheckInterval
+	workerCfg.DeadLetter.MaxAttempts = cfg.AccrualStuckAttempts
+	workerCfg.DeadLetter.MaxAge = cfg.AccrualStuckAge
+	worker := accrual.NewWorker(repo, client, workerCfg)
+	sweeper := service.NewHoldSweeper(repo, cfg.HoldSweepInterval)
+	pointsSweeper := service.NewPointsSweeper(orderSvc, cfg.PointsExpirySweepInterval)
+	idempotencySweeper := service.NewIdempotencySweeper(orderSvc, cfg.IdempotencyPurgeInterval)
 
 	g, ctx := errgroup.WithContext(ctx)
 	g.Go(func() error {
@@ -93,6 +131,15 @@ func run() error {
 	g.Go(func() error {
 		return worker.Run(ctx)
 	})
+	g.Go(func() error {
+		return sweeper.Run(ctx)
+	})
+	g.Go(func() error {
+		return pointsSweeper.Run(ctx)
+	})
+	g.Go(func() error {
+		return idempotencySweeper.Run(ctx)
+	})
 	err = g.Wait()
 	if err != nil {
 		return fmt.Errorf("waiting for server to shutdown: %w", err)
@@ -102,6 +149,103 @@ func run() error {
 	return nil
 }
 
+func newAuthService(cfg *config.Server, repo *repository.DBStorage, logger *slog.Logger) (*service.AuthService, error) {
+	policy := auth.NewPasswordPolicy(cfg.PasswordMinLength, cfg.PasswordMaxLength)
+	if cfg.PasswordBreachedList != "" {
+		if err := policy.LoadBreachedPasswords(cfg.PasswordBreachedList); err != nil {
+			return nil, fmt.Errorf("loading password policy: %w", err)
+		}
+		logger.Info("loaded breached passwords list", slog.Int("entries", policy.Breached()))
+	}
+	hasher := auth.NewHasher(&argon2id.Params{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+		SaltLength:  argon2id.DefaultParams.SaltLength,
+		KeyLength:   argon2id.DefaultParams.KeyLength,
+	})
+	var totpCipher *auth.SecretBox
+	if cfg.TOTPEncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.TOTPEncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("decoding totp encryption key: %w", err)
+		}
+		if totpCipher, err = auth.NewSecretBox(key); err != nil {
+			return nil, fmt.Errorf("initializing totp encryption: %w", err)
+		}
+	} else {
+		logger.Info("no totp encryption key configured, two-factor authentication is disabled")
+	}
+	authCfg := service.DefaultAuthConfig()
+	authCfg.Hasher = hasher
+	authCfg.PasswordPolicy = policy
+	authCfg.RefreshTokenTTL = cfg.RefreshTokenTTL
+	authCfg.MaxLoginFailures = cfg.LoginMaxFailures
+	authCfg.MaxAddressFailures = cfg.LoginMaxAddressFailures
+	authCfg.FailureWindow = cfg.LoginFailureWindow
+	authCfg.LockoutDuration = cfg.LoginLockoutDuration
+	authCfg.LoginBaseDelay = cfg.LoginBaseDelay
+	authCfg.TOTPCipher = totpCipher
+	authCfg.TOTPIssuer = cfg.TOTPIssuer
+	authCfg.MFAChallengeTTL = cfg.MFAChallengeTTL
+	return service.NewAuthService(repo, authCfg), nil
+}
+
+// buildKeyring loads JWT keys from PEM files and the shared secret. Without any configured
+// key a random secret is generated, so tokens don't survive a restart and aren't shared between replicas.
+func buildKeyring(cfg *config.Server, logger *slog.Logger) (*auth.Keyring, error) {
+	const secretKeyID = "secret"
+	keys := auth.NewKeyring()
+	for _, path := range cfg.JWTKeyFiles {
+		key, err := auth.LoadKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading jwt key: %w", err)
+		}
+		if err = keys.Add(key); err != nil {
+			return nil, fmt.Errorf("adding jwt key: %w", err)
+		}
+		logger.Info(
+			"loaded jwt key",
+			slog.String("kid", key.ID),
+			slog.String("alg", key.Method.Alg()),
+			slog.Bool("signing", key.CanSign()),
+		)
+	}
+	secret := cfg.Secret
+	if secret == "" && keys.Len() == 0 {
+		logger.Warn("no jwt keys configured, using a random secret: sessions won't survive a restart")
+		secret = rand.Text()
+	}
+	if secret != "" {
+		if err := keys.Add(auth.NewHMACKey(secretKeyID, []byte(secret))); err != nil {
+			return nil, fmt.Errorf("adding jwt secret: %w", err)
+		}
+	}
+	if cfg.JWTSigningKeyID != "" {
+		if err := keys.SetSigningKey(cfg.JWTSigningKeyID); err != nil {
+			return nil, fmt.Errorf("selecting jwt signing key: %w", err)
+		}
+	}
+	if _, err := keys.SigningKey(); err != nil {
+		return nil, fmt.Errorf("selecting jwt signing key: %w", err)
+	}
+	return keys, nil
+}
+
+func cookieSameSite(v config.CookieSameSite) http.SameSite {
+	switch v {
+	case config.CookieSameSiteDefault:
+		return http.SameSiteDefaultMode
+	case config.CookieSameSiteLax:
+		return http.SameSiteLaxMode
+	case config.CookieSameSiteStrict:
+		return http.SameSiteStrictMode
+	case config.CookieSameSiteNone:
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteDefaultMode
+}
+
 func runServer(srv *http.Server, logger *slog.Logger) error {
 	logger.Info("started http server", slog.String("address", srv.Addr))
 	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
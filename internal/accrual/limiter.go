@@ -0,0 +1,92 @@
+package accrual
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	xerrors "github.com/pkg/errors"
+)
+
+// Limiter is a token bucket shared by all workers so that together they stay within the accrual system's
+// rate. A pause stops every worker, it is set when the accrual system answers with a rate limit.
+type Limiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+// NewLimiter allows rate requests per second with bursts of up to burst requests. A zero rate doesn't limit
+// requests, only pauses apply.
+func NewLimiter(rate float64, burst int) *Limiter {
+	burst = max(burst, 1)
+	return &Limiter{
+		mu:          sync.Mutex{},
+		rate:        rate,
+		burst:       float64(burst),
+		tokens:      float64(burst),
+		last:        time.Now(),
+		pausedUntil: time.Time{},
+	}
+}
+
+// Wait blocks until a request may be made or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		d := l.reserve(time.Now())
+		if d <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return xerrors.WithStack(ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// Pause holds back all requests for d. A shorter pause doesn't cut a longer one short.
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := time.Now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	// Start over with an empty bucket so the workers don't rush in all at once when the pause ends.
+	l.tokens = 0
+	l.last = l.pausedUntil
+}
+
+// PausedUntil is when the current pause ends. It is in the past if there is none.
+func (l *Limiter) PausedUntil() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pausedUntil
+}
+
+// reserve takes a token if there is one and returns zero, otherwise it returns how long to wait for one.
+func (l *Limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = min(l.burst, l.tokens+elapsed.Seconds()*l.rate)
+		l.last = now
+	}
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
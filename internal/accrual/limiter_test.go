@@ -0,0 +1,38 @@
+package accrual_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ttl256/gophermart-loyalty/internal/accrual"
+)
+
+func TestLimiterRate(t *testing.T) {
+	t.Parallel()
+	const rate = 50
+	limiter := accrual.NewLimiter(rate, 1)
+	start := time.Now()
+	for range 6 {
+		require.NoError(t, limiter.Wait(context.Background()))
+	}
+	// The first request uses the initial token, the other five wait for theirs.
+	assert.GreaterOrEqual(t, time.Since(start), 5*time.Second/rate)
+}
+
+func TestLimiterPause(t *testing.T) {
+	t.Parallel()
+	limiter := accrual.NewLimiter(0, 1)
+	limiter.Pause(100 * time.Millisecond)
+	limiter.Pause(10 * time.Millisecond)
+	start := time.Now()
+	require.NoError(t, limiter.Wait(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond, "a shorter pause doesn't cut a longer one short")
+
+	limiter.Pause(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, limiter.Wait(ctx), context.DeadlineExceeded)
+}
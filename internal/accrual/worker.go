@@ -5,87 +5,403 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
+	"github.com/cenkalti/backoff/v5"
+	"github.com/google/uuid"
 	xerrors "github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 	"github.com/ttl256/gophermart-loyalty/internal/domain"
 )
 
 type Repo interface {
-	GetOrdersForProcessing(ctx context.Context) ([]domain.Order, error)
+	ClaimOrdersForProcessing(
+		ctx context.Context,
+		owner string,
+		lease time.Duration,
+		limit int32,
+	) ([]domain.Order, error)
+	RenewOrderLeases(ctx context.Context, owner string, orders []domain.OrderNumber, lease time.Duration) (int64, error)
 	UpdateOrderStatus(
 		ctx context.Context,
 		number domain.OrderNumber,
 		status domain.OrderStatus,
 		accrual decimal.Decimal,
+		retry domain.Backoff,
 	) error
+	MarkOrderChecked(ctx context.Context, owner string, number domain.OrderNumber, retry domain.Backoff) error
+	PostponeOrder(ctx context.Context, owner string, number domain.OrderNumber, retry domain.Backoff) error
+	MarkOrdersStuck(ctx context.Context, maxAttempts int32, queuedBefore time.Time) (int64, error)
+	ListenNewOrders(ctx context.Context, notify func()) error
+	ClaimOrdersForRecheck(
+		ctx context.Context,
+		processedAfter time.Time,
+		checkedBefore time.Time,
+		limit int32,
+	) ([]domain.Order, error)
+	ReviseOrderAccrual(
+		ctx context.Context,
+		number domain.OrderNumber,
+		status domain.OrderStatus,
+		accrual decimal.Decimal,
+	) (decimal.Decimal, error)
+}
+
+// RecheckConfig controls asking the accrual system again about processed orders, which it may later invalidate
+// or credit differently.
+type RecheckConfig struct {
+	// Window is how long after processing an order is re-checked. Zero disables re-checks.
+	Window time.Duration
+	// Interval is the least time between two checks of the same order.
+	Interval  time.Duration
+	BatchSize int32
+}
+
+func DefaultRecheckConfig() RecheckConfig {
+	return RecheckConfig{
+		Window:    0,
+		Interval:  time.Hour,
+		BatchSize: 100, //nolint: mnd //fine
+	}
+}
+
+// BackoffConfig spaces out the checks of a pending order by the accrual system's last answer, so orders it
+// takes long to settle don't crowd out fresh ones.
+type BackoffConfig struct {
+	// NotFound is for orders the accrual system doesn't know about yet.
+	NotFound domain.Backoff
+	// Processing is for orders the accrual system hasn't settled yet.
+	Processing domain.Backoff
+	// Failure is for orders the accrual system couldn't be asked about.
+	Failure domain.Backoff
+}
+
+func DefaultBackoffConfig() BackoffConfig {
+	return BackoffConfig{
+		NotFound:   domain.Backoff{Base: 30 * time.Second, Max: time.Hour},        //nolint: mnd //fine
+		Processing: domain.Backoff{Base: 10 * time.Second, Max: 5 * time.Minute},  //nolint: mnd //fine
+		Failure:    domain.Backoff{Base: 30 * time.Second, Max: 30 * time.Minute}, //nolint: mnd //fine
+	}
+}
+
+// DeadLetterConfig controls when the worker gives up on an order the accrual system never settles and marks it
+// STUCK, until an admin requeues it. Zero values disable the limits.
+type DeadLetterConfig struct {
+	// MaxAttempts is how many checks in a row with the same answer an order gets.
+	MaxAttempts int32
+	// MaxAge is how long an order may wait on the accrual system.
+	MaxAge time.Duration
+}
+
+func DefaultDeadLetterConfig() DeadLetterConfig {
+	return DeadLetterConfig{
+		MaxAttempts: 100,                //nolint: mnd //fine
+		MaxAge:      7 * 24 * time.Hour, //nolint: mnd //fine
+	}
 }
 
+// Config controls how often the worker looks for orders and how hard it may hit the accrual system.
+type Config struct {
+	// Freq is how often pending orders due for a check are looked up. New orders are announced by the repo
+	// and processed right away, this is the fallback for orders whose announcement was missed.
+	Freq time.Duration
+	// InstanceID tells the replicas apart. Each claims up to BatchSize pending orders at a time and holds them
+	// for Lease, the lease is renewed while the orders are being processed. Orders of a replica that went
+	// away are picked up by others once their lease runs out.
+	InstanceID string
+	Lease      time.Duration
+	BatchSize  int32
+	// Workers is how many orders are processed at once.
+	Workers int
+	// RateLimit is how many requests per second all workers make together, in bursts of up to Burst.
+	// Zero leaves them unlimited until the accrual system answers with a rate limit.
+	RateLimit  float64
+	Burst      int
+	Backoff    BackoffConfig
+	DeadLetter DeadLetterConfig
+	Recheck    RecheckConfig
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Freq:       10 * time.Second, //nolint: mnd //fine
+		InstanceID: uuid.NewString(),
+		Lease:      time.Minute,
+		BatchSize:  100, //nolint: mnd //fine
+		Workers:    4,   //nolint: mnd //fine
+		RateLimit:  0,
+		Burst:      1,
+		Backoff:    DefaultBackoffConfig(),
+		DeadLetter: DefaultDeadLetterConfig(),
+		Recheck:    DefaultRecheckConfig(),
+	}
+}
+
+// Worker polls for orders that wait on the accrual system and hands them to a pool of goroutines. It also wakes
+// up as soon as new orders are uploaded. The pool shares a Limiter, a rate limit answer from the accrual system
+// pauses all of them.
 type Worker struct {
-	repo   Repo
-	client *Client
-	freq   time.Duration
-	logger *slog.Logger
+	repo    Repo
+	client  *Client
+	cfg     Config
+	limiter *Limiter
+	logger  *slog.Logger
 }
 
-func NewWorker(repo Repo, client *Client, freq time.Duration) *Worker {
+func NewWorker(repo Repo, client *Client, cfg Config) *Worker {
 	return &Worker{
-		repo:   repo,
-		client: client,
-		freq:   freq,
-		logger: slog.Default(),
+		repo:    repo,
+		client:  client,
+		cfg:     cfg,
+		limiter: NewLimiter(cfg.RateLimit, cfg.Burst),
+		logger:  slog.Default(),
 	}
 }
 
-func (w *Worker) Run(ctx context.Context) error { //nolint: gocognit //fine
-	ticker := time.NewTicker(w.freq)
-	var retryAt time.Time
+type job struct {
+	order   domain.OrderNumber
+	msg     string
+	process func(ctx context.Context, order domain.OrderNumber) error
+	done    func()
+}
+
+func (w *Worker) Run(ctx context.Context) error {
+	jobs := make(chan job)
+	var workers sync.WaitGroup
+	for range max(w.cfg.Workers, 1) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				w.handle(ctx, j)
+				j.done()
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		workers.Wait()
+	}()
+
+	wake := make(chan struct{}, 1)
+	listenCtx, stopListening := context.WithCancel(ctx)
+	listened := make(chan struct{})
+	go func() {
+		defer close(listened)
+		w.listen(listenCtx, wake)
+	}()
+	defer func() {
+		stopListening()
+		<-listened
+	}()
+
+	ticker := time.NewTicker(w.cfg.Freq)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return xerrors.WithStack(ctx.Err())
+		case <-wake:
+			if err := w.processPending(ctx, jobs); err != nil {
+				return err
+			}
 		case <-ticker.C:
-			if time.Now().Before(retryAt) {
+			if err := w.markStuck(ctx); err != nil {
+				return err
+			}
+			if err := w.processPending(ctx, jobs); err != nil {
+				return err
+			}
+			if w.cfg.Recheck.Window <= 0 {
 				continue
 			}
-			orders, err := w.repo.GetOrdersForProcessing(ctx)
+			now := time.Now()
+			orders, err := w.repo.ClaimOrdersForRecheck(
+				ctx,
+				now.Add(-w.cfg.Recheck.Window),
+				now.Add(-w.cfg.Recheck.Interval),
+				w.cfg.Recheck.BatchSize,
+			)
 			if err != nil {
-				w.logger.ErrorContext(ctx, "fetching orders for processing", slog.Any("error", err))
+				w.logger.ErrorContext(ctx, "claiming orders for recheck", slog.Any("error", err))
 				return xerrors.WithStack(err)
 			}
-			if len(orders) == 0 {
-				w.logger.DebugContext(ctx, "no orders to process")
+			w.dispatch(ctx, jobs, orders, "rechecking order", w.Recheck)
+		}
+	}
+}
+
+// listen wakes the worker up whenever new orders are uploaded until ctx is done. A lost connection is
+// reestablished with exponential backoff, the polling covers for it in the meantime.
+func (w *Worker) listen(ctx context.Context, wake chan<- struct{}) {
+	reconnect := backoff.NewExponentialBackOff()
+	_, _ = backoff.Retry(
+		ctx,
+		func() (struct{}, error) {
+			err := w.repo.ListenNewOrders(ctx, func() {
+				// Listening works, the next connection failure starts the backoff over.
+				reconnect.Reset()
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			})
+			return struct{}{}, err
+		},
+		backoff.WithBackOff(reconnect),
+		backoff.WithMaxElapsedTime(0),
+		backoff.WithNotify(func(err error, next time.Duration) {
+			w.logger.WarnContext(
+				ctx, "listening for new orders", slog.Duration("retry_in", next), slog.Any("error", err),
+			)
+		}),
+	)
+}
+
+// markStuck gives up on the pending orders that are past the dead letter limits.
+func (w *Worker) markStuck(ctx context.Context) error {
+	cfg := w.cfg.DeadLetter
+	if cfg.MaxAttempts <= 0 && cfg.MaxAge <= 0 {
+		return nil
+	}
+	var queuedBefore time.Time
+	if cfg.MaxAge > 0 {
+		queuedBefore = time.Now().Add(-cfg.MaxAge)
+	}
+	n, err := w.repo.MarkOrdersStuck(ctx, max(cfg.MaxAttempts, 0), queuedBefore)
+	if err != nil {
+		w.logger.ErrorContext(ctx, "marking orders stuck", slog.Any("error", err))
+		return xerrors.WithStack(err)
+	}
+	if n > 0 {
+		w.logger.WarnContext(ctx, "orders marked stuck", slog.Int64("count", n))
+	}
+	return nil
+}
+
+// processPending claims pending orders batch by batch and processes them until no order not leased to another
+// replica is due for a check. Every check schedules the next one, so an order is processed once per call.
+func (w *Worker) processPending(ctx context.Context, jobs chan<- job) error {
+	for {
+		orders, err := w.repo.ClaimOrdersForProcessing(ctx, w.cfg.InstanceID, w.cfg.Lease, w.cfg.BatchSize)
+		if err != nil {
+			w.logger.ErrorContext(ctx, "claiming orders for processing", slog.Any("error", err))
+			return xerrors.WithStack(err)
+		}
+		if len(orders) == 0 {
+			w.logger.DebugContext(ctx, "no orders to process")
+			return nil
+		}
+		numbers := make([]domain.OrderNumber, 0, len(orders))
+		for _, order := range orders {
+			numbers = append(numbers, order.Number)
+		}
+		renewCtx, stopRenewing := context.WithCancel(ctx)
+		renewed := make(chan struct{})
+		go func() {
+			defer close(renewed)
+			w.renewLeases(renewCtx, numbers)
+		}()
+		w.dispatch(ctx, jobs, orders, "processing order", w.Process)
+		stopRenewing()
+		<-renewed
+		if len(orders) < int(w.cfg.BatchSize) || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// renewLeases keeps the leases on the orders until ctx is done or none of them is pending any more.
+func (w *Worker) renewLeases(ctx context.Context, orders []domain.OrderNumber) {
+	const renewalsPerLease = 3
+	ticker := time.NewTicker(w.cfg.Lease / renewalsPerLease)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := w.repo.RenewOrderLeases(ctx, w.cfg.InstanceID, orders, w.cfg.Lease)
+			if err != nil {
+				if ctx.Err() == nil {
+					w.logger.ErrorContext(ctx, "renewing order leases", slog.Any("error", err))
+				}
 				continue
 			}
-			for _, order := range orders {
-				if err = w.Process(ctx, order.Number); err != nil {
-					var errRateLimit RateLimitError
-					if errors.As(err, &errRateLimit) {
-						w.logger.InfoContext(
-							ctx, "rate limit", slog.Duration("retry_after", errRateLimit.RetryAfter),
-						)
-						retryAt = time.Now().Add(errRateLimit.RetryAfter)
-						break
-					}
-					w.logger.ErrorContext(
-						ctx,
-						"processing order",
-						slog.String("order", string(order.Number)),
-						slog.Any("error", fmt.Sprintf("%+v", err)),
-					)
-				}
+			if n == 0 {
+				return
 			}
 		}
 	}
 }
 
+// dispatch hands the orders over to the pool and waits until all of them are handled.
+func (w *Worker) dispatch(
+	ctx context.Context,
+	jobs chan<- job,
+	orders []domain.Order,
+	msg string,
+	process func(ctx context.Context, order domain.OrderNumber) error,
+) {
+	var pending sync.WaitGroup
+	defer pending.Wait()
+	for _, order := range orders {
+		pending.Add(1)
+		select {
+		case jobs <- job{order: order.Number, msg: msg, process: process, done: pending.Done}:
+		case <-ctx.Done():
+			pending.Done()
+			return
+		}
+	}
+}
+
+// handle processes an order once the limiter lets it through. A rate limit answer pauses the whole pool and
+// the order is tried again after the pause.
+func (w *Worker) handle(ctx context.Context, j job) {
+	for {
+		if err := w.limiter.Wait(ctx); err != nil {
+			return
+		}
+		err := j.process(ctx, j.order)
+		if err == nil {
+			return
+		}
+		var errRateLimit RateLimitError
+		if errors.As(err, &errRateLimit) {
+			w.logger.InfoContext(
+				ctx, "rate limit", slog.Duration("retry_after", errRateLimit.RetryAfter),
+			)
+			w.limiter.Pause(errRateLimit.RetryAfter)
+			continue
+		}
+		w.logger.ErrorContext(
+			ctx,
+			j.msg,
+			slog.String("order", string(j.order)),
+			slog.Any("error", fmt.Sprintf("%+v", err)),
+		)
+		return
+	}
+}
+
+// Process asks the accrual system about a pending order and schedules its next check if it's still pending.
+// If the accrual system can't be asked, the order is put off by the failure backoff, except for a rate limit,
+// which pauses the whole pool instead.
 func (w *Worker) Process(ctx context.Context, order domain.OrderNumber) error {
 	info, found, err := w.client.GetOrder(ctx, order)
 	if err != nil {
-		return err
+		var errRateLimit RateLimitError
+		if errors.As(err, &errRateLimit) || ctx.Err() != nil {
+			return err
+		}
+		return w.postpone(ctx, order, err)
 	}
 	if !found {
+		if err = w.repo.MarkOrderChecked(ctx, w.cfg.InstanceID, order, w.cfg.Backoff.NotFound); err != nil {
+			return fmt.Errorf("marking order %q checked: %w", string(order), err)
+		}
 		return nil
 	}
 
@@ -105,11 +421,64 @@ func (w *Worker) Process(ctx context.Context, order domain.OrderNumber) error {
 		newStatus = domain.OrderStatusINVALID
 		accrual = decimal.Zero
 	default:
-		return fmt.Errorf("unexpected accrual status %q for order %q", info.Status.String(), string(order))
+		return w.postpone(
+			ctx, order, fmt.Errorf("unexpected accrual status %q for order %q", info.Status.String(), string(order)),
+		)
 	}
 
-	if err = w.repo.UpdateOrderStatus(ctx, order, newStatus, accrual); err != nil {
+	if err = w.repo.UpdateOrderStatus(ctx, order, newStatus, accrual, w.cfg.Backoff.Processing); err != nil {
 		return fmt.Errorf("updating order %q status: %w", string(order), err)
 	}
 	return nil
 }
+
+// postpone puts off the next check of an order that failed with cause by the failure backoff and returns cause.
+func (w *Worker) postpone(ctx context.Context, order domain.OrderNumber, cause error) error {
+	if err := w.repo.PostponeOrder(ctx, w.cfg.InstanceID, order, w.cfg.Backoff.Failure); err != nil {
+		return errors.Join(cause, fmt.Errorf("postponing order %q: %w", string(order), err))
+	}
+	return cause
+}
+
+// Recheck asks the accrual system about a processed order again. If it now reports the order invalid or
+// a different accrual, the difference is credited or clawed back.
+func (w *Worker) Recheck(ctx context.Context, order domain.OrderNumber) error {
+	info, found, err := w.client.GetOrder(ctx, order)
+	if err != nil {
+		return err
+	}
+
+	var (
+		newStatus domain.OrderStatus
+		accrual   decimal.Decimal
+	)
+
+	switch {
+	case !found, info.Status == OrderStatusPROCESSING, info.Status == OrderStatusREGISTERED:
+		// The check was recorded when the order was claimed.
+		return nil
+	case info.Status == OrderStatusPROCESSED:
+		newStatus = domain.OrderStatusPROCESSED
+		accrual = decimal.Decimal(info.Accrual)
+	case info.Status == OrderStatusINVALID:
+		newStatus = domain.OrderStatusINVALID
+		accrual = decimal.Zero
+	default:
+		return fmt.Errorf("unexpected accrual status %q for order %q", info.Status.String(), string(order))
+	}
+
+	delta, err := w.repo.ReviseOrderAccrual(ctx, order, newStatus, accrual)
+	if err != nil {
+		return fmt.Errorf("revising order %q accrual: %w", string(order), err)
+	}
+	if !delta.IsZero() {
+		w.logger.InfoContext(
+			ctx,
+			"accrual revised",
+			slog.String("order", string(order)),
+			slog.String("status", newStatus.String()),
+			slog.String("delta", delta.String()),
+		)
+	}
+	return nil
+}
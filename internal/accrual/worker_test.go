@@ -0,0 +1,333 @@
+package accrual_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ttl256/gophermart-loyalty/internal/accrual"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+type memRepo struct {
+	mu     sync.Mutex
+	orders map[domain.OrderNumber]domain.Order
+	leases map[domain.OrderNumber]time.Time
+	// uploads announces new orders to ListenNewOrders, listenFailures makes that many calls of it fail.
+	uploads        chan struct{}
+	listenFailures atomic.Int32
+}
+
+func newMemRepo(n int) *memRepo {
+	r := &memRepo{
+		mu:     sync.Mutex{},
+		orders: make(map[domain.OrderNumber]domain.Order, n),
+		leases: make(map[domain.OrderNumber]time.Time, n),
+
+		uploads:        make(chan struct{}, 1),
+		listenFailures: atomic.Int32{},
+	}
+	for i := range n {
+		number := domain.OrderNumber(fmt.Sprintf("%04d", i))
+		r.orders[number] = domain.Order{Number: number, Status: domain.OrderStatusNEW}
+	}
+	return r
+}
+
+func (r *memRepo) ClaimOrdersForProcessing(
+	_ context.Context,
+	_ string,
+	lease time.Duration,
+	limit int32,
+) ([]domain.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var orders []domain.Order
+	for number, order := range r.orders {
+		if len(orders) == int(limit) {
+			break
+		}
+		pending := order.Status == domain.OrderStatusNEW || order.Status == domain.OrderStatusPROCESSING
+		if !pending || time.Now().Before(r.leases[number]) || time.Now().Before(order.NextAttemptAt) {
+			continue
+		}
+		r.leases[number] = time.Now().Add(lease)
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+func (r *memRepo) RenewOrderLeases(
+	_ context.Context,
+	_ string,
+	_ []domain.OrderNumber,
+	_ time.Duration,
+) (int64, error) {
+	return 0, nil
+}
+
+func (r *memRepo) UpdateOrderStatus(
+	_ context.Context,
+	number domain.OrderNumber,
+	status domain.OrderStatus,
+	accrual decimal.Decimal,
+	retry domain.Backoff,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order := r.orders[number]
+	order.Status = status
+	order.Accrual = accrual
+	order.CheckedAt = time.Now()
+	r.orders[number] = order
+	r.schedule(number, retry)
+	return nil
+}
+
+func (r *memRepo) MarkOrderChecked(
+	_ context.Context,
+	_ string,
+	number domain.OrderNumber,
+	retry domain.Backoff,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schedule(number, retry)
+	return nil
+}
+
+func (r *memRepo) PostponeOrder(
+	_ context.Context,
+	_ string,
+	number domain.OrderNumber,
+	retry domain.Backoff,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schedule(number, retry)
+	return nil
+}
+
+func (r *memRepo) MarkOrdersStuck(_ context.Context, _ int32, _ time.Time) (int64, error) {
+	return 0, nil
+}
+
+// schedule counts the attempt, ends the lease and puts the next check off by the first step of retry.
+func (r *memRepo) schedule(number domain.OrderNumber, retry domain.Backoff) {
+	order := r.orders[number]
+	order.Attempts++
+	order.NextAttemptAt = time.Now().Add(min(retry.Base, retry.Max))
+	r.orders[number] = order
+	delete(r.leases, number)
+}
+
+func (r *memRepo) ClaimOrdersForRecheck(_ context.Context, _, _ time.Time, _ int32) ([]domain.Order, error) {
+	return nil, nil
+}
+
+func (r *memRepo) ReviseOrderAccrual(
+	_ context.Context,
+	_ domain.OrderNumber,
+	_ domain.OrderStatus,
+	_ decimal.Decimal,
+) (decimal.Decimal, error) {
+	return decimal.Zero, nil
+}
+
+func (r *memRepo) attempts() []int32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempts := make([]int32, 0, len(r.orders))
+	for _, order := range r.orders {
+		attempts = append(attempts, order.Attempts)
+	}
+	return attempts
+}
+
+func (r *memRepo) ListenNewOrders(ctx context.Context, notify func()) error {
+	if r.listenFailures.Add(-1) >= 0 {
+		return errors.New("connection refused")
+	}
+	notify()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.uploads:
+			notify()
+		}
+	}
+}
+
+// upload adds a new order and announces it.
+func (r *memRepo) upload(number domain.OrderNumber) {
+	r.mu.Lock()
+	r.orders[number] = domain.Order{Number: number, Status: domain.OrderStatusNEW}
+	r.mu.Unlock()
+	r.uploads <- struct{}{}
+}
+
+func (r *memRepo) processed() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int
+	for _, order := range r.orders {
+		if order.Status == domain.OrderStatusPROCESSED {
+			n++
+		}
+	}
+	return n
+}
+
+func runWorker(t *testing.T, repo accrual.Repo, url string, workers int) {
+	t.Helper()
+	cfg := accrual.DefaultConfig()
+	cfg.Freq = 10 * time.Millisecond
+	cfg.BatchSize = 8
+	cfg.Workers = workers
+	startWorker(t, repo, url, cfg)
+}
+
+func startWorker(t *testing.T, repo accrual.Repo, url string, cfg accrual.Config) {
+	t.Helper()
+	worker := accrual.NewWorker(repo, accrual.NewClient(url), cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = worker.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func writeProcessed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = fmt.Fprintf(w, `{"order":%q,"status":"PROCESSED","accrual":10}`, path.Base(r.URL.Path))
+}
+
+func TestWorkerPool(t *testing.T) {
+	t.Parallel()
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		writeProcessed(w, r)
+	}))
+	defer srv.Close()
+
+	const orders, workers = 40, 4
+	repo := newMemRepo(orders)
+	runWorker(t, repo, srv.URL, workers)
+
+	require.Eventually(t, func() bool { return repo.processed() == orders }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(workers), peak.Load(), "orders are processed concurrently, never by more than the pool")
+}
+
+func TestWorkerRateLimitPausesPool(t *testing.T) {
+	t.Parallel()
+	var (
+		mu        sync.Mutex
+		limitedAt time.Time
+		early     int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if limitedAt.IsZero() {
+			limitedAt = time.Now()
+			mu.Unlock()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if time.Since(limitedAt) < time.Second {
+			early++
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		writeProcessed(w, r)
+	}))
+	defer srv.Close()
+
+	const orders = 20
+	repo := newMemRepo(orders)
+	runWorker(t, repo, srv.URL, 4)
+
+	require.Eventually(t, func() bool { return repo.processed() == orders }, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	// Requests already on the wire when the limit came back may still land, nothing is sent after it.
+	assert.LessOrEqual(t, early, 3, "the whole pool waits out the rate limit")
+}
+
+func TestWorkerPostponesFailedOrders(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	const orders = 5
+	repo := newMemRepo(orders)
+	runWorker(t, repo, srv.URL, 2)
+
+	require.Eventually(t, func() bool { return requests.Load() == orders }, 5*time.Second, 10*time.Millisecond)
+	// Many ticks go by, none of them may ask about an order that is backing off.
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(orders), requests.Load())
+	assert.Equal(t, []int32{1, 1, 1, 1, 1}, repo.attempts())
+}
+
+func TestWorkerWakesOnNewOrders(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(writeProcessed))
+	defer srv.Close()
+
+	repo := newMemRepo(0)
+	repo.listenFailures.Store(1)
+	cfg := accrual.DefaultConfig()
+	cfg.Freq = time.Hour
+	startWorker(t, repo, srv.URL, cfg)
+
+	// The first upload may come before the worker listens again, then reconnecting picks it up.
+	repo.upload("0001")
+	require.Eventually(t, func() bool { return repo.processed() == 1 }, 5*time.Second, 10*time.Millisecond)
+	repo.upload("0002")
+	require.Eventually(t, func() bool { return repo.processed() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestRecheckLeavesPendingAnswersAlone(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	repo := newMemRepo(0)
+	repo.orders["0001"] = domain.Order{Number: "0001", Status: domain.OrderStatusPROCESSED}
+	worker := accrual.NewWorker(repo, accrual.NewClient(srv.URL), accrual.DefaultConfig())
+
+	require.NoError(t, worker.Recheck(context.Background(), "0001"))
+	assert.Equal(t, []int32{0}, repo.attempts(), "processed orders keep their retry schedule")
+}
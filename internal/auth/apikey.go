@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix marks API keys so they can be told apart from JWTs and spotted by secret scanners.
+const APIKeyPrefix = "gmk_"
+
+// apiKeyDisplayLen is how much of a key is kept in plain text to let users recognize it.
+const apiKeyDisplayLen = len(APIKeyPrefix) + 6
+
+// APIKey is an opaque high-entropy key. It is shown to the user once, only its hash is persisted.
+type APIKey string
+
+func NewAPIKey() APIKey {
+	return APIKey(APIKeyPrefix + rand.Text())
+}
+
+func IsAPIKey(s string) bool {
+	return strings.HasPrefix(s, APIKeyPrefix)
+}
+
+func (k APIKey) Hash() string {
+	sum := sha256.Sum256([]byte(k))
+	return hex.EncodeToString(sum[:])
+}
+
+func (k APIKey) Prefix() string {
+	if len(k) < apiKeyDisplayLen {
+		return string(k)
+	}
+	return string(k[:apiKeyDisplayLen])
+}
@@ -7,53 +7,103 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
 )
 
+type Claims struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	Role      domain.UserRole
+}
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+
+	SessionID string `json:"sid"`
+	Role      string `json:"role,omitempty"`
+}
+
 type Manager struct {
-	secret []byte
-	ttl    time.Duration
+	keys *Keyring
+	ttl  time.Duration
 }
 
-func NewManager(secret string, ttl time.Duration) *Manager {
-	return &Manager{secret: []byte(secret), ttl: ttl}
+func NewManager(keys *Keyring, ttl time.Duration) *Manager {
+	return &Manager{keys: keys, ttl: ttl}
 }
 
-func (m *Manager) Issue(userID uuid.UUID) (string, error) {
+func (m *Manager) TTL() time.Duration {
+	return m.ttl
+}
+
+func (m *Manager) Issue(c Claims) (string, error) {
 	now := time.Now()
-	claims := jwt.RegisteredClaims{ //nolint: exhaustruct //fine
-		Subject:   userID.String(),
-		ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
-		IssuedAt:  jwt.NewNumericDate(now),
+	claims := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{ //nolint: exhaustruct //fine
+			Subject:   c.UserID.String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		SessionID: c.SessionID.String(),
+		Role:      c.Role.String(),
+	}
+	key, err := m.keys.SigningKey()
+	if err != nil {
+		return "", fmt.Errorf("sign jwt: %w", err)
 	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	s, err := t.SignedString(m.secret)
+	t := jwt.NewWithClaims(key.Method, claims)
+	t.Header["kid"] = key.ID
+	s, err := t.SignedString(key.sign)
 	if err != nil {
 		return "", fmt.Errorf("sign jwt: %w", err)
 	}
 	return s, nil
 }
 
-func (m *Manager) Parse(token string) (uuid.UUID, error) {
+func (m *Manager) JWKS() JWKS {
+	return m.keys.JWKS()
+}
+
+func (m *Manager) Parse(token string) (Claims, error) {
 	parsed, err := jwt.ParseWithClaims(
 		token,
-		&jwt.RegisteredClaims{}, //nolint: exhaustruct //fine
+		&tokenClaims{}, //nolint: exhaustruct //fine
 		func(t *jwt.Token) (any, error) {
-			if t.Method != jwt.SigningMethodHS256 {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			kid, ok := t.Header["kid"].(string)
+			if !ok {
+				return nil, errors.New("missing kid header")
+			}
+			key, err := m.keys.Lookup(kid)
+			if err != nil {
+				return nil, err
 			}
-			return m.secret, nil
+			if t.Method.Alg() != key.Method.Alg() {
+				return nil, fmt.Errorf("unexpected signing method for key %q: %v", kid, t.Header["alg"])
+			}
+			return key.verify, nil
 		},
 	)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("parse jwt: %w", err)
+		return Claims{}, fmt.Errorf("parse jwt: %w", err)
 	}
-	claims, ok := parsed.Claims.(*jwt.RegisteredClaims)
+	claims, ok := parsed.Claims.(*tokenClaims)
 	if !ok || !parsed.Valid {
-		return uuid.Nil, errors.New("invalid jwt")
+		return Claims{}, errors.New("invalid jwt")
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return Claims{}, fmt.Errorf("parse subject: %w", err)
 	}
-	id, err := uuid.Parse(claims.Subject)
+	sessionID, err := uuid.Parse(claims.SessionID)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("parse subject: %w", err)
+		return Claims{}, fmt.Errorf("parse session id: %w", err)
+	}
+	// Tokens issued before roles were introduced carry none.
+	role := domain.UserRoleUser
+	if claims.Role != "" {
+		if role, err = domain.ParseUserRole(claims.Role); err != nil {
+			return Claims{}, fmt.Errorf("parse role: %w", err)
+		}
 	}
-	return id, nil
+	return Claims{UserID: userID, SessionID: sessionID, Role: role}, nil
 }
@@ -0,0 +1,134 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ttl256/gophermart-loyalty/internal/auth"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+func TestManagerRoundTrip(t *testing.T) {
+	t.Parallel()
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name string
+		key  func(t *testing.T) auth.Key
+	}{
+		{"hs256", func(_ *testing.T) auth.Key { return auth.NewHMACKey("hs", []byte("secret")) }},
+		{"eddsa", func(t *testing.T) auth.Key { return pemKey(t, "ed", edPriv) }},
+		{"rs256", func(t *testing.T) auth.Key { return pemKey(t, "rsa", rsaPriv) }},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			keys := auth.NewKeyring()
+			require.NoError(t, keys.Add(tt.key(t)))
+			m := auth.NewManager(keys, time.Minute)
+
+			want := auth.Claims{UserID: uuid.New(), SessionID: uuid.New(), Role: domain.UserRoleSupport}
+			token, err := m.Issue(want)
+			require.NoError(t, err)
+			got, err := m.Parse(token)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestManagerKeyRotation(t *testing.T) {
+	t.Parallel()
+	_, oldPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, newPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keys := auth.NewKeyring()
+	require.NoError(t, keys.Add(pemKey(t, "old", oldPriv)))
+	require.NoError(t, keys.Add(pemKey(t, "new", newPriv)))
+	m := auth.NewManager(keys, time.Minute)
+
+	oldToken, err := m.Issue(auth.Claims{UserID: uuid.New(), SessionID: uuid.New()})
+	require.NoError(t, err)
+
+	require.NoError(t, keys.SetSigningKey("new"))
+	newToken, err := m.Issue(auth.Claims{UserID: uuid.New(), SessionID: uuid.New()})
+	require.NoError(t, err)
+
+	_, err = m.Parse(oldToken)
+	require.NoError(t, err, "tokens signed by a retired key must verify while it is in the ring")
+	_, err = m.Parse(newToken)
+	require.NoError(t, err)
+
+	other := auth.NewKeyring()
+	require.NoError(t, other.Add(pemKey(t, "old", newPriv)))
+	_, err = auth.NewManager(other, time.Minute).Parse(oldToken)
+	require.Error(t, err, "token must not verify with a different key under the same kid")
+}
+
+func TestKeyringVerificationOnlyKey(t *testing.T) {
+	t.Parallel()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keys := auth.NewKeyring()
+	pubKey := pemPublicKey(t, "pub", pub)
+	require.NoError(t, keys.Add(pubKey))
+	assert.False(t, pubKey.CanSign())
+	require.Error(t, keys.SetSigningKey("pub"))
+
+	_, err = auth.NewManager(keys, time.Minute).Issue(auth.Claims{UserID: uuid.New(), SessionID: uuid.New()})
+	require.Error(t, err)
+}
+
+func TestKeyringJWKS(t *testing.T) {
+	t.Parallel()
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keys := auth.NewKeyring()
+	require.NoError(t, keys.Add(auth.NewHMACKey("hs", []byte("secret"))))
+	require.NoError(t, keys.Add(pemKey(t, "ed", edPriv)))
+	require.NoError(t, keys.Add(pemKey(t, "rsa", rsaPriv)))
+
+	jwks := keys.JWKS()
+	require.Len(t, jwks.Keys, 2, "symmetric keys must not be published")
+	assert.Equal(t, "ed", jwks.Keys[0].KeyID)
+	assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+	assert.Equal(t, "EdDSA", jwks.Keys[0].Algorithm)
+	assert.Equal(t, "rsa", jwks.Keys[1].KeyID)
+	assert.Equal(t, "RSA", jwks.Keys[1].KeyType)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+}
+
+func pemKey(t *testing.T, id string, priv any) auth.Key {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	key, err := auth.ParsePEMKey(id, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Headers: nil, Bytes: der}))
+	require.NoError(t, err)
+	return key
+}
+
+func pemPublicKey(t *testing.T, id string, pub any) auth.Key {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	key, err := auth.ParsePEMKey(id, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Headers: nil, Bytes: der}))
+	require.NoError(t, err)
+	return key
+}
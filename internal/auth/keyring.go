@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSABits = 2048
+
+var (
+	errUnknownKeyID    = errors.New("unknown key id")
+	errKeyCannotSign   = errors.New("key has no private part")
+	errNoSigningKey    = errors.New("no signing key")
+	errUnsupportedKey  = errors.New("unsupported key type")
+	errDuplicateKeyID  = errors.New("duplicate key id")
+	errWeakRSAKey      = errors.New("rsa key is too short")
+	errPEMBlockMissing = errors.New("no pem block found")
+)
+
+// Key is a single JWT key identified by its kid. Verification-only keys have no signing part.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	sign   any
+	verify any
+}
+
+func (k Key) CanSign() bool {
+	return k.sign != nil
+}
+
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{
+		ID:     id,
+		Method: jwt.SigningMethodHS256,
+		sign:   secret,
+		verify: secret,
+	}
+}
+
+// LoadKeyFile reads a PEM encoded Ed25519 or RSA key. The file name without extension becomes the kid.
+func LoadKeyFile(path string) (Key, error) {
+	data, err := os.ReadFile(path) //nolint: gosec //operator supplied path
+	if err != nil {
+		return Key{}, fmt.Errorf("reading key file: %w", err)
+	}
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	key, err := ParsePEMKey(id, data)
+	if err != nil {
+		return Key{}, fmt.Errorf("key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+func ParsePEMKey(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errPEMBlockMissing
+	}
+	var (
+		parsed any
+		err    error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("%w: pem block %q", errUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("parsing %s: %w", block.Type, err)
+	}
+	return newAsymmetricKey(id, parsed)
+}
+
+func newAsymmetricKey(id string, parsed any) (Key, error) {
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public()}, nil
+	case ed25519.PublicKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, sign: nil, verify: k}, nil
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSABits {
+			return Key{}, errWeakRSAKey
+		}
+		return Key{ID: id, Method: jwt.SigningMethodRS256, sign: k, verify: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return Key{}, errWeakRSAKey
+		}
+		return Key{ID: id, Method: jwt.SigningMethodRS256, sign: nil, verify: k}, nil
+	default:
+		return Key{}, fmt.Errorf("%w: %T", errUnsupportedKey, parsed)
+	}
+}
+
+// Keyring holds every key tokens may be verified with and the one new tokens are signed with.
+// Retired keys stay in the ring as verification-only until tokens signed by them expire.
+type Keyring struct {
+	keys    map[string]Key
+	order   []string
+	signing string
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{
+		keys:    make(map[string]Key),
+		order:   nil,
+		signing: "",
+	}
+}
+
+// Add registers a key. The first key able to sign becomes the signing key.
+func (r *Keyring) Add(key Key) error {
+	if _, ok := r.keys[key.ID]; ok {
+		return fmt.Errorf("%w: %q", errDuplicateKeyID, key.ID)
+	}
+	r.keys[key.ID] = key
+	r.order = append(r.order, key.ID)
+	if r.signing == "" && key.CanSign() {
+		r.signing = key.ID
+	}
+	return nil
+}
+
+func (r *Keyring) SetSigningKey(id string) error {
+	key, ok := r.keys[id]
+	if !ok {
+		return fmt.Errorf("%w: %q", errUnknownKeyID, id)
+	}
+	if !key.CanSign() {
+		return fmt.Errorf("%q: %w", id, errKeyCannotSign)
+	}
+	r.signing = id
+	return nil
+}
+
+func (r *Keyring) Len() int {
+	return len(r.keys)
+}
+
+func (r *Keyring) SigningKey() (Key, error) {
+	key, ok := r.keys[r.signing]
+	if !ok {
+		return Key{}, errNoSigningKey
+	}
+	return key, nil
+}
+
+func (r *Keyring) Lookup(id string) (Key, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return Key{}, fmt.Errorf("%w: %q", errUnknownKeyID, id)
+	}
+	return key, nil
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes public keys of the ring. Symmetric keys are never exposed.
+func (r *Keyring) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(r.keys))}
+	for _, id := range r.order {
+		key := r.keys[id]
+		switch pub := key.verify.(type) {
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+				N:         "",
+				E:         "",
+			})
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     "",
+				X:         "",
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		}
+	}
+	return jwks
+}
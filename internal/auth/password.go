@@ -8,14 +8,36 @@ import (
 
 type PasswordHash string
 
-func NewHashPassword(password string) (PasswordHash, error) {
-	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+// Hasher creates argon2id hashes with the configured parameters.
+type Hasher struct {
+	params *argon2id.Params
+}
+
+func NewHasher(params *argon2id.Params) *Hasher {
+	return &Hasher{params: params}
+}
+
+func (h *Hasher) Hash(password string) (PasswordHash, error) {
+	hash, err := argon2id.CreateHash(password, h.params)
 	if err != nil {
 		return "", fmt.Errorf("hashing password: %w", err)
 	}
 	return PasswordHash(hash), nil
 }
 
+// NeedsRehash reports whether the hash was created with weaker parameters than the current ones.
+func (h *Hasher) NeedsRehash(hash PasswordHash) bool {
+	params, _, _, err := argon2id.DecodeHash(string(hash))
+	if err != nil {
+		return false
+	}
+	return params.Memory < h.params.Memory ||
+		params.Iterations < h.params.Iterations ||
+		params.Parallelism < h.params.Parallelism ||
+		params.SaltLength < h.params.SaltLength ||
+		params.KeyLength < h.params.KeyLength
+}
+
 func (h PasswordHash) ComparePassword(password string) (bool, error) {
 	ok, err := argon2id.ComparePasswordAndHash(password, string(h))
 	if err != nil {
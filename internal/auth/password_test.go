@@ -0,0 +1,68 @@
+package auth_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ttl256/gophermart-loyalty/internal/auth"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	t.Parallel()
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	data := "qwerty123\n" +
+		// SHA-1 of "password1" in Pwned Passwords format.
+		"E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D:2413945\n"
+	require.NoError(t, os.WriteFile(list, []byte(data), 0o600))
+
+	policy := auth.NewPasswordPolicy(8, 16)
+	require.NoError(t, policy.LoadBreachedPasswords(list))
+	assert.Equal(t, 2, policy.Breached())
+
+	cases := []struct {
+		password string
+		want     error
+	}{
+		{"correct horse", nil},
+		{"short", domain.ErrWeakPassword},
+		{"пароль-пароль", nil},
+		{"much too long for the policy", domain.ErrWeakPassword},
+		{"qwerty123", domain.ErrWeakPassword},
+		{"password1", domain.ErrWeakPassword},
+	}
+	for _, tt := range cases {
+		t.Run(tt.password, func(t *testing.T) {
+			t.Parallel()
+			require.ErrorIs(t, policy.Validate(tt.password), tt.want)
+		})
+	}
+}
+
+func TestHasherNeedsRehash(t *testing.T) {
+	t.Parallel()
+	weak := auth.NewHasher(&argon2id.Params{
+		Memory:      8 * 1024,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	})
+	strong := auth.NewHasher(argon2id.DefaultParams)
+
+	hash, err := weak.Hash("secret")
+	require.NoError(t, err)
+	assert.True(t, strong.NeedsRehash(hash))
+	assert.False(t, weak.NeedsRehash(hash))
+
+	hash, err = strong.Hash("secret")
+	require.NoError(t, err)
+	assert.False(t, strong.NeedsRehash(hash))
+	ok, err := hash.ComparePassword("secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint: gosec //matches the breached passwords list format, not used for storage
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// PasswordPolicy rejects passwords of unacceptable length or known to be breached.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+
+	breached map[[sha1.Size]byte]struct{}
+}
+
+func NewPasswordPolicy(minLength int, maxLength int) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength: minLength,
+		MaxLength: maxLength,
+		breached:  make(map[[sha1.Size]byte]struct{}),
+	}
+}
+
+// LoadBreachedPasswords reads a list with one entry per line: either a plain password
+// or an uppercase SHA-1 in the "HASH:count" format of Pwned Passwords dumps.
+func (p *PasswordPolicy) LoadBreachedPasswords(path string) error {
+	f, err := os.Open(path) //nolint: gosec //operator supplied path
+	if err != nil {
+		return fmt.Errorf("opening breached passwords list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		p.breached[breachedEntry(line)] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("reading breached passwords list: %w", err)
+	}
+	return nil
+}
+
+func (p *PasswordPolicy) Breached() int {
+	return len(p.breached)
+}
+
+func (p *PasswordPolicy) Validate(password string) error {
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		return fmt.Errorf("%w: shorter than %d characters", domain.ErrWeakPassword, p.MinLength)
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		return fmt.Errorf("%w: longer than %d characters", domain.ErrWeakPassword, p.MaxLength)
+	}
+	if _, ok := p.breached[sha1.Sum([]byte(password))]; ok { //nolint: gosec //see import
+		return fmt.Errorf("%w: found in breached passwords list", domain.ErrWeakPassword)
+	}
+	return nil
+}
+
+func breachedEntry(line string) [sha1.Size]byte {
+	hash, _, _ := strings.Cut(line, ":")
+	if len(hash) == hex.EncodedLen(sha1.Size) {
+		var sum [sha1.Size]byte
+		if _, err := hex.Decode(sum[:], []byte(hash)); err == nil {
+			return sum
+		}
+	}
+	return sha1.Sum([]byte(line)) //nolint: gosec //see import
+}
@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// RefreshToken is an opaque high-entropy token. Only its hash is persisted.
+type RefreshToken string
+
+func NewRefreshToken() RefreshToken {
+	return RefreshToken(rand.Text())
+}
+
+func (t RefreshToken) Hash() string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
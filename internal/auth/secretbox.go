@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+const secretBoxKeyLen = 32
+
+var (
+	ErrInvalidKeyLength = errors.New("encryption key must be 32 bytes")
+	ErrMalformedSealed  = errors.New("malformed ciphertext")
+)
+
+// SecretBox encrypts small secrets at rest with AES-256-GCM.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+func NewSecretBox(key []byte) (*SecretBox, error) {
+	if len(key) != secretBoxKeyLen {
+		return nil, ErrInvalidKeyLength
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating gcm: %w", err)
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+// Seal encrypts plaintext with a random nonce prepended to the result.
+// The same additionalData must be passed to Open, binding the ciphertext to e.g. its owner.
+func (b *SecretBox) Seal(plaintext []byte, additionalData []byte) []byte {
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(plaintext)+b.aead.Overhead())
+	_, _ = rand.Read(nonce)
+	return b.aead.Seal(nonce, nonce, plaintext, additionalData)
+}
+
+func (b *SecretBox) Open(sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < b.aead.NonceSize() {
+		return nil, ErrMalformedSealed
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting: %w", err)
+	}
+	return plaintext, nil
+}
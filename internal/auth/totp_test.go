@@ -0,0 +1,86 @@
+package auth_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ttl256/gophermart-loyalty/internal/auth"
+)
+
+func TestTOTPCode(t *testing.T) {
+	t.Parallel()
+	// RFC 6238 appendix B, SHA-1 column truncated to 6 digits.
+	secret := auth.TOTPSecret("12345678901234567890")
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range cases {
+		assert.Equal(t, tt.want, secret.Code(time.Unix(tt.unix, 0)), "T=%d", tt.unix)
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	t.Parallel()
+	secret := auth.NewTOTPSecret()
+	now := time.Now()
+
+	step, ok := secret.Verify(secret.Code(now), now)
+	require.True(t, ok)
+	assert.Equal(t, auth.TOTPStep(now), step)
+
+	step, ok = secret.Verify(secret.Code(now.Add(-30*time.Second)), now)
+	require.True(t, ok, "previous period is accepted to tolerate clock drift")
+	assert.Equal(t, auth.TOTPStep(now)-1, step)
+
+	_, ok = secret.Verify(secret.Code(now.Add(-2*time.Minute)), now)
+	assert.False(t, ok)
+	_, ok = secret.Verify("", now)
+	assert.False(t, ok)
+
+	uri, err := url.Parse(secret.URI("Gophermart", "alice"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, secret.String(), uri.Query().Get("secret"))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Parallel()
+	codes := auth.NewRecoveryCodes(10)
+	require.Len(t, codes, 10)
+	seen := make(map[auth.RecoveryCode]struct{})
+	for _, code := range codes {
+		seen[code] = struct{}{}
+	}
+	assert.Len(t, seen, 10)
+	typed := auth.RecoveryCode(strings.ToUpper(strings.ReplaceAll(string(codes[0]), "-", " ")))
+	assert.Equal(t, codes[0].Hash(), typed.Hash())
+}
+
+func TestSecretBox(t *testing.T) {
+	t.Parallel()
+	_, err := auth.NewSecretBox([]byte("short"))
+	require.ErrorIs(t, err, auth.ErrInvalidKeyLength)
+
+	box, err := auth.NewSecretBox([]byte(strings.Repeat("k", 32)))
+	require.NoError(t, err)
+	sealed := box.Seal([]byte("secret"), []byte("alice"))
+
+	plain, err := box.Open(sealed, []byte("alice"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), plain)
+
+	_, err = box.Open(sealed, []byte("mallory"))
+	require.Error(t, err, "ciphertext is bound to its owner")
+}
@@ -6,25 +6,157 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/alexflint/go-arg"
+	"github.com/shopspring/decimal"
 )
 
+// CookieSameSite ENUM(default, lax, strict, none).
+type CookieSameSite int //nolint: recvcheck //fine
+
+var ErrInsecureSameSiteNone = errors.New("SameSite=None cookies require the Secure attribute")
+
 type Server struct {
-	Address        string     `arg:"-a,env:RUN_ADDRESS"`
-	DSN            string     `arg:"-d,env:DATABASE_URI"`
-	AccrualAddress string     `arg:"-r,env:ACCRUAL_SYSTEM_ADDRESS"`
-	Secret         string     `arg:"-s,env:SECRET"`
-	LogLevel       slog.Level `arg:"--loglevel,env:LOG_LEVEL"`
+	Address         string        `arg:"-a,env:RUN_ADDRESS"`
+	DSN             string        `arg:"-d,env:DATABASE_URI"`
+	AccrualAddress  string        `arg:"-r,env:ACCRUAL_SYSTEM_ADDRESS"`
+	Secret          string        `arg:"-s,env:SECRET"`
+	JWTKeyFiles     []string      `arg:"--jwt-key,separate,env:JWT_KEY_FILES"`
+	JWTSigningKeyID string        `arg:"--jwt-signing-key,env:JWT_SIGNING_KEY_ID"`
+	AccessTokenTTL  time.Duration `arg:"--access-token-ttl,env:ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `arg:"--refresh-token-ttl,env:REFRESH_TOKEN_TTL"`
+	LogLevel        slog.Level    `arg:"--loglevel,env:LOG_LEVEL"`
+	AdminToken      string        `arg:"--admin-token,env:ADMIN_TOKEN"`
+
+	CookieSecure   bool           `arg:"--cookie-secure,env:COOKIE_SECURE"`
+	CookieSameSite CookieSameSite `arg:"--cookie-samesite,env:COOKIE_SAMESITE"`
+	CookieDomain   string         `arg:"--cookie-domain,env:COOKIE_DOMAIN"`
+	CookieMaxAge   time.Duration  `arg:"--cookie-max-age,env:COOKIE_MAX_AGE"`
+
+	LoginMaxFailures        int           `arg:"--login-max-failures,env:LOGIN_MAX_FAILURES"`
+	LoginMaxAddressFailures int           `arg:"--login-max-address-failures,env:LOGIN_MAX_ADDRESS_FAILURES"`
+	LoginFailureWindow      time.Duration `arg:"--login-failure-window,env:LOGIN_FAILURE_WINDOW"`
+	LoginLockoutDuration    time.Duration `arg:"--login-lockout-duration,env:LOGIN_LOCKOUT_DURATION"`
+	LoginBaseDelay          time.Duration `arg:"--login-base-delay,env:LOGIN_BASE_DELAY"`
+
+	PasswordMinLength    int    `arg:"--password-min-length,env:PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength    int    `arg:"--password-max-length,env:PASSWORD_MAX_LENGTH"`
+	PasswordBreachedList string `arg:"--password-breached-list,env:PASSWORD_BREACHED_LIST"`
+	Argon2Memory         uint32 `arg:"--argon2-memory,env:ARGON2_MEMORY"`
+	Argon2Iterations     uint32 `arg:"--argon2-iterations,env:ARGON2_ITERATIONS"`
+	Argon2Parallelism    uint8  `arg:"--argon2-parallelism,env:ARGON2_PARALLELISM"`
+
+	// TOTPEncryptionKey is a base64 encoded 32 byte key. Two-factor authentication is disabled without it.
+	TOTPEncryptionKey     string          `arg:"--totp-key,env:TOTP_ENCRYPTION_KEY"`
+	TOTPIssuer            string          `arg:"--totp-issuer,env:TOTP_ISSUER"`
+	MFAChallengeTTL       time.Duration   `arg:"--mfa-challenge-ttl,env:MFA_CHALLENGE_TTL"`
+	WithdrawTOTPRequired  bool            `arg:"--withdraw-totp-required,env:WITHDRAW_TOTP_REQUIRED"`
+	WithdrawTOTPThreshold decimal.Decimal `arg:"--withdraw-totp-threshold,env:WITHDRAW_TOTP_THRESHOLD"`
+
+	// WithdrawAllowOrderCollision lets withdrawals use the number of an uploaded order and uploads the number of
+	// a withdrawal.
+	WithdrawAllowOrderCollision bool `arg:"--withdraw-allow-order-collision,env:WITHDRAW_ALLOW_ORDER_COLLISION"`
+
+	HoldTTL           time.Duration `arg:"--hold-ttl,env:HOLD_TTL"`
+	HoldMaxTTL        time.Duration `arg:"--hold-max-ttl,env:HOLD_MAX_TTL"`
+	HoldSweepInterval time.Duration `arg:"--hold-sweep-interval,env:HOLD_SWEEP_INTERVAL"`
+
+	// IdempotencyPurgeInterval is how often idempotency keys past their TTL are deleted.
+	IdempotencyPurgeInterval time.Duration `arg:"--idempotency-purge-interval,env:IDEMPOTENCY_PURGE_INTERVAL"`
+
+	// InstanceID tells replicas apart when they claim orders for processing. A random one is used if unset.
+	InstanceID string `arg:"--instance-id,env:INSTANCE_ID"`
+	// AccrualLease is how long a replica holds the orders it claimed, AccrualBatchSize how many it claims at once.
+	AccrualLease     time.Duration `arg:"--accrual-lease,env:ACCRUAL_LEASE"`
+	AccrualBatchSize int32         `arg:"--accrual-batch-size,env:ACCRUAL_BATCH_SIZE"`
+
+	// AccrualWorkers is how many orders are processed at once. AccrualRateLimit caps the requests per second
+	// to the accrual system across all of them, zero leaves them unlimited until it answers with a rate limit.
+	AccrualWorkers   int     `arg:"--accrual-workers,env:ACCRUAL_WORKERS"`
+	AccrualRateLimit float64 `arg:"--accrual-rate-limit,env:ACCRUAL_RATE_LIMIT"`
+	AccrualRateBurst int     `arg:"--accrual-rate-burst,env:ACCRUAL_RATE_BURST"`
+
+	// AccrualRecheckWindow is how long after processing an order the accrual system is asked about it again,
+	// so that revised accruals are clawed back. Zero disables re-checks.
+	AccrualRecheckWindow   time.Duration `arg:"--accrual-recheck-window,env:ACCRUAL_RECHECK_WINDOW"`
+	AccrualRecheckInterval time.Duration `arg:"--accrual-recheck-interval,env:ACCRUAL_RECHECK_INTERVAL"`
+
+	// AccrualStuckAttempts is how many checks in a row with the same answer, and AccrualStuckAge how long
+	// waiting on the accrual system, an order gets before it's marked STUCK for an admin to requeue. Zero
+	// disables the limit.
+	AccrualStuckAttempts int32         `arg:"--accrual-stuck-attempts,env:ACCRUAL_STUCK_ATTEMPTS"`
+	AccrualStuckAge      time.Duration `arg:"--accrual-stuck-age,env:ACCRUAL_STUCK_AGE"`
+
+	// PointsTTLMonths is how many months after they're credited unspent points expire. Zero disables expiry.
+	PointsTTLMonths           int           `arg:"--points-ttl-months,env:POINTS_TTL_MONTHS"`
+	PointsExpiringSoonWindow  time.Duration `arg:"--points-expiring-soon-window,env:POINTS_EXPIRING_SOON_WINDOW"`
+	PointsExpirySweepInterval time.Duration `arg:"--points-expiry-sweep-interval,env:POINTS_EXPIRY_SWEEP_INTERVAL"`
 }
 
 func NewServer() *Server {
 	return &Server{
-		Address:        "localhost:8080",
-		DSN:            "",
-		AccrualAddress: "",
-		Secret:         "",
-		LogLevel:       slog.LevelInfo,
+		Address:         "localhost:8080",
+		DSN:             "",
+		AccrualAddress:  "",
+		Secret:          "",
+		JWTKeyFiles:     nil,
+		JWTSigningKeyID: "",
+		AccessTokenTTL:  15 * time.Minute,    //nolint: mnd //fine
+		RefreshTokenTTL: 30 * 24 * time.Hour, //nolint: mnd //fine
+		LogLevel:        slog.LevelInfo,
+		AdminToken:      "",
+
+		CookieSecure:   false,
+		CookieSameSite: CookieSameSiteLax,
+		CookieDomain:   "",
+		CookieMaxAge:   0,
+
+		LoginMaxFailures:        5,                //nolint: mnd //fine
+		LoginMaxAddressFailures: 50,               //nolint: mnd //fine
+		LoginFailureWindow:      15 * time.Minute, //nolint: mnd //fine
+		LoginLockoutDuration:    15 * time.Minute, //nolint: mnd //fine
+		LoginBaseDelay:          time.Second,
+
+		PasswordMinLength:    1,
+		PasswordMaxLength:    256, //nolint: mnd //fine
+		PasswordBreachedList: "",
+		Argon2Memory:         argon2id.DefaultParams.Memory,
+		Argon2Iterations:     argon2id.DefaultParams.Iterations,
+		Argon2Parallelism:    argon2id.DefaultParams.Parallelism,
+
+		TOTPEncryptionKey:     "",
+		TOTPIssuer:            "Gophermart",
+		MFAChallengeTTL:       5 * time.Minute, //nolint: mnd //fine
+		WithdrawTOTPRequired:  false,
+		WithdrawTOTPThreshold: decimal.Zero,
+
+		WithdrawAllowOrderCollision: false,
+
+		HoldTTL:           15 * time.Minute, //nolint: mnd //fine
+		HoldMaxTTL:        24 * time.Hour,   //nolint: mnd //fine
+		HoldSweepInterval: time.Minute,
+
+		IdempotencyPurgeInterval: time.Hour,
+
+		InstanceID:       "",
+		AccrualLease:     time.Minute,
+		AccrualBatchSize: 100, //nolint: mnd //fine
+
+		AccrualWorkers:   4, //nolint: mnd //fine
+		AccrualRateLimit: 0,
+		AccrualRateBurst: 1,
+
+		AccrualRecheckWindow:   0,
+		AccrualRecheckInterval: time.Hour,
+
+		AccrualStuckAttempts: 100,                //nolint: mnd //fine
+		AccrualStuckAge:      7 * 24 * time.Hour, //nolint: mnd //fine
+
+		PointsTTLMonths:           0,
+		PointsExpiringSoonWindow:  30 * 24 * time.Hour, //nolint: mnd //fine
+		PointsExpirySweepInterval: time.Hour,
 	}
 }
 
@@ -53,6 +185,9 @@ func BuildConfig(args []string, helpOut io.Writer) (*Server, error) {
 		}
 		return nil, fmt.Errorf("parsing arguments: %w", err)
 	}
+	if cfg.CookieSameSite == CookieSameSiteNone && !cfg.CookieSecure {
+		return nil, ErrInsecureSameSiteNone
+	}
 
 	return cfg, nil
 }
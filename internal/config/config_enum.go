@@ -0,0 +1,87 @@
+// Code generated by go-enum DO NOT EDIT.
+// Version: v0.9.2
+
+// Built By: go install
+
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// CookieSameSiteDefault is a CookieSameSite of type Default.
+	CookieSameSiteDefault CookieSameSite = iota
+	// CookieSameSiteLax is a CookieSameSite of type Lax.
+	CookieSameSiteLax
+	// CookieSameSiteStrict is a CookieSameSite of type Strict.
+	CookieSameSiteStrict
+	// CookieSameSiteNone is a CookieSameSite of type None.
+	CookieSameSiteNone
+)
+
+var ErrInvalidCookieSameSite = errors.New("not a valid CookieSameSite")
+
+const _CookieSameSiteName = "defaultlaxstrictnone"
+
+var _CookieSameSiteMap = map[CookieSameSite]string{
+	CookieSameSiteDefault: _CookieSameSiteName[0:7],
+	CookieSameSiteLax:     _CookieSameSiteName[7:10],
+	CookieSameSiteStrict:  _CookieSameSiteName[10:16],
+	CookieSameSiteNone:    _CookieSameSiteName[16:20],
+}
+
+// String implements the Stringer interface.
+func (x CookieSameSite) String() string {
+	if str, ok := _CookieSameSiteMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("CookieSameSite(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x CookieSameSite) IsValid() bool {
+	_, ok := _CookieSameSiteMap[x]
+	return ok
+}
+
+var _CookieSameSiteValue = map[string]CookieSameSite{
+	_CookieSameSiteName[0:7]:   CookieSameSiteDefault,
+	_CookieSameSiteName[7:10]:  CookieSameSiteLax,
+	_CookieSameSiteName[10:16]: CookieSameSiteStrict,
+	_CookieSameSiteName[16:20]: CookieSameSiteNone,
+}
+
+// ParseCookieSameSite attempts to convert a string to a CookieSameSite.
+func ParseCookieSameSite(name string) (CookieSameSite, error) {
+	if x, ok := _CookieSameSiteValue[name]; ok {
+		return x, nil
+	}
+	return CookieSameSite(0), fmt.Errorf("%s is %w", name, ErrInvalidCookieSameSite)
+}
+
+// MarshalText implements the text marshaller method.
+func (x CookieSameSite) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method.
+func (x *CookieSameSite) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseCookieSameSite(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+// AppendText appends the textual representation of itself to the end of b
+// (allocating a larger slice if necessary) and returns the updated slice.
+//
+// Implementations must not retain b, nor mutate any bytes within b[:len(b)].
+func (x *CookieSameSite) AppendText(b []byte) ([]byte, error) {
+	return append(b, x.String()...), nil
+}
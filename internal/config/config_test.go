@@ -25,11 +25,13 @@ func TestParseConfig(t *testing.T) {
 		want.DSN = "test_uri"
 		want.AccrualAddress = "http://localhost:8082"
 		want.LogLevel = slog.LevelDebug
+		want.JWTKeyFiles = []string{"keys/current.pem", "keys/previous.pem"}
 
 		t.Setenv("RUN_ADDRESS", want.Address)
 		t.Setenv("DATABASE_URI", want.DSN)
 		t.Setenv("ACCRUAL_SYSTEM_ADDRESS", want.AccrualAddress)
 		t.Setenv("LOG_LEVEL", want.LogLevel.String())
+		t.Setenv("JWT_KEY_FILES", "keys/current.pem,keys/previous.pem")
 
 		got, err := config.BuildConfig(nil, nil)
 		require.NoError(t, err)
@@ -79,6 +81,26 @@ func TestParseConfig(t *testing.T) {
 		assert.Equal(t, want, got)
 	})
 
+	t.Run("cookie attributes", func(t *testing.T) {
+		want := config.NewServer()
+		want.CookieSecure = true
+		want.CookieSameSite = config.CookieSameSiteNone
+		want.CookieDomain = "example.com"
+
+		t.Setenv("COOKIE_SECURE", "true")
+		t.Setenv("COOKIE_SAMESITE", "none")
+		t.Setenv("COOKIE_DOMAIN", want.CookieDomain)
+
+		got, err := config.BuildConfig(nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("samesite none requires secure", func(t *testing.T) {
+		_, err := config.BuildConfig([]string{"--cookie-samesite", "none"}, nil)
+		require.ErrorIs(t, err, config.ErrInsecureSameSiteNone)
+	})
+
 	t.Run("get some help", func(t *testing.T) {
 		var buf bytes.Buffer
 		_, err := config.BuildConfig([]string{"-h"}, &buf)
@@ -8,18 +8,167 @@ package database
 import (
 	"context"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/shopspring/decimal"
 )
 
-const getOrdersForProcessing = `-- name: GetOrdersForProcessing :many
-select number, user_id, status, accrual, uploaded_at
+const claimOrdersForProcessing = `-- name: ClaimOrdersForProcessing :many
+with claimable as (
+    select number
+    from orders
+    where status in ('NEW','PROCESSING')
+        and next_attempt_at <= now()
+        and (lease_until is null or lease_until < now())
+    order by next_attempt_at asc
+    limit $1
+    for update skip locked
+)
+update orders o
+set claimed_by = $2::text,
+    lease_until = now() + make_interval(secs => $3::float8)
+from claimable c
+where o.number = c.number
+returning o.number, o.user_id, o.status, o.accrual, o.uploaded_at, o.checked_at, o.processed_at, o.claimed_by,
+    o.lease_until, o.attempts, o.next_attempt_at, o.queued_at, o.stuck_at
+`
+
+type ClaimOrdersForProcessingParams struct {
+	RowLimit     int32
+	ClaimedBy    string
+	LeaseSeconds float64
+}
+
+func (q *Queries) ClaimOrdersForProcessing(ctx context.Context, arg ClaimOrdersForProcessingParams) ([]Order, error) {
+	rows, err := q.db.Query(ctx, claimOrdersForProcessing, arg.RowLimit, arg.ClaimedBy, arg.LeaseSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Order
+	for rows.Next() {
+		var i Order
+		if err := rows.Scan(
+			&i.Number,
+			&i.UserID,
+			&i.Status,
+			&i.Accrual,
+			&i.UploadedAt,
+			&i.CheckedAt,
+			&i.ProcessedAt,
+			&i.ClaimedBy,
+			&i.LeaseUntil,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.QueuedAt,
+			&i.StuckAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimOrdersForRecheck = `-- name: ClaimOrdersForRecheck :many
+with claimable as (
+    select number
+    from orders
+    where status = 'PROCESSED'
+        and processed_at >= $1
+        and (checked_at is null or checked_at < $2)
+    order by checked_at asc nulls first
+    limit $3
+    for update skip locked
+)
+update orders o
+set checked_at = now()
+from claimable c
+where o.number = c.number
+returning o.number, o.user_id, o.status, o.accrual, o.uploaded_at, o.checked_at, o.processed_at, o.claimed_by,
+    o.lease_until, o.attempts, o.next_attempt_at, o.queued_at, o.stuck_at
+`
+
+type ClaimOrdersForRecheckParams struct {
+	ProcessedAfter pgtype.Timestamptz
+	CheckedBefore  pgtype.Timestamptz
+	RowLimit       int32
+}
+
+// The check is recorded as the orders are claimed, so other replicas skip them until they're due again.
+func (q *Queries) ClaimOrdersForRecheck(ctx context.Context, arg ClaimOrdersForRecheckParams) ([]Order, error) {
+	rows, err := q.db.Query(ctx, claimOrdersForRecheck, arg.ProcessedAfter, arg.CheckedBefore, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Order
+	for rows.Next() {
+		var i Order
+		if err := rows.Scan(
+			&i.Number,
+			&i.UserID,
+			&i.Status,
+			&i.Accrual,
+			&i.UploadedAt,
+			&i.CheckedAt,
+			&i.ProcessedAt,
+			&i.ClaimedBy,
+			&i.LeaseUntil,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.QueuedAt,
+			&i.StuckAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getProcessedOrderForUpdate = `-- name: GetProcessedOrderForUpdate :one
+select user_id, accrual
 from orders
-where status in ('NEW','PROCESSING')
-order by uploaded_at asc
+where number = $1
+    and status = 'PROCESSED'
+for update
 `
 
-func (q *Queries) GetOrdersForProcessing(ctx context.Context) ([]Order, error) {
-	rows, err := q.db.Query(ctx, getOrdersForProcessing)
+type GetProcessedOrderForUpdateRow struct {
+	UserID  uuid.UUID
+	Accrual decimal.Decimal
+}
+
+func (q *Queries) GetProcessedOrderForUpdate(ctx context.Context, number string) (GetProcessedOrderForUpdateRow, error) {
+	row := q.db.QueryRow(ctx, getProcessedOrderForUpdate, number)
+	var i GetProcessedOrderForUpdateRow
+	err := row.Scan(&i.UserID, &i.Accrual)
+	return i, err
+}
+
+const getStuckOrders = `-- name: GetStuckOrders :many
+select number, user_id, status, accrual, uploaded_at, checked_at, processed_at, claimed_by, lease_until, attempts,
+    next_attempt_at, queued_at, stuck_at
+from orders
+where status = 'STUCK'
+order by stuck_at, number
+limit $1 offset $2
+`
+
+type GetStuckOrdersParams struct {
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) GetStuckOrders(ctx context.Context, arg GetStuckOrdersParams) ([]Order, error) {
+	rows, err := q.db.Query(ctx, getStuckOrders, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -33,6 +182,14 @@ func (q *Queries) GetOrdersForProcessing(ctx context.Context) ([]Order, error) {
 			&i.Status,
 			&i.Accrual,
 			&i.UploadedAt,
+			&i.CheckedAt,
+			&i.ProcessedAt,
+			&i.ClaimedBy,
+			&i.LeaseUntil,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.QueuedAt,
+			&i.StuckAt,
 		); err != nil {
 			return nil, err
 		}
@@ -44,20 +201,205 @@ func (q *Queries) GetOrdersForProcessing(ctx context.Context) ([]Order, error) {
 	return items, nil
 }
 
-const updateOrderStatus = `-- name: UpdateOrderStatus :exec
+const markOrderChecked = `-- name: MarkOrderChecked :exec
+update orders
+set checked_at = now(),
+    attempts = attempts + 1,
+    next_attempt_at = now() + make_interval(secs => least(
+        $1::float8 * power(2, least(attempts, 30)),
+        $2::float8
+    )),
+    claimed_by = null,
+    lease_until = null
+where number = $3
+    and claimed_by = $4::text
+    and status in ('NEW','PROCESSING')
+`
+
+type MarkOrderCheckedParams struct {
+	RetryBaseSeconds float64
+	RetryMaxSeconds  float64
+	Number           string
+	ClaimedBy        string
+}
+
+func (q *Queries) MarkOrderChecked(ctx context.Context, arg MarkOrderCheckedParams) error {
+	_, err := q.db.Exec(ctx, markOrderChecked,
+		arg.RetryBaseSeconds,
+		arg.RetryMaxSeconds,
+		arg.Number,
+		arg.ClaimedBy,
+	)
+	return err
+}
+
+const markOrdersStuck = `-- name: MarkOrdersStuck :execrows
+update orders
+set status = 'STUCK',
+    stuck_at = now()
+where status in ('NEW','PROCESSING')
+    and (lease_until is null or lease_until < now())
+    and (
+        ($1::integer > 0 and attempts >= $1::integer)
+        or queued_at < $2
+    )
+`
+
+type MarkOrdersStuckParams struct {
+	MaxAttempts  int32
+	QueuedBefore pgtype.Timestamptz
+}
+
+func (q *Queries) MarkOrdersStuck(ctx context.Context, arg MarkOrdersStuckParams) (int64, error) {
+	result, err := q.db.Exec(ctx, markOrdersStuck, arg.MaxAttempts, arg.QueuedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const postponeOrder = `-- name: PostponeOrder :exec
+update orders
+set attempts = attempts + 1,
+    next_attempt_at = now() + make_interval(secs => least(
+        $1::float8 * power(2, least(attempts, 30)),
+        $2::float8
+    )),
+    claimed_by = null,
+    lease_until = null
+where number = $3
+    and claimed_by = $4::text
+    and status in ('NEW','PROCESSING')
+`
+
+type PostponeOrderParams struct {
+	RetryBaseSeconds float64
+	RetryMaxSeconds  float64
+	Number           string
+	ClaimedBy        string
+}
+
+func (q *Queries) PostponeOrder(ctx context.Context, arg PostponeOrderParams) error {
+	_, err := q.db.Exec(ctx, postponeOrder,
+		arg.RetryBaseSeconds,
+		arg.RetryMaxSeconds,
+		arg.Number,
+		arg.ClaimedBy,
+	)
+	return err
+}
+
+const renewOrderLeases = `-- name: RenewOrderLeases :execrows
+update orders
+set lease_until = now() + make_interval(secs => $1::float8)
+where number = any($2::text[])
+    and claimed_by = $3::text
+    and status in ('NEW','PROCESSING')
+`
+
+type RenewOrderLeasesParams struct {
+	LeaseSeconds float64
+	Numbers      []string
+	ClaimedBy    string
+}
+
+func (q *Queries) RenewOrderLeases(ctx context.Context, arg RenewOrderLeasesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, renewOrderLeases, arg.LeaseSeconds, arg.Numbers, arg.ClaimedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const requeueOrder = `-- name: RequeueOrder :one
+update orders
+set status = 'PROCESSING',
+    attempts = 0,
+    next_attempt_at = now(),
+    queued_at = now(),
+    stuck_at = null
+where number = $1
+    and status = 'STUCK'
+returning number, user_id, status, accrual, uploaded_at, checked_at, processed_at, claimed_by, lease_until, attempts,
+    next_attempt_at, queued_at, stuck_at
+`
+
+func (q *Queries) RequeueOrder(ctx context.Context, number string) (Order, error) {
+	row := q.db.QueryRow(ctx, requeueOrder, number)
+	var i Order
+	err := row.Scan(
+		&i.Number,
+		&i.UserID,
+		&i.Status,
+		&i.Accrual,
+		&i.UploadedAt,
+		&i.CheckedAt,
+		&i.ProcessedAt,
+		&i.ClaimedBy,
+		&i.LeaseUntil,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.QueuedAt,
+		&i.StuckAt,
+	)
+	return i, err
+}
+
+const reviseOrder = `-- name: ReviseOrder :exec
 update orders
 set status = $2,
-    accrual = $3
+    accrual = $3,
+    checked_at = now()
 where number = $1
 `
 
-type UpdateOrderStatusParams struct {
+type ReviseOrderParams struct {
 	Number  string
 	Status  string
 	Accrual decimal.Decimal
 }
 
-func (q *Queries) UpdateOrderStatus(ctx context.Context, arg UpdateOrderStatusParams) error {
-	_, err := q.db.Exec(ctx, updateOrderStatus, arg.Number, arg.Status, arg.Accrual)
+func (q *Queries) ReviseOrder(ctx context.Context, arg ReviseOrderParams) error {
+	_, err := q.db.Exec(ctx, reviseOrder, arg.Number, arg.Status, arg.Accrual)
 	return err
 }
+
+const updateOrderStatus = `-- name: UpdateOrderStatus :one
+update orders
+set status = $1,
+    accrual = $2,
+    checked_at = now(),
+    processed_at = case when $1 = 'PROCESSED' then now() end,
+    attempts = case when status = $1 then attempts + 1 else 1 end,
+    next_attempt_at = now() + make_interval(secs => least(
+        $3::float8 * power(2, least(case when status = $1 then attempts else 0 end, 30)),
+        $4::float8
+    )),
+    claimed_by = null,
+    lease_until = null
+where number = $5
+    and status in ('NEW','PROCESSING')
+returning user_id
+`
+
+type UpdateOrderStatusParams struct {
+	Status           string
+	Accrual          decimal.Decimal
+	RetryBaseSeconds float64
+	RetryMaxSeconds  float64
+	Number           string
+}
+
+// The retry schedule starts over when the status changes.
+func (q *Queries) UpdateOrderStatus(ctx context.Context, arg UpdateOrderStatusParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, updateOrderStatus,
+		arg.Status,
+		arg.Accrual,
+		arg.RetryBaseSeconds,
+		arg.RetryMaxSeconds,
+		arg.Number,
+	)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
@@ -8,15 +8,134 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/shopspring/decimal"
 )
 
-type Order struct {
-	Number     string
+type Adjustment struct {
+	ID         uuid.UUID
 	UserID     uuid.UUID
-	Status     string
-	Accrual    decimal.Decimal
-	UploadedAt time.Time
+	Amount     decimal.Decimal
+	Reason     string
+	OperatorID pgtype.UUID
+	CreatedAt  time.Time
+}
+
+type ApiKey struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt pgtype.Timestamptz
+	RevokedAt  pgtype.Timestamptz
+}
+
+type Balance struct {
+	UserID    uuid.UUID
+	Current   decimal.Decimal
+	Withdrawn decimal.Decimal
+	UpdatedAt time.Time
+}
+
+type IdempotencyKey struct {
+	UserID      uuid.UUID
+	Key         string
+	Fingerprint string
+	StatusCode  pgtype.Int4
+	ContentType pgtype.Text
+	Body        []byte
+	CreatedAt   time.Time
+	LockedUntil pgtype.Timestamptz
+}
+
+type LedgerEntry struct {
+	ID           int64
+	UserID       uuid.UUID
+	Kind         string
+	Amount       decimal.Decimal
+	OrderNumber  pgtype.Text
+	AdjustmentID pgtype.UUID
+	CreatedAt    time.Time
+	ReversalID   pgtype.UUID
+	BalanceAfter decimal.Decimal
+}
+
+type LoginAttempt struct {
+	Scope         string
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   pgtype.Timestamptz
+}
+
+type MfaChallenge struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type Order struct {
+	Number        string
+	UserID        uuid.UUID
+	Status        string
+	Accrual       decimal.Decimal
+	UploadedAt    time.Time
+	CheckedAt     pgtype.Timestamptz
+	ProcessedAt   pgtype.Timestamptz
+	ClaimedBy     pgtype.Text
+	LeaseUntil    pgtype.Timestamptz
+	Attempts      int32
+	NextAttemptAt time.Time
+	QueuedAt      time.Time
+	StuckAt       pgtype.Timestamptz
+}
+
+type PointLot struct {
+	ID            int64
+	UserID        uuid.UUID
+	LedgerEntryID pgtype.Int8
+	Amount        decimal.Decimal
+	Remaining     decimal.Decimal
+	CreatedAt     time.Time
+}
+
+type PointLotConsumption struct {
+	LotID         int64
+	LedgerEntryID int64
+	Amount        decimal.Decimal
+}
+
+type RefreshToken struct {
+	TokenHash string
+	SessionID uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    pgtype.Timestamptz
+	CreatedAt time.Time
+}
+
+type Session struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	RevokedAt pgtype.Timestamptz
+}
+
+type TotpCredential struct {
+	UserID       uuid.UUID
+	Secret       []byte
+	LastUsedStep int64
+	ConfirmedAt  pgtype.Timestamptz
+	CreatedAt    time.Time
+}
+
+type TotpRecoveryCode struct {
+	UserID   uuid.UUID
+	CodeHash string
+	UsedAt   pgtype.Timestamptz
 }
 
 type User struct {
@@ -24,6 +143,8 @@ type User struct {
 	Login        string
 	PasswordHash string
 	CreatedAt    time.Time
+	Role         string
+	BlockedAt    pgtype.Timestamptz
 }
 
 type Withdrawal struct {
@@ -32,4 +153,28 @@ type Withdrawal struct {
 	OrderNumber string
 	Sum         decimal.Decimal
 	ProcessedAt time.Time
+	DuplicateOf pgtype.UUID
+	Reversed    decimal.Decimal
+}
+
+type WithdrawalHold struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	OrderNumber  string
+	Sum          decimal.Decimal
+	Status       string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+	SettledAt    pgtype.Timestamptz
+	WithdrawalID pgtype.UUID
+}
+
+type WithdrawalReversal struct {
+	ID           uuid.UUID
+	WithdrawalID uuid.UUID
+	Amount       decimal.Decimal
+	Reason       string
+	Reference    pgtype.Text
+	OperatorID   pgtype.UUID
+	CreatedAt    time.Time
 }
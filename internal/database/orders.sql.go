@@ -10,9 +10,26 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/shopspring/decimal"
 )
 
+const acquireOrderNumberLocks = `-- name: AcquireOrderNumberLocks :exec
+select pg_advisory_xact_lock(hashtextextended('order:' || n.number, 0))
+from (
+    select number
+    from unnest($1::text[]) as number
+    order by number
+) n
+`
+
+// Serializes uploads and withdrawals of the same order numbers. Locks are taken in order so that transactions
+// locking overlapping batches don't deadlock.
+func (q *Queries) AcquireOrderNumberLocks(ctx context.Context, numbers []string) error {
+	_, err := q.db.Exec(ctx, acquireOrderNumberLocks, numbers)
+	return err
+}
+
 const acquireUserLock = `-- name: AcquireUserLock :exec
 select pg_advisory_xact_lock(hashtextextended($1::uuid::text, 0))
 `
@@ -23,33 +40,56 @@ func (q *Queries) AcquireUserLock(ctx context.Context, userID uuid.UUID) error {
 }
 
 const getBalance = `-- name: GetBalance :one
-with
-accr as (
-    select coalesce(sum(o.accrual), 0::numeric(12,2)) as total
-    from orders o
-    where o.user_id = $1
-        and o.status = 'PROCESSED'
-),
-wd as (
-    select coalesce(sum(w.sum), 0::numeric(12,2)) as total
-    from withdrawals w
-    where w.user_id = $1
-)
-select
-    (accr.total - wd.total)::numeric(12,2) as current,
-    wd.total::numeric(12,2) as withdrawn
-from accr, wd
+select b.current, b.withdrawn,
+    (
+        select coalesce(sum(h.sum), 0)
+        from withdrawal_holds h
+        where h.user_id = b.user_id
+            and h.status = 'held'
+            and h.expires_at > now()
+    )::numeric(12,2) as held
+from balances b
+where b.user_id = $1
 `
 
 type GetBalanceRow struct {
 	Current   decimal.Decimal
 	Withdrawn decimal.Decimal
+	Held      decimal.Decimal
 }
 
 func (q *Queries) GetBalance(ctx context.Context, userID uuid.UUID) (GetBalanceRow, error) {
 	row := q.db.QueryRow(ctx, getBalance, userID)
 	var i GetBalanceRow
-	err := row.Scan(&i.Current, &i.Withdrawn)
+	err := row.Scan(&i.Current, &i.Withdrawn, &i.Held)
+	return i, err
+}
+
+const getOrder = `-- name: GetOrder :one
+select number, user_id, status, accrual, uploaded_at, checked_at, processed_at, claimed_by, lease_until, attempts,
+    next_attempt_at, queued_at, stuck_at
+from orders
+where number = $1
+`
+
+func (q *Queries) GetOrder(ctx context.Context, number string) (Order, error) {
+	row := q.db.QueryRow(ctx, getOrder, number)
+	var i Order
+	err := row.Scan(
+		&i.Number,
+		&i.UserID,
+		&i.Status,
+		&i.Accrual,
+		&i.UploadedAt,
+		&i.CheckedAt,
+		&i.ProcessedAt,
+		&i.ClaimedBy,
+		&i.LeaseUntil,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.QueuedAt,
+		&i.StuckAt,
+	)
 	return i, err
 }
 
@@ -66,29 +106,145 @@ func (q *Queries) GetOrderOwner(ctx context.Context, number string) (uuid.UUID,
 	return user_id, err
 }
 
-const getOrders = `-- name: GetOrders :many
+const getOrderOwners = `-- name: GetOrderOwners :many
+select number, user_id
+from orders
+where number = any($1::text[])
+`
+
+type GetOrderOwnersRow struct {
+	Number string
+	UserID uuid.UUID
+}
+
+func (q *Queries) GetOrderOwners(ctx context.Context, numbers []string) ([]GetOrderOwnersRow, error) {
+	rows, err := q.db.Query(ctx, getOrderOwners, numbers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOrderOwnersRow
+	for rows.Next() {
+		var i GetOrderOwnersRow
+		if err := rows.Scan(&i.Number, &i.UserID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOrdersAsc = `-- name: GetOrdersAsc :many
+select number, status, accrual, uploaded_at
+from orders
+where user_id = $1
+    and (cardinality($2::text[]) = 0 or status = any($2::text[]))
+    and uploaded_at >= coalesce($3::timestamptz, '-infinity')
+    and uploaded_at < coalesce($4::timestamptz, 'infinity')
+    and (uploaded_at, number) > (coalesce($5::timestamptz, '-infinity'), $6::text)
+order by uploaded_at asc, number asc
+limit $7::int
+`
+
+type GetOrdersAscParams struct {
+	UserID      uuid.UUID
+	Statuses    []string
+	FromTime    pgtype.Timestamptz
+	ToTime      pgtype.Timestamptz
+	AfterTime   pgtype.Timestamptz
+	AfterNumber string
+	RowLimit    pgtype.Int4
+}
+
+type GetOrdersAscRow struct {
+	Number     string
+	Status     string
+	Accrual    decimal.Decimal
+	UploadedAt time.Time
+}
+
+func (q *Queries) GetOrdersAsc(ctx context.Context, arg GetOrdersAscParams) ([]GetOrdersAscRow, error) {
+	rows, err := q.db.Query(ctx, getOrdersAsc,
+		arg.UserID,
+		arg.Statuses,
+		arg.FromTime,
+		arg.ToTime,
+		arg.AfterTime,
+		arg.AfterNumber,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOrdersAscRow
+	for rows.Next() {
+		var i GetOrdersAscRow
+		if err := rows.Scan(
+			&i.Number,
+			&i.Status,
+			&i.Accrual,
+			&i.UploadedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOrdersDesc = `-- name: GetOrdersDesc :many
 select number, status, accrual, uploaded_at
 from orders
 where user_id = $1
-order by uploaded_at desc
+    and (cardinality($2::text[]) = 0 or status = any($2::text[]))
+    and uploaded_at >= coalesce($3::timestamptz, '-infinity')
+    and uploaded_at < coalesce($4::timestamptz, 'infinity')
+    and (uploaded_at, number) < (coalesce($5::timestamptz, 'infinity'), $6::text)
+order by uploaded_at desc, number desc
+limit $7::int
 `
 
-type GetOrdersRow struct {
+type GetOrdersDescParams struct {
+	UserID      uuid.UUID
+	Statuses    []string
+	FromTime    pgtype.Timestamptz
+	ToTime      pgtype.Timestamptz
+	AfterTime   pgtype.Timestamptz
+	AfterNumber string
+	RowLimit    pgtype.Int4
+}
+
+type GetOrdersDescRow struct {
 	Number     string
 	Status     string
 	Accrual    decimal.Decimal
 	UploadedAt time.Time
 }
 
-func (q *Queries) GetOrders(ctx context.Context, userID uuid.UUID) ([]GetOrdersRow, error) {
-	rows, err := q.db.Query(ctx, getOrders, userID)
+func (q *Queries) GetOrdersDesc(ctx context.Context, arg GetOrdersDescParams) ([]GetOrdersDescRow, error) {
+	rows, err := q.db.Query(ctx, getOrdersDesc,
+		arg.UserID,
+		arg.Statuses,
+		arg.FromTime,
+		arg.ToTime,
+		arg.AfterTime,
+		arg.AfterNumber,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetOrdersRow
+	var items []GetOrdersDescRow
 	for rows.Next() {
-		var i GetOrdersRow
+		var i GetOrdersDescRow
 		if err := rows.Scan(
 			&i.Number,
 			&i.Status,
@@ -105,29 +261,118 @@ func (q *Queries) GetOrders(ctx context.Context, userID uuid.UUID) ([]GetOrdersR
 	return items, nil
 }
 
-const getWithdrawals = `-- name: GetWithdrawals :many
-select order_number, sum, processed_at
+const getWithdrawalsAsc = `-- name: GetWithdrawalsAsc :many
+select id, order_number, sum, processed_at, reversed
 from withdrawals
 where user_id = $1
-order by processed_at desc
+    and processed_at >= coalesce($2::timestamptz, '-infinity')
+    and processed_at < coalesce($3::timestamptz, 'infinity')
+    and (processed_at, id) > (coalesce($4::timestamptz, '-infinity'), $5::uuid)
+order by processed_at asc, id asc
+limit $6::int
 `
 
-type GetWithdrawalsRow struct {
+type GetWithdrawalsAscParams struct {
+	UserID    uuid.UUID
+	FromTime  pgtype.Timestamptz
+	ToTime    pgtype.Timestamptz
+	AfterTime pgtype.Timestamptz
+	AfterID   uuid.UUID
+	RowLimit  pgtype.Int4
+}
+
+type GetWithdrawalsAscRow struct {
+	ID          uuid.UUID
 	OrderNumber string
 	Sum         decimal.Decimal
 	ProcessedAt time.Time
+	Reversed    decimal.Decimal
 }
 
-func (q *Queries) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]GetWithdrawalsRow, error) {
-	rows, err := q.db.Query(ctx, getWithdrawals, userID)
+func (q *Queries) GetWithdrawalsAsc(ctx context.Context, arg GetWithdrawalsAscParams) ([]GetWithdrawalsAscRow, error) {
+	rows, err := q.db.Query(ctx, getWithdrawalsAsc,
+		arg.UserID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.AfterTime,
+		arg.AfterID,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetWithdrawalsRow
+	var items []GetWithdrawalsAscRow
 	for rows.Next() {
-		var i GetWithdrawalsRow
-		if err := rows.Scan(&i.OrderNumber, &i.Sum, &i.ProcessedAt); err != nil {
+		var i GetWithdrawalsAscRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrderNumber,
+			&i.Sum,
+			&i.ProcessedAt,
+			&i.Reversed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWithdrawalsDesc = `-- name: GetWithdrawalsDesc :many
+select id, order_number, sum, processed_at, reversed
+from withdrawals
+where user_id = $1
+    and processed_at >= coalesce($2::timestamptz, '-infinity')
+    and processed_at < coalesce($3::timestamptz, 'infinity')
+    and (processed_at, id) < (coalesce($4::timestamptz, 'infinity'), $5::uuid)
+order by processed_at desc, id desc
+limit $6::int
+`
+
+type GetWithdrawalsDescParams struct {
+	UserID    uuid.UUID
+	FromTime  pgtype.Timestamptz
+	ToTime    pgtype.Timestamptz
+	AfterTime pgtype.Timestamptz
+	AfterID   uuid.UUID
+	RowLimit  pgtype.Int4
+}
+
+type GetWithdrawalsDescRow struct {
+	ID          uuid.UUID
+	OrderNumber string
+	Sum         decimal.Decimal
+	ProcessedAt time.Time
+	Reversed    decimal.Decimal
+}
+
+func (q *Queries) GetWithdrawalsDesc(ctx context.Context, arg GetWithdrawalsDescParams) ([]GetWithdrawalsDescRow, error) {
+	rows, err := q.db.Query(ctx, getWithdrawalsDesc,
+		arg.UserID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.AfterTime,
+		arg.AfterID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetWithdrawalsDescRow
+	for rows.Next() {
+		var i GetWithdrawalsDescRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrderNumber,
+			&i.Sum,
+			&i.ProcessedAt,
+			&i.Reversed,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -164,9 +409,42 @@ func (q *Queries) InsertOrder(ctx context.Context, arg InsertOrderParams) (uuid.
 	return user_id, err
 }
 
-const insertWithdrawal = `-- name: InsertWithdrawal :exec
+const insertOrders = `-- name: InsertOrders :many
+insert into orders (number, user_id, status, accrual)
+select unnest($1::text[]), $2::uuid, 'NEW', 0
+on conflict(number) do nothing
+returning number
+`
+
+type InsertOrdersParams struct {
+	Numbers []string
+	UserID  uuid.UUID
+}
+
+func (q *Queries) InsertOrders(ctx context.Context, arg InsertOrdersParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, insertOrders, arg.Numbers, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var number string
+		if err := rows.Scan(&number); err != nil {
+			return nil, err
+		}
+		items = append(items, number)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const insertWithdrawal = `-- name: InsertWithdrawal :one
 insert into withdrawals (user_id, order_number, sum)
 values ($1, $2, $3)
+returning id
 `
 
 type InsertWithdrawalParams struct {
@@ -175,7 +453,27 @@ type InsertWithdrawalParams struct {
 	Sum         decimal.Decimal
 }
 
-func (q *Queries) InsertWithdrawal(ctx context.Context, arg InsertWithdrawalParams) error {
-	_, err := q.db.Exec(ctx, insertWithdrawal, arg.UserID, arg.OrderNumber, arg.Sum)
+func (q *Queries) InsertWithdrawal(ctx context.Context, arg InsertWithdrawalParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, insertWithdrawal, arg.UserID, arg.OrderNumber, arg.Sum)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const listenNewOrders = `-- name: ListenNewOrders :exec
+listen new_orders
+`
+
+func (q *Queries) ListenNewOrders(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, listenNewOrders)
+	return err
+}
+
+const notifyNewOrders = `-- name: NotifyNewOrders :exec
+notify new_orders
+`
+
+func (q *Queries) NotifyNewOrders(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, notifyNewOrders)
 	return err
 }
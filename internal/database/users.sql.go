@@ -7,13 +7,29 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const blockUser = `-- name: BlockUser :execrows
+update users
+set blocked_at = coalesce(blocked_at, now())
+where id = $1
+`
+
+func (q *Queries) BlockUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, blockUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const insertUser = `-- name: InsertUser :one
-insert into users (id, login, password_hash)
-values ($1, $2, $3)
+insert into users (id, login, password_hash, role)
+values ($1, $2, $3, $4)
 returning id
 `
 
@@ -21,17 +37,43 @@ type InsertUserParams struct {
 	ID           uuid.UUID
 	Login        string
 	PasswordHash string
+	Role         string
 }
 
 func (q *Queries) InsertUser(ctx context.Context, arg InsertUserParams) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, insertUser, arg.ID, arg.Login, arg.PasswordHash)
+	row := q.db.QueryRow(ctx, insertUser,
+		arg.ID,
+		arg.Login,
+		arg.PasswordHash,
+		arg.Role,
+	)
 	var id uuid.UUID
 	err := row.Scan(&id)
 	return id, err
 }
 
+const selectUserByID = `-- name: SelectUserByID :one
+select id, login, password_hash, created_at, role, blocked_at
+from users
+where id = $1
+`
+
+func (q *Queries) SelectUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, selectUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Login,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.Role,
+		&i.BlockedAt,
+	)
+	return i, err
+}
+
 const selectUserByLogin = `-- name: SelectUserByLogin :one
-select id, login, password_hash, created_at
+select id, login, password_hash, created_at, role, blocked_at
 from users
 where login = $1
 `
@@ -44,6 +86,108 @@ func (q *Queries) SelectUserByLogin(ctx context.Context, login string) (User, er
 		&i.Login,
 		&i.PasswordHash,
 		&i.CreatedAt,
+		&i.Role,
+		&i.BlockedAt,
 	)
 	return i, err
 }
+
+const selectUsers = `-- name: SelectUsers :many
+select id, login, role, blocked_at, created_at
+from users
+order by created_at, id
+limit $1 offset $2
+`
+
+type SelectUsersParams struct {
+	Limit  int32
+	Offset int32
+}
+
+type SelectUsersRow struct {
+	ID        uuid.UUID
+	Login     string
+	Role      string
+	BlockedAt pgtype.Timestamptz
+	CreatedAt time.Time
+}
+
+func (q *Queries) SelectUsers(ctx context.Context, arg SelectUsersParams) ([]SelectUsersRow, error) {
+	rows, err := q.db.Query(ctx, selectUsers, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SelectUsersRow
+	for rows.Next() {
+		var i SelectUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Login,
+			&i.Role,
+			&i.BlockedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const unblockUser = `-- name: UnblockUser :execrows
+update users
+set blocked_at = null
+where id = $1
+`
+
+func (q *Queries) UnblockUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, unblockUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updatePasswordHash = `-- name: UpdatePasswordHash :execrows
+update users
+set password_hash = $1
+where id = $2
+    and password_hash = $3
+`
+
+type UpdatePasswordHashParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+func (q *Queries) UpdatePasswordHash(ctx context.Context, arg UpdatePasswordHashParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updatePasswordHash, arg.NewHash, arg.ID, arg.OldHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserRole = `-- name: UpdateUserRole :execrows
+update users
+set role = $2
+where id = $1
+`
+
+type UpdateUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserRole, arg.ID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
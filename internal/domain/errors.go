@@ -1,14 +1,75 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	ErrLoginExists        = errors.New("login is taken")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserBlocked        = errors.New("user is blocked")
+
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrSessionRevoked      = errors.New("session revoked")
+	ErrWeakPassword        = errors.New("password does not satisfy policy")
+
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	ErrTOTPUnavailable    = errors.New("totp is not configured")
+	ErrTOTPNotEnabled     = errors.New("totp is not enabled")
+	ErrTOTPAlreadyEnabled = errors.New("totp is already enabled")
+	ErrTOTPRequired       = errors.New("totp code required")
+	ErrInvalidOTP         = errors.New("invalid one-time code")
+	ErrInvalidMFAToken    = errors.New("invalid mfa token")
 
 	ErrMalformedOrderNumber       = errors.New("malformed order number")
 	ErrOrderAlreadyUploadedByUser = errors.New("order already uploaded by user")
 	ErrOrderOwnedByAnotherUser    = errors.New("order owned by another user")
+	ErrOrderNotFound              = errors.New("order not found")
+	ErrOrderNotStuck              = errors.New("order is not stuck")
+
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	ErrIdempotencyKeyReused     = errors.New("idempotency key reused with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is in progress")
 
-	ErrNotEnoughFunds = errors.New("not enough funds")
+	ErrNotEnoughFunds          = errors.New("not enough funds")
+	ErrBalanceInDebt           = errors.New("balance is negative, withdrawals are blocked until it is repaid")
+	ErrWithdrawalOrderUsed     = errors.New("order number already used for a withdrawal")
+	ErrWithdrawalOrderUploaded = errors.New("order number belongs to an uploaded order")
+	ErrInvalidAdjustment       = errors.New("invalid adjustment")
+
+	ErrWithdrawalNotFound        = errors.New("withdrawal not found")
+	ErrWithdrawalReversed        = errors.New("withdrawal already reversed")
+	ErrReversalExceedsWithdrawal = errors.New("reversal exceeds the rest of the withdrawal")
+	ErrInvalidReversal           = errors.New("invalid reversal")
+	ErrSelfReversal              = errors.New("operators can't reverse their own withdrawals")
+
+	ErrHoldNotFound   = errors.New("hold not found")
+	ErrHoldExpired    = errors.New("hold expired")
+	ErrHoldSettled    = errors.New("hold already settled")
+	ErrInvalidHoldTTL = errors.New("invalid hold expiry")
 )
+
+// LoginThrottledError is returned when a login is attempted too soon after a failed one.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e LoginThrottledError) Error() string {
+	return fmt.Sprintf("login throttled, retry after %s", e.RetryAfter)
+}
+
+// AccountLockedError is returned when a login is temporarily locked after too many failures.
+type AccountLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e AccountLockedError) Error() string {
+	return fmt.Sprintf("account locked, retry after %s", e.RetryAfter)
+}
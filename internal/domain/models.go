@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,30 +9,168 @@ import (
 )
 
 type User struct {
-	ID    uuid.UUID
-	Login string
+	ID        uuid.UUID
+	Login     string
+	Role      UserRole
+	Blocked   bool
+	CreatedAt time.Time
 }
 
 func NewUser(login string) User {
 	return User{
-		ID:    uuid.New(),
-		Login: login,
+		ID:        uuid.New(),
+		Login:     login,
+		Role:      UserRoleUser,
+		Blocked:   false,
+		CreatedAt: time.Time{},
 	}
 }
 
-type Order struct {
-	Number     OrderNumber
-	Status     OrderStatus
+// UserRole ENUM(user, support, admin).
+type UserRole int //nolint: recvcheck //fine
+
+// Session is a login of a user. Role is the user's role when the session was started or last refreshed.
+type Session struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Role      UserRole
+	ExpiresAt time.Time
+}
+
+func NewSession(userID uuid.UUID, role UserRole, expiresAt time.Time) Session {
+	return Session{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Role:      role,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// APIKey is a long-lived credential for machine clients acting on behalf of a user.
+// Only the key's hash is persisted; Prefix identifies the key to its owner.
+type APIKey struct {
+	ID         uuid.UUID
 	UserID     uuid.UUID
-	Accrual    decimal.Decimal
-	UploadedAt time.Time
+	Name       string
+	Prefix     string
+	Scopes     []APIKeyScope
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+func NewAPIKey(userID uuid.UUID, name string, prefix string, scopes []APIKeyScope) APIKey {
+	return APIKey{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Name:       name,
+		Prefix:     prefix,
+		Scopes:     scopes,
+		CreatedAt:  time.Time{},
+		LastUsedAt: time.Time{},
+	}
+}
+
+func (k APIKey) HasScope(scope APIKeyScope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// TOTPCredential is a user's authenticator enrollment. Secret is encrypted.
+type TOTPCredential struct {
+	Secret       []byte
+	LastUsedStep int64
+	Confirmed    bool
+}
+
+// APIKeyScope ENUM(read_orders, upload_orders, read_balance, withdraw).
+type APIKeyScope int //nolint: recvcheck //fine
+
+// LoginAttemptScope ENUM(login, address).
+type LoginAttemptScope int //nolint: recvcheck //fine
+
+// LoginAttempts tracks recent failed logins for a single login or client address.
+type LoginAttempts struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// LoginAttemptReservation counts an attempt as failed before the credentials are checked. Failures before
+// WindowStart are forgotten, reaching Limit locks the key until LockUntil. With SeenFailures set, the attempt is
+// only reserved if no other one was since the failures were read.
+type LoginAttemptReservation struct {
+	Scope        LoginAttemptScope
+	Key          string
+	SeenFailures *int
+	Limit        int
+	Now          time.Time
+	WindowStart  time.Time
+	LockUntil    time.Time
 }
 
-// OrderStatus ENUM(NEW, PROCESSING, INVALID, PROCESSED).
+// Order is an uploaded purchase. CheckedAt is the last time the accrual system was asked about it,
+// zero if never. A pending order is asked about again at NextAttemptAt, Attempts counts the checks since
+// its status last changed.
+type Order struct {
+	Number        OrderNumber
+	Status        OrderStatus
+	UserID        uuid.UUID
+	Accrual       decimal.Decimal
+	UploadedAt    time.Time
+	CheckedAt     time.Time
+	Attempts      int32
+	NextAttemptAt time.Time
+	// StuckAt is when the order was given up on, zero unless it is STUCK.
+	StuckAt time.Time
+}
+
+// Backoff spaces out checks of an order that keeps getting the same answer: the n-th retry waits Base*2^(n-1),
+// but never longer than Max. A zero Backoff retries right away.
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// ListFilter selects a page of a user's orders or withdrawals, newest first unless Ascending.
+// Zero values mean no bound and a zero Limit returns everything. Statuses only applies to orders.
+type ListFilter struct {
+	Statuses  []OrderStatus
+	From      time.Time
+	To        time.Time
+	Ascending bool
+	After     ListCursor
+	Limit     int32
+}
+
+// ListCursor is the position of the last item of the previous page: its time and its order number or ID.
+type ListCursor struct {
+	Time time.Time
+	Key  string
+}
+
+// OrderStatus ENUM(NEW, PROCESSING, INVALID, PROCESSED, STUCK).
+// STUCK orders gave up waiting on the accrual system, until an admin requeues them. It isn't part of
+// the specification, users see them as PROCESSING.
 type OrderStatus int //nolint: recvcheck //fine
 
+// Public is the status as the specification knows it.
+func (x OrderStatus) Public() OrderStatus {
+	if x == OrderStatusSTUCK {
+		return OrderStatusPROCESSING
+	}
+	return x
+}
+
 type OrderNumber string
 
+// OrderUploadResult ENUM(accepted, duplicate_own, owned_by_other, used_for_withdrawal, malformed).
+type OrderUploadResult int //nolint: recvcheck //fine
+
+// OrderUpload is the outcome of uploading one order number of a batch.
+type OrderUpload struct {
+	Number string
+	Result OrderUploadResult
+}
+
 func NewOrderNumber(s string) (OrderNumber, error) {
 	if !ValidLuhn(s) {
 		return "", ErrMalformedOrderNumber
@@ -71,13 +210,214 @@ func ValidLuhn(s string) bool {
 	return sum%10 == 0
 }
 
+// Balance is what the user can spend and has spent. Current already excludes Held, the sum of active holds.
+// Current goes negative when an accrual is clawed back after it has been spent. ExpiringSoon is set only
+// when points expire.
 type Balance struct {
-	Current   decimal.Decimal
-	Withdrawn decimal.Decimal
+	Current      decimal.Decimal
+	Withdrawn    decimal.Decimal
+	Held         decimal.Decimal
+	ExpiringSoon []ExpiringPoints
 }
 
+// PointLot is a credit of points. Debits consume lots oldest first, Remaining is what is left of the lot.
+// Whatever remains of a lot expires together with it.
+type PointLot struct {
+	ID        int64
+	UserID    uuid.UUID
+	Amount    decimal.Decimal
+	Remaining decimal.Decimal
+	CreatedAt time.Time
+}
+
+// ExpiresAt is when the lot expires if points expire ttlMonths after they're credited.
+func (l PointLot) ExpiresAt(ttlMonths int) time.Time {
+	return l.CreatedAt.AddDate(0, ttlMonths, 0)
+}
+
+// ExpiringPoints is a part of the balance that expires at ExpiresAt unless it's spent before.
+type ExpiringPoints struct {
+	Sum       decimal.Decimal
+	ExpiresAt time.Time
+}
+
+// NewExpiringPoints tells how much of the lots, oldest first, expires and when. Held points are taken out of
+// the oldest lots as they'll be the first consumed.
+func NewExpiringPoints(lots []PointLot, held decimal.Decimal, ttlMonths int) []ExpiringPoints {
+	var points []ExpiringPoints
+	for _, lot := range lots {
+		sum := lot.Remaining
+		covered := decimal.Min(sum, held)
+		sum = sum.Sub(covered)
+		held = held.Sub(covered)
+		if !sum.IsPositive() {
+			continue
+		}
+		points = append(points, ExpiringPoints{Sum: sum, ExpiresAt: lot.ExpiresAt(ttlMonths)})
+	}
+	return points
+}
+
+// BalanceMismatch is a user whose balance snapshot disagrees with the sum of their ledger entries.
+type BalanceMismatch struct {
+	UserID   uuid.UUID
+	Snapshot Balance
+	Ledger   Balance
+}
+
+// LedgerEntryKind ENUM(accrual, withdrawal, adjustment, reversal, expiry).
+type LedgerEntryKind int //nolint: recvcheck //fine
+
+// LedgerEntry is an append-only record of a balance change. Debits have a negative Amount.
+// OrderNumber is set for accruals, withdrawals and reversals, AdjustmentID for adjustments and ReversalID
+// for reversals.
+type LedgerEntry struct {
+	ID           int64
+	UserID       uuid.UUID
+	Kind         LedgerEntryKind
+	Amount       decimal.Decimal
+	OrderNumber  OrderNumber
+	AdjustmentID uuid.UUID
+	ReversalID   uuid.UUID
+	CreatedAt    time.Time
+}
+
+// StatementEntry is a ledger entry together with the balance right after it. Reason is set for adjustments.
+type StatementEntry struct {
+	LedgerEntry
+	Reason  string
+	Balance decimal.Decimal
+}
+
+// StatementFilter selects a page of a statement, newest first. Zero values mean no bound.
+// BeforeID is the ID of the last entry of the previous page.
+type StatementFilter struct {
+	From     time.Time
+	To       time.Time
+	BeforeID int64
+	Limit    int32
+}
+
+// IdempotentRequest is a request made with an idempotency key. Fingerprint identifies the request the key
+// was first used with. Response is nil while that request is still being handled.
+type IdempotentRequest struct {
+	Fingerprint string
+	Response    *IdempotentResponse
+}
+
+type IdempotentResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Withdrawal is points spent on an order. Reversed is the part of Sum refunded since.
 type Withdrawal struct {
+	ID          uuid.UUID
 	Order       OrderNumber
 	Sum         decimal.Decimal
+	Reversed    decimal.Decimal
 	ProcessedAt time.Time
 }
+
+// WithdrawalStatus ENUM(withdrawn, partially_reversed, reversed).
+type WithdrawalStatus int //nolint: recvcheck //fine
+
+func (w Withdrawal) Status() WithdrawalStatus {
+	switch {
+	case !w.Reversed.IsPositive():
+		return WithdrawalStatusWithdrawn
+	case w.Reversed.LessThan(w.Sum):
+		return WithdrawalStatusPartiallyReversed
+	default:
+		return WithdrawalStatusReversed
+	}
+}
+
+// WithdrawalReversal refunds a withdrawal in full or in part, e.g. when the order it paid for is cancelled.
+// Reference is an optional identifier given by the caller. A reversal repeated with the same Reference
+// is applied once. OperatorID is uuid.Nil for reversals made with the admin token.
+type WithdrawalReversal struct {
+	ID           uuid.UUID
+	WithdrawalID uuid.UUID
+	UserID       uuid.UUID
+	Order        OrderNumber
+	Amount       decimal.Decimal
+	Reason       string
+	Reference    string
+	OperatorID   uuid.UUID
+	CreatedAt    time.Time
+}
+
+func NewWithdrawalReversal(
+	order OrderNumber,
+	amount decimal.Decimal,
+	reason string,
+	reference string,
+	operatorID uuid.UUID,
+) WithdrawalReversal {
+	return WithdrawalReversal{
+		ID:           uuid.New(),
+		WithdrawalID: uuid.Nil,
+		UserID:       uuid.Nil,
+		Order:        order,
+		Amount:       amount,
+		Reason:       reason,
+		Reference:    reference,
+		OperatorID:   operatorID,
+		CreatedAt:    time.Time{},
+	}
+}
+
+// HoldStatus ENUM(held, captured, released, expired).
+type HoldStatus int //nolint: recvcheck //fine
+
+// WithdrawalHold reserves points for an order until it is captured into a withdrawal, released or expires.
+// WithdrawalID is set once the hold is captured.
+type WithdrawalHold struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	Order        OrderNumber
+	Sum          decimal.Decimal
+	Status       HoldStatus
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+	SettledAt    time.Time
+	WithdrawalID uuid.UUID
+}
+
+func NewWithdrawalHold(userID uuid.UUID, order OrderNumber, sum decimal.Decimal, expiresAt time.Time) WithdrawalHold {
+	return WithdrawalHold{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Order:        order,
+		Sum:          sum,
+		Status:       HoldStatusHeld,
+		ExpiresAt:    expiresAt,
+		CreatedAt:    time.Time{},
+		SettledAt:    time.Time{},
+		WithdrawalID: uuid.Nil,
+	}
+}
+
+// Adjustment is a manual balance change made by support staff. A positive Amount credits the user.
+// OperatorID is uuid.Nil for adjustments made with the admin token.
+type Adjustment struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Amount     decimal.Decimal
+	Reason     string
+	OperatorID uuid.UUID
+	CreatedAt  time.Time
+}
+
+func NewAdjustment(userID uuid.UUID, amount decimal.Decimal, reason string, operatorID uuid.UUID) Adjustment {
+	return Adjustment{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Amount:     amount,
+		Reason:     reason,
+		OperatorID: operatorID,
+		CreatedAt:  time.Time{},
+	}
+}
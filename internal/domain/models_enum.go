@@ -10,6 +10,306 @@ import (
 	"fmt"
 )
 
+const (
+	// APIKeyScopeReadOrders is a APIKeyScope of type Read_orders.
+	APIKeyScopeReadOrders APIKeyScope = iota
+	// APIKeyScopeUploadOrders is a APIKeyScope of type Upload_orders.
+	APIKeyScopeUploadOrders
+	// APIKeyScopeReadBalance is a APIKeyScope of type Read_balance.
+	APIKeyScopeReadBalance
+	// APIKeyScopeWithdraw is a APIKeyScope of type Withdraw.
+	APIKeyScopeWithdraw
+)
+
+var ErrInvalidAPIKeyScope = errors.New("not a valid APIKeyScope")
+
+const _APIKeyScopeName = "read_ordersupload_ordersread_balancewithdraw"
+
+var _APIKeyScopeMap = map[APIKeyScope]string{
+	APIKeyScopeReadOrders:   _APIKeyScopeName[0:11],
+	APIKeyScopeUploadOrders: _APIKeyScopeName[11:24],
+	APIKeyScopeReadBalance:  _APIKeyScopeName[24:36],
+	APIKeyScopeWithdraw:     _APIKeyScopeName[36:44],
+}
+
+// String implements the Stringer interface.
+func (x APIKeyScope) String() string {
+	if str, ok := _APIKeyScopeMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("APIKeyScope(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x APIKeyScope) IsValid() bool {
+	_, ok := _APIKeyScopeMap[x]
+	return ok
+}
+
+var _APIKeyScopeValue = map[string]APIKeyScope{
+	_APIKeyScopeName[0:11]:  APIKeyScopeReadOrders,
+	_APIKeyScopeName[11:24]: APIKeyScopeUploadOrders,
+	_APIKeyScopeName[24:36]: APIKeyScopeReadBalance,
+	_APIKeyScopeName[36:44]: APIKeyScopeWithdraw,
+}
+
+// ParseAPIKeyScope attempts to convert a string to a APIKeyScope.
+func ParseAPIKeyScope(name string) (APIKeyScope, error) {
+	if x, ok := _APIKeyScopeValue[name]; ok {
+		return x, nil
+	}
+	return APIKeyScope(0), fmt.Errorf("%s is %w", name, ErrInvalidAPIKeyScope)
+}
+
+// MarshalText implements the text marshaller method.
+func (x APIKeyScope) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method.
+func (x *APIKeyScope) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseAPIKeyScope(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+// AppendText appends the textual representation of itself to the end of b
+// (allocating a larger slice if necessary) and returns the updated slice.
+//
+// Implementations must not retain b, nor mutate any bytes within b[:len(b)].
+func (x *APIKeyScope) AppendText(b []byte) ([]byte, error) {
+	return append(b, x.String()...), nil
+}
+
+const (
+	// HoldStatusHeld is a HoldStatus of type Held.
+	HoldStatusHeld HoldStatus = iota
+	// HoldStatusCaptured is a HoldStatus of type Captured.
+	HoldStatusCaptured
+	// HoldStatusReleased is a HoldStatus of type Released.
+	HoldStatusReleased
+	// HoldStatusExpired is a HoldStatus of type Expired.
+	HoldStatusExpired
+)
+
+var ErrInvalidHoldStatus = errors.New("not a valid HoldStatus")
+
+const _HoldStatusName = "heldcapturedreleasedexpired"
+
+var _HoldStatusMap = map[HoldStatus]string{
+	HoldStatusHeld:     _HoldStatusName[0:4],
+	HoldStatusCaptured: _HoldStatusName[4:12],
+	HoldStatusReleased: _HoldStatusName[12:20],
+	HoldStatusExpired:  _HoldStatusName[20:27],
+}
+
+// String implements the Stringer interface.
+func (x HoldStatus) String() string {
+	if str, ok := _HoldStatusMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("HoldStatus(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x HoldStatus) IsValid() bool {
+	_, ok := _HoldStatusMap[x]
+	return ok
+}
+
+var _HoldStatusValue = map[string]HoldStatus{
+	_HoldStatusName[0:4]:   HoldStatusHeld,
+	_HoldStatusName[4:12]:  HoldStatusCaptured,
+	_HoldStatusName[12:20]: HoldStatusReleased,
+	_HoldStatusName[20:27]: HoldStatusExpired,
+}
+
+// ParseHoldStatus attempts to convert a string to a HoldStatus.
+func ParseHoldStatus(name string) (HoldStatus, error) {
+	if x, ok := _HoldStatusValue[name]; ok {
+		return x, nil
+	}
+	return HoldStatus(0), fmt.Errorf("%s is %w", name, ErrInvalidHoldStatus)
+}
+
+// MarshalText implements the text marshaller method.
+func (x HoldStatus) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method.
+func (x *HoldStatus) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseHoldStatus(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+// AppendText appends the textual representation of itself to the end of b
+// (allocating a larger slice if necessary) and returns the updated slice.
+//
+// Implementations must not retain b, nor mutate any bytes within b[:len(b)].
+func (x *HoldStatus) AppendText(b []byte) ([]byte, error) {
+	return append(b, x.String()...), nil
+}
+
+const (
+	// LedgerEntryKindAccrual is a LedgerEntryKind of type Accrual.
+	LedgerEntryKindAccrual LedgerEntryKind = iota
+	// LedgerEntryKindWithdrawal is a LedgerEntryKind of type Withdrawal.
+	LedgerEntryKindWithdrawal
+	// LedgerEntryKindAdjustment is a LedgerEntryKind of type Adjustment.
+	LedgerEntryKindAdjustment
+	// LedgerEntryKindReversal is a LedgerEntryKind of type Reversal.
+	LedgerEntryKindReversal
+	// LedgerEntryKindExpiry is a LedgerEntryKind of type Expiry.
+	LedgerEntryKindExpiry
+)
+
+var ErrInvalidLedgerEntryKind = errors.New("not a valid LedgerEntryKind")
+
+const _LedgerEntryKindName = "accrualwithdrawaladjustmentreversalexpiry"
+
+var _LedgerEntryKindMap = map[LedgerEntryKind]string{
+	LedgerEntryKindAccrual:    _LedgerEntryKindName[0:7],
+	LedgerEntryKindWithdrawal: _LedgerEntryKindName[7:17],
+	LedgerEntryKindAdjustment: _LedgerEntryKindName[17:27],
+	LedgerEntryKindReversal:   _LedgerEntryKindName[27:35],
+	LedgerEntryKindExpiry:     _LedgerEntryKindName[35:41],
+}
+
+// String implements the Stringer interface.
+func (x LedgerEntryKind) String() string {
+	if str, ok := _LedgerEntryKindMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("LedgerEntryKind(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x LedgerEntryKind) IsValid() bool {
+	_, ok := _LedgerEntryKindMap[x]
+	return ok
+}
+
+var _LedgerEntryKindValue = map[string]LedgerEntryKind{
+	_LedgerEntryKindName[0:7]:   LedgerEntryKindAccrual,
+	_LedgerEntryKindName[7:17]:  LedgerEntryKindWithdrawal,
+	_LedgerEntryKindName[17:27]: LedgerEntryKindAdjustment,
+	_LedgerEntryKindName[27:35]: LedgerEntryKindReversal,
+	_LedgerEntryKindName[35:41]: LedgerEntryKindExpiry,
+}
+
+// ParseLedgerEntryKind attempts to convert a string to a LedgerEntryKind.
+func ParseLedgerEntryKind(name string) (LedgerEntryKind, error) {
+	if x, ok := _LedgerEntryKindValue[name]; ok {
+		return x, nil
+	}
+	return LedgerEntryKind(0), fmt.Errorf("%s is %w", name, ErrInvalidLedgerEntryKind)
+}
+
+// MarshalText implements the text marshaller method.
+func (x LedgerEntryKind) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method.
+func (x *LedgerEntryKind) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseLedgerEntryKind(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+// AppendText appends the textual representation of itself to the end of b
+// (allocating a larger slice if necessary) and returns the updated slice.
+//
+// Implementations must not retain b, nor mutate any bytes within b[:len(b)].
+func (x *LedgerEntryKind) AppendText(b []byte) ([]byte, error) {
+	return append(b, x.String()...), nil
+}
+
+const (
+	// LoginAttemptScopeLogin is a LoginAttemptScope of type Login.
+	LoginAttemptScopeLogin LoginAttemptScope = iota
+	// LoginAttemptScopeAddress is a LoginAttemptScope of type Address.
+	LoginAttemptScopeAddress
+)
+
+var ErrInvalidLoginAttemptScope = errors.New("not a valid LoginAttemptScope")
+
+const _LoginAttemptScopeName = "loginaddress"
+
+var _LoginAttemptScopeMap = map[LoginAttemptScope]string{
+	LoginAttemptScopeLogin:   _LoginAttemptScopeName[0:5],
+	LoginAttemptScopeAddress: _LoginAttemptScopeName[5:12],
+}
+
+// String implements the Stringer interface.
+func (x LoginAttemptScope) String() string {
+	if str, ok := _LoginAttemptScopeMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("LoginAttemptScope(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x LoginAttemptScope) IsValid() bool {
+	_, ok := _LoginAttemptScopeMap[x]
+	return ok
+}
+
+var _LoginAttemptScopeValue = map[string]LoginAttemptScope{
+	_LoginAttemptScopeName[0:5]:  LoginAttemptScopeLogin,
+	_LoginAttemptScopeName[5:12]: LoginAttemptScopeAddress,
+}
+
+// ParseLoginAttemptScope attempts to convert a string to a LoginAttemptScope.
+func ParseLoginAttemptScope(name string) (LoginAttemptScope, error) {
+	if x, ok := _LoginAttemptScopeValue[name]; ok {
+		return x, nil
+	}
+	return LoginAttemptScope(0), fmt.Errorf("%s is %w", name, ErrInvalidLoginAttemptScope)
+}
+
+// MarshalText implements the text marshaller method.
+func (x LoginAttemptScope) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method.
+func (x *LoginAttemptScope) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseLoginAttemptScope(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+// AppendText appends the textual representation of itself to the end of b
+// (allocating a larger slice if necessary) and returns the updated slice.
+//
+// Implementations must not retain b, nor mutate any bytes within b[:len(b)].
+func (x *LoginAttemptScope) AppendText(b []byte) ([]byte, error) {
+	return append(b, x.String()...), nil
+}
+
 const (
 	// OrderStatusNEW is a OrderStatus of type NEW.
 	OrderStatusNEW OrderStatus = iota
@@ -19,17 +319,20 @@ const (
 	OrderStatusINVALID
 	// OrderStatusPROCESSED is a OrderStatus of type PROCESSED.
 	OrderStatusPROCESSED
+	// OrderStatusSTUCK is a OrderStatus of type STUCK.
+	OrderStatusSTUCK
 )
 
 var ErrInvalidOrderStatus = errors.New("not a valid OrderStatus")
 
-const _OrderStatusName = "NEWPROCESSINGINVALIDPROCESSED"
+const _OrderStatusName = "NEWPROCESSINGINVALIDPROCESSEDSTUCK"
 
 var _OrderStatusMap = map[OrderStatus]string{
 	OrderStatusNEW:        _OrderStatusName[0:3],
 	OrderStatusPROCESSING: _OrderStatusName[3:13],
 	OrderStatusINVALID:    _OrderStatusName[13:20],
 	OrderStatusPROCESSED:  _OrderStatusName[20:29],
+	OrderStatusSTUCK:      _OrderStatusName[29:34],
 }
 
 // String implements the Stringer interface.
@@ -52,6 +355,7 @@ var _OrderStatusValue = map[string]OrderStatus{
 	_OrderStatusName[3:13]:  OrderStatusPROCESSING,
 	_OrderStatusName[13:20]: OrderStatusINVALID,
 	_OrderStatusName[20:29]: OrderStatusPROCESSED,
+	_OrderStatusName[29:34]: OrderStatusSTUCK,
 }
 
 // ParseOrderStatus attempts to convert a string to a OrderStatus.
@@ -85,3 +389,227 @@ func (x *OrderStatus) UnmarshalText(text []byte) error {
 func (x *OrderStatus) AppendText(b []byte) ([]byte, error) {
 	return append(b, x.String()...), nil
 }
+
+const (
+	// OrderUploadResultAccepted is a OrderUploadResult of type Accepted.
+	OrderUploadResultAccepted OrderUploadResult = iota
+	// OrderUploadResultDuplicateOwn is a OrderUploadResult of type Duplicate_own.
+	OrderUploadResultDuplicateOwn
+	// OrderUploadResultOwnedByOther is a OrderUploadResult of type Owned_by_other.
+	OrderUploadResultOwnedByOther
+	// OrderUploadResultUsedForWithdrawal is a OrderUploadResult of type Used_for_withdrawal.
+	OrderUploadResultUsedForWithdrawal
+	// OrderUploadResultMalformed is a OrderUploadResult of type Malformed.
+	OrderUploadResultMalformed
+)
+
+var ErrInvalidOrderUploadResult = errors.New("not a valid OrderUploadResult")
+
+const _OrderUploadResultName = "acceptedduplicate_ownowned_by_otherused_for_withdrawalmalformed"
+
+var _OrderUploadResultMap = map[OrderUploadResult]string{
+	OrderUploadResultAccepted:          _OrderUploadResultName[0:8],
+	OrderUploadResultDuplicateOwn:      _OrderUploadResultName[8:21],
+	OrderUploadResultOwnedByOther:      _OrderUploadResultName[21:35],
+	OrderUploadResultUsedForWithdrawal: _OrderUploadResultName[35:54],
+	OrderUploadResultMalformed:         _OrderUploadResultName[54:63],
+}
+
+// String implements the Stringer interface.
+func (x OrderUploadResult) String() string {
+	if str, ok := _OrderUploadResultMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("OrderUploadResult(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x OrderUploadResult) IsValid() bool {
+	_, ok := _OrderUploadResultMap[x]
+	return ok
+}
+
+var _OrderUploadResultValue = map[string]OrderUploadResult{
+	_OrderUploadResultName[0:8]:   OrderUploadResultAccepted,
+	_OrderUploadResultName[8:21]:  OrderUploadResultDuplicateOwn,
+	_OrderUploadResultName[21:35]: OrderUploadResultOwnedByOther,
+	_OrderUploadResultName[35:54]: OrderUploadResultUsedForWithdrawal,
+	_OrderUploadResultName[54:63]: OrderUploadResultMalformed,
+}
+
+// ParseOrderUploadResult attempts to convert a string to a OrderUploadResult.
+func ParseOrderUploadResult(name string) (OrderUploadResult, error) {
+	if x, ok := _OrderUploadResultValue[name]; ok {
+		return x, nil
+	}
+	return OrderUploadResult(0), fmt.Errorf("%s is %w", name, ErrInvalidOrderUploadResult)
+}
+
+// MarshalText implements the text marshaller method.
+func (x OrderUploadResult) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method.
+func (x *OrderUploadResult) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseOrderUploadResult(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+// AppendText appends the textual representation of itself to the end of b
+// (allocating a larger slice if necessary) and returns the updated slice.
+//
+// Implementations must not retain b, nor mutate any bytes within b[:len(b)].
+func (x *OrderUploadResult) AppendText(b []byte) ([]byte, error) {
+	return append(b, x.String()...), nil
+}
+
+const (
+	// UserRoleUser is a UserRole of type User.
+	UserRoleUser UserRole = iota
+	// UserRoleSupport is a UserRole of type Support.
+	UserRoleSupport
+	// UserRoleAdmin is a UserRole of type Admin.
+	UserRoleAdmin
+)
+
+var ErrInvalidUserRole = errors.New("not a valid UserRole")
+
+const _UserRoleName = "usersupportadmin"
+
+var _UserRoleMap = map[UserRole]string{
+	UserRoleUser:    _UserRoleName[0:4],
+	UserRoleSupport: _UserRoleName[4:11],
+	UserRoleAdmin:   _UserRoleName[11:16],
+}
+
+// String implements the Stringer interface.
+func (x UserRole) String() string {
+	if str, ok := _UserRoleMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("UserRole(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x UserRole) IsValid() bool {
+	_, ok := _UserRoleMap[x]
+	return ok
+}
+
+var _UserRoleValue = map[string]UserRole{
+	_UserRoleName[0:4]:   UserRoleUser,
+	_UserRoleName[4:11]:  UserRoleSupport,
+	_UserRoleName[11:16]: UserRoleAdmin,
+}
+
+// ParseUserRole attempts to convert a string to a UserRole.
+func ParseUserRole(name string) (UserRole, error) {
+	if x, ok := _UserRoleValue[name]; ok {
+		return x, nil
+	}
+	return UserRole(0), fmt.Errorf("%s is %w", name, ErrInvalidUserRole)
+}
+
+// MarshalText implements the text marshaller method.
+func (x UserRole) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method.
+func (x *UserRole) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseUserRole(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+// AppendText appends the textual representation of itself to the end of b
+// (allocating a larger slice if necessary) and returns the updated slice.
+//
+// Implementations must not retain b, nor mutate any bytes within b[:len(b)].
+func (x *UserRole) AppendText(b []byte) ([]byte, error) {
+	return append(b, x.String()...), nil
+}
+
+const (
+	// WithdrawalStatusWithdrawn is a WithdrawalStatus of type Withdrawn.
+	WithdrawalStatusWithdrawn WithdrawalStatus = iota
+	// WithdrawalStatusPartiallyReversed is a WithdrawalStatus of type Partially_reversed.
+	WithdrawalStatusPartiallyReversed
+	// WithdrawalStatusReversed is a WithdrawalStatus of type Reversed.
+	WithdrawalStatusReversed
+)
+
+var ErrInvalidWithdrawalStatus = errors.New("not a valid WithdrawalStatus")
+
+const _WithdrawalStatusName = "withdrawnpartially_reversedreversed"
+
+var _WithdrawalStatusMap = map[WithdrawalStatus]string{
+	WithdrawalStatusWithdrawn:         _WithdrawalStatusName[0:9],
+	WithdrawalStatusPartiallyReversed: _WithdrawalStatusName[9:27],
+	WithdrawalStatusReversed:          _WithdrawalStatusName[27:35],
+}
+
+// String implements the Stringer interface.
+func (x WithdrawalStatus) String() string {
+	if str, ok := _WithdrawalStatusMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("WithdrawalStatus(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x WithdrawalStatus) IsValid() bool {
+	_, ok := _WithdrawalStatusMap[x]
+	return ok
+}
+
+var _WithdrawalStatusValue = map[string]WithdrawalStatus{
+	_WithdrawalStatusName[0:9]:   WithdrawalStatusWithdrawn,
+	_WithdrawalStatusName[9:27]:  WithdrawalStatusPartiallyReversed,
+	_WithdrawalStatusName[27:35]: WithdrawalStatusReversed,
+}
+
+// ParseWithdrawalStatus attempts to convert a string to a WithdrawalStatus.
+func ParseWithdrawalStatus(name string) (WithdrawalStatus, error) {
+	if x, ok := _WithdrawalStatusValue[name]; ok {
+		return x, nil
+	}
+	return WithdrawalStatus(0), fmt.Errorf("%s is %w", name, ErrInvalidWithdrawalStatus)
+}
+
+// MarshalText implements the text marshaller method.
+func (x WithdrawalStatus) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method.
+func (x *WithdrawalStatus) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseWithdrawalStatus(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+// AppendText appends the textual representation of itself to the end of b
+// (allocating a larger slice if necessary) and returns the updated slice.
+//
+// Implementations must not retain b, nor mutate any bytes within b[:len(b)].
+func (x *WithdrawalStatus) AppendText(b []byte) ([]byte, error) {
+	return append(b, x.String()...), nil
+}
@@ -3,7 +3,9 @@ package domain_test
 import (
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/require"
 	"github.com/ttl256/gophermart-loyalty/internal/domain"
 )
@@ -25,3 +27,37 @@ func TestNewOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestWithdrawalStatus(t *testing.T) {
+	cases := []struct {
+		reversed int64
+		want     domain.WithdrawalStatus
+	}{
+		{0, domain.WithdrawalStatusWithdrawn},
+		{10, domain.WithdrawalStatusPartiallyReversed},
+		{40, domain.WithdrawalStatusReversed},
+	}
+
+	for i, tt := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			w := domain.Withdrawal{Sum: decimal.NewFromInt(40), Reversed: decimal.NewFromInt(tt.reversed)}
+			require.Equal(t, tt.want, w.Status())
+		})
+	}
+}
+
+func TestNewExpiringPoints(t *testing.T) {
+	created := time.Date(2025, time.January, 31, 12, 0, 0, 0, time.UTC)
+	lots := []domain.PointLot{
+		{ID: 1, Amount: decimal.NewFromInt(100), Remaining: decimal.NewFromInt(30), CreatedAt: created},
+		{ID: 2, Amount: decimal.NewFromInt(50), Remaining: decimal.NewFromInt(50), CreatedAt: created.Add(time.Hour)},
+	}
+
+	points := domain.NewExpiringPoints(lots, decimal.NewFromInt(40), 6)
+	require.Len(t, points, 1)
+	require.True(t, decimal.NewFromInt(40).Equal(points[0].Sum))
+	require.Equal(t, created.Add(time.Hour).AddDate(0, 6, 0), points[0].ExpiresAt)
+
+	require.Len(t, domain.NewExpiringPoints(lots, decimal.Zero, 6), 2)
+	require.Empty(t, domain.NewExpiringPoints(lots, decimal.NewFromInt(80), 6))
+}
@@ -0,0 +1,503 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+const (
+	defaultUsersLimit = 100
+	maxUsersLimit     = 1000
+)
+
+var errInvalidPagination = errors.New("invalid limit or offset")
+
+// AdminGetUsers lists users ordered by registration, paginated with ?limit= and ?offset=.
+func (h *HTTPHandler) AdminGetUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pagination(r)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	users, err := h.AuthService.ListUsers(r.Context(), limit, offset)
+	if err != nil {
+		h.Logger.Error("listing users", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if len(users) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp := make([]UserResponse, 0, len(users))
+	for _, i := range users {
+		resp = append(resp, newUserResponse(i))
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (h *HTTPHandler) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(newUserResponse(user))
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (h *HTTPHandler) AdminGetOrders(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+	h.writeOrders(w, r, user.ID)
+}
+
+func (h *HTTPHandler) AdminGetBalance(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+	h.writeBalance(w, r, user.ID)
+}
+
+func (h *HTTPHandler) AdminGetWithdrawals(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+	h.writeWithdrawals(w, r, user.ID)
+}
+
+// AdminAdjustBalance credits or debits the user's balance. The reason and the operator are recorded with it.
+// Only admins may credit, and nobody may adjust their own balance.
+func (h *HTTPHandler) AdminAdjustBalance(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+	operatorID, _ := UserIDFromContext(r.Context())
+	if operatorID == user.ID {
+		h.Logger.Info("refusing to adjust own balance", slog.String("user_id", user.ID.String()))
+		hErr := http.StatusConflict
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	var req AdjustmentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if err = req.Validate(); err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	role, _ := RoleFromContext(r.Context())
+	if role != domain.UserRoleAdmin && decimal.Decimal(req.Amount).IsPositive() {
+		h.Logger.Info(
+			"insufficient role",
+			slog.String("user_id", user.ID.String()),
+			slog.String("amount", decimal.Decimal(req.Amount).String()),
+			slog.String("by", actor(r.Context())),
+		)
+		hErr := http.StatusForbidden
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	adj := domain.NewAdjustment(user.ID, decimal.Decimal(req.Amount), req.Reason, operatorID)
+	adj, err = h.OrderService.AdjustBalance(r.Context(), adj)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAdjustment) {
+			h.Logger.Debug("invalid adjustment", slog.Any("error", err))
+			hErr := http.StatusBadRequest
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		if errors.Is(err, domain.ErrNotEnoughFunds) {
+			h.Logger.Debug("adjustment exceeds balance", slog.Any("error", err))
+			hErr := http.StatusConflict
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		h.Logger.Error("adjusting balance", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	h.Logger.Info(
+		"balance adjusted",
+		slog.String("user_id", user.ID.String()),
+		slog.String("adjustment_id", adj.ID.String()),
+		slog.String("amount", adj.Amount.String()),
+		slog.String("by", actor(r.Context())),
+	)
+	data, err := json.Marshal(newAdjustmentResponse(adj))
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(data)
+}
+
+func (h *HTTPHandler) AdminGetAdjustments(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+	adjustments, err := h.OrderService.GetAdjustments(r.Context(), user.ID)
+	if err != nil {
+		h.Logger.Error("getting adjustments", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if len(adjustments) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp := make([]AdjustmentResponse, 0, len(adjustments))
+	for _, i := range adjustments {
+		resp = append(resp, newAdjustmentResponse(i))
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// AdminReconcileBalances reports balance snapshots that don't match the ledger.
+func (h *HTTPHandler) AdminReconcileBalances(w http.ResponseWriter, r *http.Request) {
+	mismatches, err := h.OrderService.ReconcileBalances(r.Context())
+	if err != nil {
+		h.Logger.Error("reconciling balances", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	resp := ReconciliationResponse{
+		OK:         len(mismatches) == 0,
+		Mismatches: make([]BalanceMismatchResponse, 0, len(mismatches)),
+	}
+	for _, i := range mismatches {
+		h.Logger.Warn(
+			"balance mismatch",
+			slog.String("user_id", i.UserID.String()),
+			slog.String("snapshot", i.Snapshot.Current.String()),
+			slog.String("ledger", i.Ledger.Current.String()),
+		)
+		resp.Mismatches = append(resp.Mismatches, BalanceMismatchResponse{
+			UserID:   i.UserID,
+			Snapshot: BalanceResponse{Current: Money(i.Snapshot.Current), Withdrawn: Money(i.Snapshot.Withdrawn)},
+			Ledger:   BalanceResponse{Current: Money(i.Ledger.Current), Withdrawn: Money(i.Ledger.Withdrawn)},
+		})
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// AdminReverseWithdrawal refunds the withdrawal made for the order in the URL, e.g. when the order is cancelled.
+// A reversal repeated with the same reference responds with the earlier one and 200 instead of 201.
+// Staff can't reverse their own withdrawals.
+func (h *HTTPHandler) AdminReverseWithdrawal(w http.ResponseWriter, r *http.Request) {
+	var req ReversalRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if err = req.Validate(); err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	operatorID, _ := UserIDFromContext(r.Context())
+	order := domain.OrderNumber(chi.URLParam(r, "order"))
+	rev := domain.NewWithdrawalReversal(order, decimal.Decimal(req.Amount), req.Reason, req.Reference, operatorID)
+	rev, created, err := h.OrderService.ReverseWithdrawal(r.Context(), rev)
+	if err != nil {
+		if errors.Is(err, domain.ErrWithdrawalNotFound) {
+			h.Logger.Debug("withdrawal not found", slog.String("order", string(order)))
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidReversal) {
+			h.Logger.Debug("invalid reversal", slog.Any("error", err))
+			hErr := http.StatusBadRequest
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		if errors.Is(err, domain.ErrSelfReversal) {
+			h.Logger.Info("refusing to reverse own withdrawal", slog.String("order", string(order)))
+			hErr := http.StatusConflict
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		if errors.Is(err, domain.ErrWithdrawalReversed) || errors.Is(err, domain.ErrReversalExceedsWithdrawal) {
+			h.Logger.Debug("reversal rejected", slog.Any("error", err))
+			hErr := http.StatusConflict
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		h.Logger.Error("reversing withdrawal", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		h.Logger.Info(
+			"withdrawal reversed",
+			slog.String("user_id", rev.UserID.String()),
+			slog.String("order", string(rev.Order)),
+			slog.String("reversal_id", rev.ID.String()),
+			slog.String("amount", rev.Amount.String()),
+			slog.String("by", actor(r.Context())),
+		)
+	}
+	data, err := json.Marshal(ReversalResponse{
+		ID:         rev.ID,
+		Order:      rev.Order,
+		Amount:     Money(rev.Amount),
+		Reason:     rev.Reason,
+		Reference:  rev.Reference,
+		OperatorID: rev.OperatorID,
+		CreatedAt:  rev.CreatedAt,
+	})
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// AdminBlockUser revokes the user's sessions and denies logins and API keys until unblocked.
+func (h *HTTPHandler) AdminBlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if self, isUser := UserIDFromContext(r.Context()); isUser && self == user.ID {
+		h.Logger.Debug("refusing to block self", slog.String("user_id", user.ID.String()))
+		hErr := http.StatusConflict
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if !h.mayManage(w, r, user) {
+		return
+	}
+	if err := h.AuthService.BlockUser(r.Context(), user.ID); err != nil {
+		h.Logger.Error("blocking user", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	h.Logger.Info("user blocked", slog.String("user_id", user.ID.String()), slog.String("by", actor(r.Context())))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPHandler) AdminUnblockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if !h.mayManage(w, r, user) {
+		return
+	}
+	if err := h.AuthService.UnblockUser(r.Context(), user.ID); err != nil {
+		h.Logger.Error("unblocking user", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	h.Logger.Info("user unblocked", slog.String("user_id", user.ID.String()), slog.String("by", actor(r.Context())))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminSetUserRole changes the user's role and ends their sessions so the new role applies on the next login.
+// Admins can't change their own role, so the last admin can't demote themselves.
+func (h *HTTPHandler) AdminSetUserRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if self, isUser := UserIDFromContext(r.Context()); isUser && self == user.ID {
+		h.Logger.Debug("refusing to change own role", slog.String("user_id", user.ID.String()))
+		hErr := http.StatusConflict
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	var req SetUserRoleRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if err = req.Validate(); err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	if err = h.AuthService.SetUserRole(r.Context(), user.ID, *req.Role); err != nil {
+		h.Logger.Error("setting user role", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	h.Logger.Info(
+		"user role changed",
+		slog.String("user_id", user.ID.String()),
+		slog.String("from", user.Role.String()),
+		slog.String("to", req.Role.String()),
+		slog.String("by", actor(r.Context())),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// targetUser resolves the {id} URL parameter. It writes the response and returns false on failure.
+func (h *HTTPHandler) targetUser(w http.ResponseWriter, r *http.Request) (domain.User, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return domain.User{}, false
+	}
+	user, err := h.AuthService.GetUser(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			http.NotFound(w, r)
+			return domain.User{}, false
+		}
+		h.Logger.Error("getting user", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return domain.User{}, false
+	}
+	return user, true
+}
+
+// mayManage responds with 403 unless the caller may act on the target's account: admins may act on anyone,
+// support staff only on plain users.
+func (h *HTTPHandler) mayManage(w http.ResponseWriter, r *http.Request, target domain.User) bool {
+	role, _ := RoleFromContext(r.Context())
+	if role == domain.UserRoleAdmin || target.Role == domain.UserRoleUser {
+		return true
+	}
+	h.Logger.Info(
+		"insufficient role",
+		slog.String("user_id", target.ID.String()),
+		slog.String("target_role", target.Role.String()),
+		slog.String("by", actor(r.Context())),
+	)
+	hErr := http.StatusForbidden
+	http.Error(w, http.StatusText(hErr), hErr)
+	return false
+}
+
+// actor names who made an admin request for the logs.
+func actor(ctx context.Context) string {
+	if id, ok := UserIDFromContext(ctx); ok {
+		return id.String()
+	}
+	return "admin token"
+}
+
+func pagination(r *http.Request) (int32, int32, error) {
+	limit, offset := int64(defaultUsersLimit), int64(0)
+	var err error
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.ParseInt(v, 10, 32); err != nil || limit < 1 || limit > maxUsersLimit {
+			return 0, 0, fmt.Errorf("%w: limit must be between 1 and %d", errInvalidPagination, maxUsersLimit)
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.ParseInt(v, 10, 32); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("%w: offset must not be negative", errInvalidPagination)
+		}
+	}
+	return int32(limit), int32(offset), nil
+}
+
+func newUserResponse(user domain.User) UserResponse {
+	return UserResponse{
+		ID:        user.ID,
+		Login:     user.Login,
+		Role:      user.Role,
+		Blocked:   user.Blocked,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+func newAdjustmentResponse(adj domain.Adjustment) AdjustmentResponse {
+	return AdjustmentResponse{
+		ID:         adj.ID,
+		Amount:     Money(adj.Amount),
+		Reason:     adj.Reason,
+		OperatorID: adj.OperatorID,
+		CreatedAt:  adj.CreatedAt,
+	}
+}
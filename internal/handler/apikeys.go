@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+func (h *HTTPHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	var req CreateAPIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if err = req.Validate(); err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	key, secret, err := h.AuthService.CreateAPIKey(r.Context(), id, req.Name, req.Scopes)
+	if err != nil {
+		h.Logger.Error("creating api key", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	data, err := json.Marshal(CreateAPIKeyResponse{
+		APIKeyResponse: newAPIKeyResponse(key),
+		Key:            string(secret),
+	})
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(data)
+}
+
+func (h *HTTPHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	keys, err := h.AuthService.GetAPIKeys(r.Context(), id)
+	if err != nil {
+		h.Logger.Error("getting api keys", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp := make([]APIKeyResponse, 0, len(keys))
+	for _, i := range keys {
+		resp = append(resp, newAPIKeyResponse(i))
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (h *HTTPHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	keyID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	err = h.AuthService.RevokeAPIKey(r.Context(), id, keyID)
+	if err != nil {
+		if errors.Is(err, domain.ErrAPIKeyNotFound) {
+			hErr := http.StatusNotFound
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		h.Logger.Error("revoking api key", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newAPIKeyResponse(key domain.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
@@ -3,21 +3,26 @@ package handler_test
 import (
 	"context"
 	"crypto/rand"
-	"errors"
+	"encoding/base32"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/suite"
 	"github.com/ttl256/gophermart-loyalty/internal/auth"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
 	"github.com/ttl256/gophermart-loyalty/internal/handler"
 	"github.com/ttl256/gophermart-loyalty/internal/logger"
 	"github.com/ttl256/gophermart-loyalty/internal/repository"
 	"github.com/ttl256/gophermart-loyalty/internal/service"
 	"github.com/ttl256/gophermart-loyalty/internal/testutil"
+	"golang.org/x/sync/errgroup"
 	"resty.dev/v3"
 )
 
@@ -54,8 +59,16 @@ func (s *AuthSuite) SetupSuite() {
 	s.pool, err = pgxpool.New(s.ctx, s.pg.DSN)
 	s.Require().NoError(err)
 
-	authSvc := service.NewAuthService(repo)
-	authManager := auth.NewManager("test", 1*time.Hour)
+	authCfg := service.DefaultAuthConfig()
+	authCfg.MaxLoginFailures = 3
+	authCfg.LoginBaseDelay = 0
+	totpCipher, err := auth.NewSecretBox([]byte(strings.Repeat("k", 32)))
+	s.Require().NoError(err)
+	authCfg.TOTPCipher = totpCipher
+	authSvc := service.NewAuthService(repo, authCfg)
+	keys := auth.NewKeyring()
+	s.Require().NoError(keys.Add(auth.NewHMACKey("test", []byte("test"))))
+	authManager := auth.NewManager(keys, 1*time.Hour)
 	s.jwt = authManager
 
 	h := handler.HTTPHandler{
@@ -63,6 +76,7 @@ func (s *AuthSuite) SetupSuite() {
 		OrderService: nil,
 		JWT:          authManager,
 		Logger:       slog.Default(),
+		AdminToken:   "admin",
 	}
 	srv := httptest.NewServer(h.Routes())
 	s.server = srv
@@ -95,7 +109,7 @@ func (s *AuthSuite) TestRegisterAndLogin() {
 	s.Equal(http.StatusOK, resp.StatusCode())
 	cookie, err := getAuthCookie(resp.Cookies())
 	s.Require().NoError(err)
-	registerUUID, err := s.jwt.Parse(cookie.Value)
+	registerClaims, err := s.jwt.Parse(cookie.Value)
 	s.Require().NoError(err)
 
 	loginReq := registerReq
@@ -104,12 +118,12 @@ func (s *AuthSuite) TestRegisterAndLogin() {
 	s.Equal(http.StatusOK, resp.StatusCode())
 	cookie, err = getAuthCookie(resp.Cookies())
 	s.Require().NoError(err)
-	loginUUID, err := s.jwt.Parse(cookie.Value)
+	loginClaims, err := s.jwt.Parse(cookie.Value)
 	s.Require().NoError(err)
 
 	s.Equal(
-		registerUUID,
-		loginUUID,
+		registerClaims.UserID,
+		loginClaims.UserID,
 		"auth cookie must contain the same user ID for register and login responses",
 	)
 }
@@ -167,16 +181,596 @@ func (s *AuthSuite) TestReqEmptyFields() {
 	}
 }
 
+func (s *AuthSuite) TestRefreshRotation() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	firstRefresh, err := getCookie(resp.Cookies(), "Refresh-Token")
+	s.Require().NoError(err)
+
+	resp, err = s.client.R().Post("/api/user/token/refresh")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	secondRefresh, err := getCookie(resp.Cookies(), "Refresh-Token")
+	s.Require().NoError(err)
+	s.NotEqual(firstRefresh.Value, secondRefresh.Value)
+	cookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+
+	replay := resty.New().SetBaseURL(s.server.URL)
+	resp, err = replay.R().SetCookie(firstRefresh).Post("/api/user/token/refresh")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "reused refresh token must be rejected")
+
+	resp, err = replay.R().SetCookie(secondRefresh).Post("/api/user/token/refresh")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "reuse must revoke the whole session")
+
+	resp, err = replay.R().SetCookie(cookie).Post("/api/user/logout")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "access token of a revoked session must be rejected")
+	s.Require().NoError(replay.Close())
+}
+
+func (s *AuthSuite) TestLogout() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	cookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+
+	resp, err = s.client.R().Post("/api/user/logout")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	replay := resty.New().SetBaseURL(s.server.URL)
+	resp, err = replay.R().SetCookie(cookie).Post("/api/user/logout")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode())
+	s.Require().NoError(replay.Close())
+
+	resp, err = s.client.R().Post("/api/user/token/refresh")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode())
+}
+
+func (s *AuthSuite) TestLoginLockout() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	for range 3 {
+		resp, err = s.client.R().
+			SetBody(handler.RegisterRequest{Login: login, Password: rand.Text()}).
+			Post("/api/user/login")
+		s.Require().NoError(err)
+		s.Equal(http.StatusUnauthorized, resp.StatusCode())
+	}
+
+	resp, err = s.client.R().SetBody(registerReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusLocked, resp.StatusCode(), "correct password must not bypass a lockout")
+	s.NotEmpty(resp.Header().Get("Retry-After"))
+
+	resp, err = s.client.R().SetQueryParam("login", login).Delete("/api/admin/lockouts")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode(), "users can't manage lockouts")
+
+	resp, err = s.client.R().
+		SetHeader("X-Admin-Token", "admin").
+		SetQueryParam("login", login).
+		Delete("/api/admin/lockouts")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+
+	resp, err = s.client.R().SetBody(registerReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+}
+
+func (s *AuthSuite) TestConcurrentLoginFailures() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	const attempts = 20
+	codes := make([]int, attempts)
+	g, _ := errgroup.WithContext(s.ctx)
+	for i := range attempts {
+		g.Go(func() error {
+			r, errLogin := s.client.R().
+				SetBody(handler.RegisterRequest{Login: login, Password: rand.Text()}).
+				Post("/api/user/login")
+			if errLogin != nil {
+				return errLogin
+			}
+			codes[i] = r.StatusCode()
+			return nil
+		})
+	}
+	s.Require().NoError(g.Wait())
+
+	var checked int
+	for _, code := range codes {
+		s.Contains([]int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusLocked}, code)
+		if code == http.StatusUnauthorized {
+			checked++
+		}
+	}
+	s.LessOrEqual(checked, 3, "no more passwords are checked than failures are allowed")
+}
+
+func (s *AuthSuite) TestLoginProgressiveDelay() {
+	authCfg := service.DefaultAuthConfig()
+	authCfg.LoginBaseDelay = time.Hour
+	h := handler.HTTPHandler{
+		AuthService:  service.NewAuthService(s.repo, authCfg),
+		OrderService: nil,
+		JWT:          s.jwt,
+		Logger:       slog.Default(),
+		AdminToken:   "",
+	}
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+	client := resty.New().SetBaseURL(srv.URL)
+
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = client.R().SetBody(handler.RegisterRequest{Login: login, Password: rand.Text()}).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode())
+
+	resp, err = client.R().SetBody(registerReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusTooManyRequests, resp.StatusCode())
+	s.NotEmpty(resp.Header().Get("Retry-After"))
+	s.Require().NoError(client.Close())
+}
+
+func (s *AuthSuite) TestChangePassword() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	other := resty.New().SetBaseURL(s.server.URL)
+	resp, err = other.R().SetBody(registerReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	newPassword := rand.Text()
+	resp, err = s.client.R().
+		SetBody(handler.ChangePasswordRequest{OldPassword: rand.Text(), NewPassword: newPassword}).
+		Post("/api/user/password")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode())
+
+	resp, err = s.client.R().
+		SetBody(handler.ChangePasswordRequest{OldPassword: password, NewPassword: newPassword}).
+		Post("/api/user/password")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = s.client.R().Post("/api/user/token/refresh")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode(), "the session the password was changed from must stay active")
+
+	resp, err = other.R().Post("/api/user/token/refresh")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "other sessions must be revoked")
+	s.Require().NoError(other.Close())
+
+	resp, err = s.client.R().SetBody(registerReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode())
+
+	resp, err = s.client.R().
+		SetBody(handler.RegisterRequest{Login: login, Password: newPassword}).
+		Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+}
+
+func (s *AuthSuite) TestBearerToken() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	var tokens handler.TokenResponse
+	resp, err := s.client.R().
+		SetHeader("Accept", "application/json").
+		SetBody(registerReq).
+		SetResult(&tokens).
+		Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal("Bearer "+tokens.AccessToken, resp.Header().Get("Authorization"))
+	s.Equal("Bearer", tokens.TokenType)
+	s.Equal(int(time.Hour.Seconds()), tokens.ExpiresIn)
+	s.NotEmpty(tokens.RefreshToken)
+
+	bare := resty.New().SetBaseURL(s.server.URL)
+	defer func() { s.Require().NoError(bare.Close()) }()
+
+	resp, err = bare.R().Post("/api/user/logout")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode())
+
+	resp, err = bare.R().SetHeader("Authorization", "Basic "+tokens.AccessToken).Get("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "only the Bearer scheme is accepted")
+
+	var refreshed handler.TokenResponse
+	resp, err = bare.R().
+		SetHeader("Accept", "application/json").
+		SetBody(handler.RefreshRequest{RefreshToken: tokens.RefreshToken}).
+		SetResult(&refreshed).
+		Post("/api/user/token/refresh")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.NotEqual(tokens.RefreshToken, refreshed.RefreshToken)
+
+	resp, err = bare.R().SetAuthToken(refreshed.AccessToken).Post("/api/user/logout")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = bare.R().SetAuthToken(refreshed.AccessToken).Post("/api/user/logout")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode())
+}
+
+func (s *AuthSuite) TestAPIKeys() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = s.client.R().Get("/api/user/keys")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+
+	resp, err = s.client.R().
+		SetBody(map[string]any{"name": "pos", "scopes": []string{"no_such_scope"}}).
+		Post("/api/user/keys")
+	s.Require().NoError(err)
+	s.Equal(http.StatusBadRequest, resp.StatusCode())
+
+	var created handler.CreateAPIKeyResponse
+	resp, err = s.client.R().
+		SetBody(handler.CreateAPIKeyRequest{
+			Name:   "pos",
+			Scopes: []domain.APIKeyScope{domain.APIKeyScopeReadOrders},
+		}).
+		SetResult(&created).
+		Post("/api/user/keys")
+	s.Require().NoError(err)
+	s.Equal(http.StatusCreated, resp.StatusCode())
+	s.True(strings.HasPrefix(created.Key, auth.APIKeyPrefix))
+	s.True(strings.HasPrefix(created.Key, created.Prefix))
+
+	var keys []handler.APIKeyResponse
+	resp, err = s.client.R().SetResult(&keys).Get("/api/user/keys")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Require().Len(keys, 1)
+	s.Equal(created.ID, keys[0].ID)
+	s.NotContains(resp.String(), created.Key, "key must be shown only once")
+
+	machine := resty.New().SetBaseURL(s.server.URL).SetAuthToken(created.Key)
+	defer func() { s.Require().NoError(machine.Close()) }()
+
+	resp, err = machine.R().SetHeader("Content-Type", "text/plain").SetBody("12345678903").Post("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode(), "key without upload_orders scope")
+
+	resp, err = machine.R().Get("/api/user/keys")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode(), "keys can't be managed with a key")
+
+	resp, err = s.client.R().Delete("/api/user/keys/" + created.ID.String())
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+
+	resp, err = s.client.R().Delete("/api/user/keys/" + created.ID.String())
+	s.Require().NoError(err)
+	s.Equal(http.StatusNotFound, resp.StatusCode())
+
+	resp, err = machine.R().Post("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "revoked key")
+}
+
+func (s *AuthSuite) TestTOTP() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	var enrollment handler.TOTPEnrollmentResponse
+	resp, err = s.client.R().SetResult(&enrollment).Post("/api/user/2fa/totp")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	s.Require().NoError(err)
+	secret := auth.TOTPSecret(raw)
+
+	var recovery handler.RecoveryCodesResponse
+	resp, err = s.client.R().
+		SetBody(handler.TOTPCodeRequest{Code: secret.Code(time.Now())}).
+		SetResult(&recovery).
+		Post("/api/user/2fa/totp/confirm")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Len(recovery.RecoveryCodes, 10)
+
+	resp, err = s.client.R().Post("/api/user/2fa/totp")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode())
+
+	login2FA := func(code string) *resty.Response {
+		var challenge handler.MFAChallengeResponse
+		resp, err = s.client.R().SetBody(registerReq).SetResult(&challenge).Post("/api/user/login")
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusAccepted, resp.StatusCode())
+		_, err = getAuthCookie(resp.Cookies())
+		s.Require().Error(err, "no session before the second factor")
+		resp, err = s.client.R().
+			SetBody(handler.MFALoginRequest{MFAToken: challenge.MFAToken, Code: code}).
+			Post("/api/user/login/2fa")
+		s.Require().NoError(err)
+		return resp
+	}
+
+	// The confirmation used the current period, the next one is accepted to tolerate clock drift.
+	next := secret.Code(time.Now().Add(30 * time.Second))
+	resp = login2FA(next)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	_, err = getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+
+	resp = login2FA(next)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "totp code must not be replayed")
+
+	resp = login2FA(recovery.RecoveryCodes[0])
+	s.Equal(http.StatusOK, resp.StatusCode())
+	resp = login2FA(recovery.RecoveryCodes[0])
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "recovery codes are single use")
+
+	resp, err = s.client.R().Delete("/api/user/2fa/totp")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode())
+
+	resp, err = s.client.R().SetHeader("X-TOTP-Code", recovery.RecoveryCodes[1]).Delete("/api/user/2fa/totp")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+
+	resp, err = s.client.R().SetBody(registerReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+}
+
+func (s *AuthSuite) TestAdmin() {
+	staffReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(staffReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	cookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	staffClaims, err := s.jwt.Parse(cookie.Value)
+	s.Require().NoError(err)
+	s.Equal(domain.UserRoleUser, staffClaims.Role)
+
+	userReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	user := resty.New().SetBaseURL(s.server.URL)
+	defer func() { s.Require().NoError(user.Close()) }()
+	resp, err = user.R().SetBody(userReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	cookie, err = getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	userClaims, err := s.jwt.Parse(cookie.Value)
+	s.Require().NoError(err)
+	userPath := "/api/admin/users/" + userClaims.UserID.String()
+
+	resp, err = s.client.R().Get("/api/admin/users")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode())
+
+	resp, err = s.client.R().SetHeader("X-Admin-Token", "wrong").Get("/api/admin/users")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode())
+
+	support := domain.UserRoleSupport
+	resp, err = s.client.R().
+		SetHeader("X-Admin-Token", "admin").
+		SetBody(handler.SetUserRoleRequest{Role: &support}).
+		Put("/api/admin/users/" + staffClaims.UserID.String() + "/role")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+
+	resp, err = s.client.R().Get("/api/admin/users")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "role change must end the user's sessions")
+
+	resp, err = s.client.R().SetBody(staffReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	var users []handler.UserResponse
+	resp, err = s.client.R().SetResult(&users).Get("/api/admin/users")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Require().Len(users, 2)
+	s.Equal(domain.UserRoleSupport, users[0].Role)
+
+	resp, err = s.client.R().SetQueryParam("limit", "0").Get("/api/admin/users")
+	s.Require().NoError(err)
+	s.Equal(http.StatusBadRequest, resp.StatusCode())
+
+	var got handler.UserResponse
+	resp, err = s.client.R().SetResult(&got).Get(userPath)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal(userReq.Login, got.Login)
+	s.False(got.Blocked)
+
+	resp, err = s.client.R().Get("/api/admin/users/" + uuid.NewString())
+	s.Require().NoError(err)
+	s.Equal(http.StatusNotFound, resp.StatusCode())
+
+	admin := domain.UserRoleAdmin
+	resp, err = s.client.R().SetBody(handler.SetUserRoleRequest{Role: &admin}).Put(userPath + "/role")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode(), "only admins assign roles")
+
+	resp, err = user.R().Get(userPath)
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode())
+
+	resp, err = s.client.R().Put(userPath + "/block")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+
+	resp, err = user.R().Post("/api/user/token/refresh")
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "blocking must end the user's sessions")
+
+	resp, err = user.R().SetBody(userReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode())
+
+	resp, err = s.client.R().Delete(userPath + "/block")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+
+	resp, err = user.R().SetBody(userReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+}
+
+func (s *AuthSuite) TestSupportCannotBlockStaff() {
+	staffReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(staffReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	cookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	staffClaims, err := s.jwt.Parse(cookie.Value)
+	s.Require().NoError(err)
+
+	adminReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	admin := resty.New().SetBaseURL(s.server.URL)
+	defer func() { s.Require().NoError(admin.Close()) }()
+	resp, err = admin.R().SetBody(adminReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	cookie, err = getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	adminClaims, err := s.jwt.Parse(cookie.Value)
+	s.Require().NoError(err)
+	adminPath := "/api/admin/users/" + adminClaims.UserID.String()
+
+	for id, role := range map[uuid.UUID]domain.UserRole{
+		staffClaims.UserID: domain.UserRoleSupport,
+		adminClaims.UserID: domain.UserRoleAdmin,
+	} {
+		resp, err = s.client.R().
+			SetHeader("X-Admin-Token", "admin").
+			SetBody(handler.SetUserRoleRequest{Role: &role}).
+			Put("/api/admin/users/" + id.String() + "/role")
+		s.Require().NoError(err)
+		s.Equal(http.StatusNoContent, resp.StatusCode())
+	}
+	resp, err = s.client.R().SetBody(staffReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	resp, err = admin.R().SetBody(adminReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = s.client.R().Put(adminPath + "/block")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode(), "support can't block staff")
+	resp, err = admin.R().Get("/api/admin/users")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode(), "the admin's sessions are left alone")
+
+	resp, err = s.client.R().SetHeader("X-Admin-Token", "admin").Put(adminPath + "/block")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+	resp, err = s.client.R().Delete(adminPath + "/block")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode(), "support can't unblock staff")
+}
+
+func (s *AuthSuite) TestSetUserRole() {
+	adminReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(adminReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	cookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	adminClaims, err := s.jwt.Parse(cookie.Value)
+	s.Require().NoError(err)
+	adminPath := "/api/admin/users/" + adminClaims.UserID.String()
+
+	userReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	user := resty.New().SetBaseURL(s.server.URL)
+	defer func() { s.Require().NoError(user.Close()) }()
+	resp, err = user.R().SetBody(userReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	cookie, err = getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	userClaims, err := s.jwt.Parse(cookie.Value)
+	s.Require().NoError(err)
+	userPath := "/api/admin/users/" + userClaims.UserID.String()
+
+	admin := domain.UserRoleAdmin
+	resp, err = s.client.R().
+		SetHeader("X-Admin-Token", "admin").
+		SetBody(handler.SetUserRoleRequest{Role: &admin}).
+		Put(adminPath + "/role")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+	resp, err = s.client.R().SetBody(adminReq).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = s.client.R().SetBody(`{}`).SetContentType("application/json").Put(userPath + "/role")
+	s.Require().NoError(err)
+	s.Equal(http.StatusBadRequest, resp.StatusCode(), "role is mandatory")
+	resp, err = user.R().Get("/api/user/keys")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode(), "a rejected role change leaves the user's sessions alone")
+
+	plain := domain.UserRoleUser
+	resp, err = s.client.R().SetBody(handler.SetUserRoleRequest{Role: &plain}).Put(adminPath + "/role")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "admins can't change their own role")
+	resp, err = s.client.R().Get("/api/admin/users")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode(), "the admin keeps their role")
+}
+
 func getAuthCookie(cookies []*http.Cookie) (*http.Cookie, error) {
-	var authCookie *http.Cookie
+	return getCookie(cookies, "Authorization")
+}
+
+func getCookie(cookies []*http.Cookie, name string) (*http.Cookie, error) {
 	for _, cookie := range cookies {
-		if cookie.Name == "Authorization" {
-			authCookie = cookie
-			break
+		if cookie.Name == name {
+			return cookie, nil
 		}
 	}
-	if authCookie == nil {
-		return nil, errors.New("expected Authorization cookie")
-	}
-	return authCookie, nil
+	return nil, fmt.Errorf("expected %s cookie", name)
 }
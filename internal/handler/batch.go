@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const maxBatchOrders = 1000
+
+var errInvalidBatch = errors.New("invalid batch")
+
+// UploadOrders registers up to maxBatchOrders order numbers sent as a JSON array of strings or as
+// newline-delimited text. The response has the result for every number in the order they were sent.
+func (h *HTTPHandler) UploadOrders(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != "application/json" && contentType != "text/plain") {
+		h.Logger.Debug("invalid content type", slog.String("content_type", r.Header.Get("Content-Type")))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) //nolint: mnd //fine
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		var errTooLarge *http.MaxBytesError
+		if errors.As(err, &errTooLarge) {
+			hErr := http.StatusRequestEntityTooLarge
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		h.Logger.Error("reading request", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	numbers, err := parseBatch(contentType, data)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	if len(numbers) > maxBatchOrders {
+		h.Logger.Debug("batch too large", slog.Int("size", len(numbers)))
+		hErr := http.StatusRequestEntityTooLarge
+		http.Error(w, fmt.Sprintf("at most %d orders per batch", maxBatchOrders), hErr)
+		return
+	}
+	uploads, err := h.OrderService.RegisterOrders(r.Context(), id, numbers)
+	if err != nil {
+		h.Logger.Error("registering orders", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	resp := make([]OrderUploadResponse, 0, len(uploads))
+	for _, i := range uploads {
+		resp = append(resp, OrderUploadResponse{Number: i.Number, Result: i.Result})
+	}
+	data, err = json.Marshal(resp)
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func parseBatch(contentType string, data []byte) ([]string, error) {
+	var numbers []string
+	if contentType == "application/json" {
+		if err := json.Unmarshal(data, &numbers); err != nil {
+			return nil, fmt.Errorf("%w: expected a JSON array of strings: %w", errInvalidBatch, err)
+		}
+		for i := range numbers {
+			numbers[i] = strings.TrimSpace(numbers[i])
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				numbers = append(numbers, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidBatch, err)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("%w: no order numbers", errInvalidBatch)
+	}
+	return numbers, nil
+}
@@ -8,8 +8,13 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"mime"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -20,15 +25,88 @@ import (
 
 type AuthService interface {
 	RegisterUser(ctx context.Context, user domain.User, password string) (uuid.UUID, error)
-	LoginUser(ctx context.Context, login string, password string) (domain.User, error)
+	LoginUser(ctx context.Context, login string, password string, address string) (domain.User, error)
+	UnlockLogin(ctx context.Context, login string, address string) error
+	ChangePassword(
+		ctx context.Context,
+		userID uuid.UUID,
+		sessionID uuid.UUID,
+		oldPassword string,
+		newPassword string,
+		address string,
+	) error
+	StartSession(ctx context.Context, userID uuid.UUID) (domain.Session, auth.RefreshToken, error)
+	RefreshSession(ctx context.Context, token auth.RefreshToken) (domain.Session, auth.RefreshToken, error)
+	EndSession(ctx context.Context, sessionID uuid.UUID) error
+	SessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error)
+	CreateAPIKey(
+		ctx context.Context,
+		userID uuid.UUID,
+		name string,
+		scopes []domain.APIKeyScope,
+	) (domain.APIKey, auth.APIKey, error)
+	GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID) error
+	AuthenticateAPIKey(ctx context.Context, key auth.APIKey) (domain.APIKey, error)
+	EnrollTOTP(ctx context.Context, userID uuid.UUID) (auth.TOTPSecret, string, error)
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]auth.RecoveryCode, error)
+	DisableTOTP(ctx context.Context, userID uuid.UUID, code string, address string) error
+	ChallengeSecondFactor(ctx context.Context, userID uuid.UUID) (auth.MFAToken, bool, error)
+	VerifyMFAChallenge(ctx context.Context, token auth.MFAToken, code string, address string) (uuid.UUID, error)
+	VerifyStepUp(ctx context.Context, userID uuid.UUID, code string, address string) error
+	ListUsers(ctx context.Context, limit int32, offset int32) ([]domain.User, error)
+	GetUser(ctx context.Context, userID uuid.UUID) (domain.User, error)
+	SetUserRole(ctx context.Context, userID uuid.UUID, role domain.UserRole) error
+	BlockUser(ctx context.Context, userID uuid.UUID) error
+	UnblockUser(ctx context.Context, userID uuid.UUID) error
 }
 
 type OrderService interface {
 	RegisterOrder(ctx context.Context, userID uuid.UUID, order string) (uuid.UUID, error)
-	GetOrders(ctx context.Context, userID uuid.UUID) ([]domain.Order, error)
+	RegisterOrders(ctx context.Context, userID uuid.UUID, orders []string) ([]domain.OrderUpload, error)
+	GetOrders(ctx context.Context, userID uuid.UUID, filter domain.ListFilter) ([]domain.Order, error)
+	GetOrder(ctx context.Context, userID uuid.UUID, number domain.OrderNumber) (domain.Order, error)
 	GetBalance(ctx context.Context, userID uuid.UUID) (domain.Balance, error)
 	Withdraw(ctx context.Context, userID uuid.UUID, order string, sum decimal.Decimal) error
-	GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]domain.Withdrawal, error)
+	GetWithdrawals(ctx context.Context, userID uuid.UUID, filter domain.ListFilter) ([]domain.Withdrawal, error)
+	AdjustBalance(ctx context.Context, adj domain.Adjustment) (domain.Adjustment, error)
+	GetAdjustments(ctx context.Context, userID uuid.UUID) ([]domain.Adjustment, error)
+	ReconcileBalances(ctx context.Context) ([]domain.BalanceMismatch, error)
+	GetStatement(ctx context.Context, userID uuid.UUID, filter domain.StatementFilter) ([]domain.StatementEntry, error)
+	BeginIdempotent(ctx context.Context, userID uuid.UUID, key, fingerprint string) (*domain.IdempotentResponse, error)
+	CompleteIdempotent(ctx context.Context, userID uuid.UUID, key string, resp domain.IdempotentResponse) error
+	AbortIdempotent(ctx context.Context, userID uuid.UUID, key string) error
+	HoldWithdrawal(
+		ctx context.Context,
+		userID uuid.UUID,
+		order string,
+		sum decimal.Decimal,
+		ttl time.Duration,
+	) (domain.WithdrawalHold, error)
+	GetHold(ctx context.Context, userID uuid.UUID, holdID uuid.UUID) (domain.WithdrawalHold, error)
+	CaptureHold(ctx context.Context, userID uuid.UUID, holdID uuid.UUID) (domain.WithdrawalHold, error)
+	ReleaseHold(ctx context.Context, userID uuid.UUID, holdID uuid.UUID) (domain.WithdrawalHold, error)
+	ReverseWithdrawal(ctx context.Context, rev domain.WithdrawalReversal) (domain.WithdrawalReversal, bool, error)
+	GetStuckOrders(ctx context.Context, limit int32, offset int32) ([]domain.Order, error)
+	RequeueOrder(ctx context.Context, number domain.OrderNumber) (domain.Order, error)
+}
+
+const (
+	accessCookieName  = "Authorization"
+	refreshCookieName = "Refresh-Token"
+	refreshCookiePath = "/api/user/token"
+	bearerPrefix      = "Bearer "
+	totpCodeHeader    = "X-TOTP-Code"
+	adminTokenHeader  = "X-Admin-Token"
+)
+
+// CookieConfig holds the attributes of the auth cookies.
+// A zero MaxAge makes the access cookie a session cookie.
+type CookieConfig struct {
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+	MaxAge   time.Duration
 }
 
 type HTTPHandler struct {
@@ -36,22 +114,71 @@ type HTTPHandler struct {
 	AuthService  AuthService
 	OrderService OrderService
 	Logger       *slog.Logger
+	Cookies      CookieConfig
+	// WithdrawStepUp requires a TOTP code for large withdrawals from users with two-factor authentication.
+	WithdrawStepUp StepUpConfig
+	// AdminToken, if set, grants admin access to /api/admin routes without a session,
+	// e.g. to appoint the first admin. Routes that record the operator, like balance adjustments and
+	// withdrawal reversals, still need one.
+	AdminToken string
 }
 
 func (h *HTTPHandler) Routes() *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Get("/healthz", h.HealthHandler)
+	r.Get("/.well-known/jwks.json", h.JWKSHandler)
 	r.Post("/api/user/register", h.RegisterHandler)
 	r.Post("/api/user/login", h.LoginHandler)
+	r.Post("/api/user/login/2fa", h.LoginSecondFactor)
+	r.Post("/api/user/token/refresh", h.RefreshHandler)
+
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(h.AdminMiddleware)
+		r.Delete("/lockouts", h.UnlockLogin)
+		r.Get("/reconciliation", h.AdminReconcileBalances)
+		r.Get("/users", h.AdminGetUsers)
+		r.Get("/users/{id}", h.AdminGetUser)
+		r.Get("/users/{id}/orders", h.AdminGetOrders)
+		r.Get("/users/{id}/balance", h.AdminGetBalance)
+		r.Get("/users/{id}/withdrawals", h.AdminGetWithdrawals)
+		r.Get("/users/{id}/adjustments", h.AdminGetAdjustments)
+		r.With(h.RequireSession).Post("/users/{id}/adjustments", h.AdminAdjustBalance)
+		r.With(h.RequireSession).Post("/withdrawals/{order}/reversals", h.AdminReverseWithdrawal)
+		r.Get("/orders/stuck", h.AdminGetStuckOrders)
+		r.Post("/orders/{number}/requeue", h.AdminRequeueOrder)
+		r.Put("/users/{id}/block", h.AdminBlockUser)
+		r.Delete("/users/{id}/block", h.AdminUnblockUser)
+		r.With(h.RequireRole(domain.UserRoleAdmin)).Put("/users/{id}/role", h.AdminSetUserRole)
+	})
 
 	r.Group(func(r chi.Router) {
 		r.Use(h.AuthMiddleware)
-		r.Post("/api/user/orders", h.UploadOrder)
-		r.Get("/api/user/orders", h.GetOrders)
-		r.Get("/api/user/balance", h.GetBalance)
-		r.Post("/api/user/balance/withdraw", h.Withdraw)
-		r.Get("/api/user/withdrawals", h.GetWithdrawals)
+
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequireSession)
+			r.Post("/api/user/logout", h.LogoutHandler)
+			r.Post("/api/user/password", h.ChangePassword)
+			r.Post("/api/user/keys", h.CreateAPIKey)
+			r.Get("/api/user/keys", h.GetAPIKeys)
+			r.Delete("/api/user/keys/{id}", h.RevokeAPIKey)
+			r.Post("/api/user/2fa/totp", h.EnrollTOTP)
+			r.Post("/api/user/2fa/totp/confirm", h.ConfirmTOTP)
+			r.Delete("/api/user/2fa/totp", h.DisableTOTP)
+		})
+
+		r.With(h.RequireScope(domain.APIKeyScopeUploadOrders)).Post("/api/user/orders", h.UploadOrder)
+		r.With(h.RequireScope(domain.APIKeyScopeUploadOrders)).Post("/api/user/orders/batch", h.UploadOrders)
+		r.With(h.RequireScope(domain.APIKeyScopeReadOrders)).Get("/api/user/orders", h.GetOrders)
+		r.With(h.RequireScope(domain.APIKeyScopeReadOrders)).Get("/api/user/orders/{number}", h.GetOrder)
+		r.With(h.RequireScope(domain.APIKeyScopeReadBalance)).Get("/api/user/balance", h.GetBalance)
+		r.With(h.RequireScope(domain.APIKeyScopeWithdraw), h.Idempotent).Post("/api/user/balance/withdraw", h.Withdraw)
+		r.With(h.RequireScope(domain.APIKeyScopeWithdraw), h.Idempotent).Post("/api/user/balance/holds", h.CreateHold)
+		r.With(h.RequireScope(domain.APIKeyScopeReadBalance)).Get("/api/user/balance/holds/{id}", h.GetHold)
+		r.With(h.RequireScope(domain.APIKeyScopeWithdraw)).Post("/api/user/balance/holds/{id}/capture", h.CaptureHold)
+		r.With(h.RequireScope(domain.APIKeyScopeWithdraw)).Post("/api/user/balance/holds/{id}/release", h.ReleaseHold)
+		r.With(h.RequireScope(domain.APIKeyScopeReadBalance)).Get("/api/user/withdrawals", h.GetWithdrawals)
+		r.With(h.RequireScope(domain.APIKeyScopeReadBalance)).Get("/api/user/statement", h.GetStatement)
 	})
 
 	return r
@@ -69,6 +196,21 @@ func (h *HTTPHandler) HealthHandler(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write(data)
 }
+
+func (h *HTTPHandler) JWKSHandler(w http.ResponseWriter, _ *http.Request) {
+	data, err := json.Marshal(h.JWT.JWKS())
+	if err != nil {
+		h.Logger.Error("encoding jwks", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
 func (h *HTTPHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
@@ -92,19 +234,24 @@ func (h *HTTPHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, http.StatusText(hErr), hErr)
 			return
 		}
+		if errors.Is(err, domain.ErrWeakPassword) {
+			h.Logger.Debug("register user", slog.Any("error", err))
+			hErr := http.StatusBadRequest
+			http.Error(w, err.Error(), hErr)
+			return
+		}
 		h.Logger.Error("register user", slog.Any("error", err))
 		hErr := http.StatusInternalServerError
 		http.Error(w, http.StatusText(hErr), hErr)
 		return
 	}
-	err = h.SetCookie(w, id)
+	err = h.startSession(w, r, id)
 	if err != nil {
-		h.Logger.Error("issuing jwt", slog.Any("error", err))
+		h.Logger.Error("starting session", slog.Any("error", err))
 		hErr := http.StatusInternalServerError
 		http.Error(w, http.StatusText(hErr), hErr)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
 }
 
 func (h *HTTPHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -122,7 +269,7 @@ func (h *HTTPHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(hErr), hErr)
 		return
 	}
-	user, err := h.AuthService.LoginUser(r.Context(), req.Login, req.Password)
+	user, err := h.AuthService.LoginUser(r.Context(), req.Login, req.Password, clientAddress(r))
 	if err != nil {
 		if errors.Is(err, domain.ErrInvalidCredentials) {
 			h.Logger.Debug("login user", slog.Any("error", err))
@@ -130,33 +277,310 @@ func (h *HTTPHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, http.StatusText(hErr), hErr)
 			return
 		}
+		if errors.Is(err, domain.ErrUserBlocked) {
+			h.Logger.Info("blocked user login", slog.String("login", req.Login))
+			hErr := http.StatusForbidden
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		if h.writeThrottled(w, err) {
+			h.Logger.Info("login throttled", slog.String("login", req.Login), slog.Any("error", err))
+			return
+		}
 		h.Logger.Error("login user", slog.Any("error", err))
 		hErr := http.StatusInternalServerError
 		http.Error(w, http.StatusText(hErr), hErr)
 		return
 	}
-	err = h.SetCookie(w, user.ID)
+	mfaToken, required, err := h.AuthService.ChallengeSecondFactor(r.Context(), user.ID)
+	if err != nil {
+		h.Logger.Error("challenging second factor", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if required {
+		h.writeMFAChallenge(w, mfaToken)
+		return
+	}
+	err = h.startSession(w, r, user.ID)
+	if err != nil {
+		h.Logger.Error("starting session", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+}
+
+func (h *HTTPHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	refresh, err := refreshTokenFromRequest(r)
+	if err != nil {
+		h.Logger.Debug("reading refresh token", slog.Any("error", err))
+		hErr := http.StatusUnauthorized
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	session, token, err := h.AuthService.RefreshSession(r.Context(), refresh)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRefreshToken) ||
+			errors.Is(err, domain.ErrRefreshTokenReused) ||
+			errors.Is(err, domain.ErrSessionRevoked) {
+			h.Logger.Debug("refresh session", slog.Any("error", err))
+			h.clearCookies(w)
+			hErr := http.StatusUnauthorized
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		h.Logger.Error("refresh session", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	err = h.writeSession(w, r, session, token)
 	if err != nil {
 		h.Logger.Error("issuing jwt", slog.Any("error", err))
 		hErr := http.StatusInternalServerError
 		http.Error(w, http.StatusText(hErr), hErr)
 		return
 	}
+}
+
+func (h *HTTPHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := SessionIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	err := h.AuthService.EndSession(r.Context(), sessionID)
+	if err != nil {
+		h.Logger.Error("ending session", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	h.clearCookies(w)
 	w.WriteHeader(http.StatusOK)
 }
 
-func (h *HTTPHandler) SetCookie(w http.ResponseWriter, id uuid.UUID) error {
-	token, err := h.JWT.Issue(id)
+func (h *HTTPHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	sessionID, _ := SessionIDFromContext(r.Context())
+	var req ChangePasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if err = req.Validate(); err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	err = h.AuthService.ChangePassword(r.Context(), id, sessionID, req.OldPassword, req.NewPassword, clientAddress(r))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCredentials) {
+			h.Logger.Debug("change password", slog.Any("error", err))
+			hErr := http.StatusForbidden
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		if errors.Is(err, domain.ErrWeakPassword) {
+			h.Logger.Debug("change password", slog.Any("error", err))
+			hErr := http.StatusBadRequest
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		if h.writeThrottled(w, err) {
+			h.Logger.Info("change password throttled", slog.String("user_id", id.String()), slog.Any("error", err))
+			return
+		}
+		h.Logger.Error("change password", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// UnlockLogin lifts a lockout for ?login= and/or ?address= before it expires.
+func (h *HTTPHandler) UnlockLogin(w http.ResponseWriter, r *http.Request) {
+	login, address := r.URL.Query().Get("login"), r.URL.Query().Get("address")
+	if login == "" && address == "" {
+		h.Logger.Debug("unlock: neither login nor address given")
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if err := h.AuthService.UnlockLogin(r.Context(), login, address); err != nil {
+		h.Logger.Error("unlocking login", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	h.Logger.Info("login unlocked", slog.String("login", login), slog.String("address", address))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPHandler) startSession(w http.ResponseWriter, r *http.Request, userID uuid.UUID) error {
+	session, token, err := h.AuthService.StartSession(r.Context(), userID)
+	if err != nil {
+		return fmt.Errorf("starting session: %w", err)
+	}
+	return h.writeSession(w, r, session, token)
+}
+
+// writeSession issues an access token for the session and hands both tokens to the client:
+// as cookies, the access token in the Authorization header and, if the client accepts JSON, in the body.
+func (h *HTTPHandler) writeSession(
+	w http.ResponseWriter,
+	r *http.Request,
+	session domain.Session,
+	refresh auth.RefreshToken,
+) error {
+	token, err := h.JWT.Issue(auth.Claims{UserID: session.UserID, SessionID: session.ID, Role: session.Role})
 	if err != nil {
 		return fmt.Errorf("issuing jwt: %w", err)
 	}
+	h.setCookies(w, token, session, refresh)
+	w.Header().Set("Authorization", bearerPrefix+token)
+	if !acceptsJSON(r) {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	data, err := json.Marshal(TokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(h.JWT.TTL().Seconds()),
+		RefreshToken: string(refresh),
+	})
+	if err != nil {
+		return fmt.Errorf("encoding token response: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+	return nil
+}
+
+// setCookies sets a short-lived access token and a refresh token scoped to the refresh endpoint.
+func (h *HTTPHandler) setCookies(
+	w http.ResponseWriter,
+	token string,
+	session domain.Session,
+	refresh auth.RefreshToken,
+) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     "Authorization",
+		Name:     accessCookieName,
 		Value:    token,
 		Path:     "/",
+		Domain:   h.Cookies.Domain,
+		MaxAge:   int(h.Cookies.MaxAge.Seconds()),
+		Secure:   h.Cookies.Secure,
 		HttpOnly: true,
+		SameSite: h.Cookies.SameSite,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    string(refresh),
+		Path:     refreshCookiePath,
+		Domain:   h.Cookies.Domain,
+		Expires:  session.ExpiresAt,
+		Secure:   h.Cookies.Secure,
+		HttpOnly: true,
+		SameSite: h.Cookies.SameSite,
+	})
+}
+
+// refreshTokenFromRequest reads the refresh token from the JSON body, falling back to the cookie.
+func refreshTokenFromRequest(r *http.Request) (auth.RefreshToken, error) {
+	var req RefreshRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("decoding refresh request: %w", err)
+	}
+	if req.RefreshToken != "" {
+		return auth.RefreshToken(req.RefreshToken), nil
+	}
+	cookie, err := r.Cookie(refreshCookieName)
+	if err != nil {
+		return "", fmt.Errorf("reading refresh cookie: %w", err)
+	}
+	return auth.RefreshToken(cookie.Value), nil
+}
+
+// acceptsJSON reports whether the client explicitly asked for a JSON response.
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for part := range strings.SplitSeq(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(part)
+			if err == nil && mediaType == "application/json" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeThrottled responds with 429 or 423 if err is a login throttling error.
+func (h *HTTPHandler) writeThrottled(w http.ResponseWriter, err error) bool {
+	var errThrottled domain.LoginThrottledError
+	if errors.As(err, &errThrottled) {
+		setRetryAfter(w, errThrottled.RetryAfter)
+		hErr := http.StatusTooManyRequests
+		http.Error(w, http.StatusText(hErr), hErr)
+		return true
+	}
+	var errLocked domain.AccountLockedError
+	if errors.As(err, &errLocked) {
+		setRetryAfter(w, errLocked.RetryAfter)
+		hErr := http.StatusLocked
+		http.Error(w, http.StatusText(hErr), hErr)
+		return true
+	}
+	return false
+}
+
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+func (h *HTTPHandler) clearCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessCookieName,
+		Value:    "",
+		Path:     "/",
+		Domain:   h.Cookies.Domain,
+		MaxAge:   -1,
+		Secure:   h.Cookies.Secure,
+		HttpOnly: true,
+		SameSite: h.Cookies.SameSite,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    "",
+		Path:     refreshCookiePath,
+		Domain:   h.Cookies.Domain,
+		MaxAge:   -1,
+		Secure:   h.Cookies.Secure,
+		HttpOnly: true,
+		SameSite: h.Cookies.SameSite,
 	})
-	return nil
 }
 
 func (h *HTTPHandler) UploadOrder(w http.ResponseWriter, r *http.Request) {
@@ -198,7 +622,7 @@ func (h *HTTPHandler) UploadOrder(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		if errors.Is(err, domain.ErrOrderOwnedByAnotherUser) {
+		if errors.Is(err, domain.ErrOrderOwnedByAnotherUser) || errors.Is(err, domain.ErrWithdrawalOrderUsed) {
 			w.WriteHeader(http.StatusConflict)
 			return
 		}
@@ -216,13 +640,29 @@ func (h *HTTPHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
-	orders, err := h.OrderService.GetOrders(r.Context(), id)
+	h.writeOrders(w, r, id)
+}
+
+// writeOrders lists the user's orders. See listFilter for filtering and pagination.
+func (h *HTTPHandler) writeOrders(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	filter, paginated, err := listFilter(r, true)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	orders, err := h.OrderService.GetOrders(r.Context(), id, filter)
 	if err != nil {
 		h.Logger.Error("getting orders", slog.Any("error", err))
 		hErr := http.StatusInternalServerError
 		http.Error(w, http.StatusText(hErr), hErr)
 		return
 	}
+	if paginated && len(orders) == int(filter.Limit) {
+		last := orders[len(orders)-1]
+		setNextLink(w, r, domain.ListCursor{Time: last.UploadedAt, Key: string(last.Number)})
+	}
 	if len(orders) == 0 {
 		h.Logger.Debug("no orders")
 		w.WriteHeader(http.StatusNoContent)
@@ -232,7 +672,7 @@ func (h *HTTPHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
 	for _, i := range orders {
 		resp = append(resp, OrderResponse{
 			Number:     i.Number,
-			Status:     i.Status,
+			Status:     i.Status.Public(),
 			Accrual:    Money(i.Accrual),
 			UploadedAt: i.UploadedAt,
 		})
@@ -249,12 +689,57 @@ func (h *HTTPHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(data)
 }
 
+// GetOrder returns one of the user's orders. Orders of other users are reported as not found so that
+// order numbers can't be probed.
+func (h *HTTPHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	number := domain.OrderNumber(chi.URLParam(r, "number"))
+	order, err := h.OrderService.GetOrder(r.Context(), id, number)
+	if err != nil {
+		if errors.Is(err, domain.ErrOrderNotFound) {
+			h.Logger.Debug("order not found", slog.String("order", string(number)))
+			http.NotFound(w, r)
+			return
+		}
+		h.Logger.Error("getting order", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	data, err := json.Marshal(OrderDetailsResponse{
+		OrderResponse: OrderResponse{
+			Number:     order.Number,
+			Status:     order.Status.Public(),
+			Accrual:    Money(order.Accrual),
+			UploadedAt: order.UploadedAt,
+		},
+		CheckedAt: order.CheckedAt,
+	})
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
 func (h *HTTPHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	id, ok := UserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
+	h.writeBalance(w, r, id)
+}
+
+func (h *HTTPHandler) writeBalance(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
 	balance, err := h.OrderService.GetBalance(r.Context(), id)
 	if err != nil {
 		h.Logger.Error("getting balance", slog.Any("error", err))
@@ -263,8 +748,16 @@ func (h *HTTPHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	balanceResponse := BalanceResponse{
-		Current:   Money(balance.Current),
-		Withdrawn: Money(balance.Withdrawn),
+		Current:      Money(balance.Current),
+		Withdrawn:    Money(balance.Withdrawn),
+		Held:         Money(balance.Held),
+		ExpiringSoon: make([]ExpiringPointsResponse, 0, len(balance.ExpiringSoon)),
+	}
+	for _, i := range balance.ExpiringSoon {
+		balanceResponse.ExpiringSoon = append(balanceResponse.ExpiringSoon, ExpiringPointsResponse{
+			Sum:       Money(i.Sum),
+			ExpiresAt: i.ExpiresAt,
+		})
 	}
 	data, err := json.Marshal(balanceResponse)
 	if err != nil {
@@ -292,6 +785,9 @@ func (h *HTTPHandler) Withdraw(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(hErr), hErr)
 		return
 	}
+	if !h.checkStepUp(w, r, id, decimal.Decimal(req.Sum)) {
+		return
+	}
 	err = h.OrderService.Withdraw(r.Context(), id, req.Order, decimal.Decimal(req.Sum))
 	if err != nil {
 		if errors.Is(err, domain.ErrMalformedOrderNumber) {
@@ -300,12 +796,24 @@ func (h *HTTPHandler) Withdraw(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, http.StatusText(hErr), hErr)
 			return
 		}
+		if errors.Is(err, domain.ErrBalanceInDebt) {
+			h.Logger.Debug("balance in debt", slog.Any("error", err))
+			hErr := http.StatusPaymentRequired
+			http.Error(w, err.Error(), hErr)
+			return
+		}
 		if errors.Is(err, domain.ErrNotEnoughFunds) {
 			h.Logger.Debug("not enough funds", slog.Any("error", err))
 			hErr := http.StatusPaymentRequired
 			http.Error(w, http.StatusText(hErr), hErr)
 			return
 		}
+		if errors.Is(err, domain.ErrWithdrawalOrderUsed) || errors.Is(err, domain.ErrWithdrawalOrderUploaded) {
+			h.Logger.Debug("withdrawal order number taken", slog.Any("error", err))
+			hErr := http.StatusConflict
+			http.Error(w, err.Error(), hErr)
+			return
+		}
 		h.Logger.Error("", slog.Any("error", err))
 		hErr := http.StatusInternalServerError
 		http.Error(w, http.StatusText(hErr), hErr)
@@ -320,13 +828,35 @@ func (h *HTTPHandler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
-	withdrawals, err := h.OrderService.GetWithdrawals(r.Context(), id)
+	h.writeWithdrawals(w, r, id)
+}
+
+// writeWithdrawals lists the user's withdrawals. See listFilter for filtering and pagination.
+func (h *HTTPHandler) writeWithdrawals(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	filter, paginated, err := listFilter(r, false)
 	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	withdrawals, err := h.OrderService.GetWithdrawals(r.Context(), id, filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCursor) {
+			h.Logger.Debug("bad request", slog.Any("error", err))
+			hErr := http.StatusBadRequest
+			http.Error(w, err.Error(), hErr)
+			return
+		}
 		h.Logger.Error("getting withdrawals", slog.Any("error", err))
 		hErr := http.StatusInternalServerError
 		http.Error(w, http.StatusText(hErr), hErr)
 		return
 	}
+	if paginated && len(withdrawals) == int(filter.Limit) {
+		last := withdrawals[len(withdrawals)-1]
+		setNextLink(w, r, domain.ListCursor{Time: last.ProcessedAt, Key: last.ID.String()})
+	}
 	if len(withdrawals) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return
@@ -336,6 +866,8 @@ func (h *HTTPHandler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 		withdrawalResponse = append(withdrawalResponse, WithdrawalsResponse{
 			Order:       i.Order,
 			Sum:         Money(i.Sum),
+			Status:      i.Status(),
+			Reversed:    Money(i.Reversed),
 			ProcessedAt: i.ProcessedAt,
 		})
 	}
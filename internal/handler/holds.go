@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// CreateHold reserves points for an order until the hold is captured or released. Held points can't be
+// withdrawn or held again, and are given back when the hold expires.
+func (h *HTTPHandler) CreateHold(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	var req HoldRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if err = req.Validate(); err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	if !h.checkStepUp(w, r, id, decimal.Decimal(req.Sum)) {
+		return
+	}
+	ttl := time.Duration(req.ExpiresIn) * time.Second
+	hold, err := h.OrderService.HoldWithdrawal(r.Context(), id, req.Order, decimal.Decimal(req.Sum), ttl)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidHoldTTL) {
+			h.Logger.Debug("bad request", slog.Any("error", err))
+			hErr := http.StatusBadRequest
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		if errors.Is(err, domain.ErrMalformedOrderNumber) {
+			h.Logger.Debug("malformed order number", slog.Any("error", err))
+			hErr := http.StatusUnprocessableEntity
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		if errors.Is(err, domain.ErrBalanceInDebt) {
+			h.Logger.Debug("balance in debt", slog.Any("error", err))
+			hErr := http.StatusPaymentRequired
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		if errors.Is(err, domain.ErrNotEnoughFunds) {
+			h.Logger.Debug("not enough funds", slog.Any("error", err))
+			hErr := http.StatusPaymentRequired
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		if errors.Is(err, domain.ErrWithdrawalOrderUsed) || errors.Is(err, domain.ErrWithdrawalOrderUploaded) {
+			h.Logger.Debug("withdrawal order number taken", slog.Any("error", err))
+			hErr := http.StatusConflict
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		h.Logger.Error("holding withdrawal", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	h.writeHold(w, hold, http.StatusCreated)
+}
+
+func (h *HTTPHandler) GetHold(w http.ResponseWriter, r *http.Request) {
+	h.holdAction(w, r, "getting hold", h.OrderService.GetHold)
+}
+
+// CaptureHold spends the held points as a withdrawal. Capturing a captured hold again responds with it as is.
+func (h *HTTPHandler) CaptureHold(w http.ResponseWriter, r *http.Request) {
+	h.holdAction(w, r, "capturing hold", h.OrderService.CaptureHold)
+}
+
+// ReleaseHold gives the held points back. Releasing a released or expired hold again responds with it as is.
+func (h *HTTPHandler) ReleaseHold(w http.ResponseWriter, r *http.Request) {
+	h.holdAction(w, r, "releasing hold", h.OrderService.ReleaseHold)
+}
+
+// holdAction applies op to the hold in the URL and responds with the resulting hold.
+func (h *HTTPHandler) holdAction(
+	w http.ResponseWriter,
+	r *http.Request,
+	msg string,
+	op func(ctx context.Context, userID uuid.UUID, holdID uuid.UUID) (domain.WithdrawalHold, error),
+) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	holdID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	hold, err := op(r.Context(), id, holdID)
+	if err != nil {
+		if errors.Is(err, domain.ErrHoldNotFound) {
+			h.Logger.Debug(msg, slog.Any("error", err))
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, domain.ErrHoldExpired) ||
+			errors.Is(err, domain.ErrHoldSettled) ||
+			errors.Is(err, domain.ErrWithdrawalOrderUsed) {
+			h.Logger.Debug(msg, slog.Any("error", err))
+			hErr := http.StatusConflict
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		if errors.Is(err, domain.ErrBalanceInDebt) {
+			h.Logger.Debug(msg, slog.Any("error", err))
+			hErr := http.StatusPaymentRequired
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		h.Logger.Error(msg, slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	h.writeHold(w, hold, http.StatusOK)
+}
+
+func (h *HTTPHandler) writeHold(w http.ResponseWriter, hold domain.WithdrawalHold, status int) {
+	data, err := json.Marshal(HoldResponse{
+		ID:        hold.ID,
+		Order:     hold.Order,
+		Sum:       Money(hold.Sum),
+		Status:    hold.Status,
+		ExpiresAt: hold.ExpiresAt,
+		CreatedAt: hold.CreatedAt,
+		SettledAt: hold.SettledAt,
+	})
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	replayedHeader       = "Idempotent-Replayed"
+	maxIdempotencyKeyLen = 255
+)
+
+// Idempotent makes retries of a request with the same Idempotency-Key header replay the original response
+// instead of repeating the request. Reusing a key for a different request, or while the first one is still
+// being handled, is a conflict. Responses that don't settle the request, such as server errors or a missing
+// second factor, aren't remembered so that the request can be retried. Requests without the header pass through.
+func (h *HTTPHandler) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, ok := UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			hErr := http.StatusBadRequest
+			http.Error(w, "idempotency key is too long", hErr)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20) //nolint: mnd //fine
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.Logger.Debug("reading request", slog.Any("error", err))
+			hErr := http.StatusBadRequest
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		stored, err := h.OrderService.BeginIdempotent(r.Context(), id, key, fingerprint(r, body))
+		if err != nil {
+			if errors.Is(err, domain.ErrIdempotencyKeyReused) || errors.Is(err, domain.ErrIdempotencyKeyInProgress) {
+				h.Logger.Debug("idempotency key conflict", slog.Any("error", err))
+				hErr := http.StatusConflict
+				http.Error(w, err.Error(), hErr)
+				return
+			}
+			h.Logger.Error("beginning idempotent request", slog.Any("error", err))
+			hErr := http.StatusInternalServerError
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		if stored != nil {
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+			w.Header().Set(replayedHeader, "true")
+			w.WriteHeader(stored.StatusCode)
+			_, _ = w.Write(stored.Body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: 0, body: bytes.Buffer{}}
+		next.ServeHTTP(rec, r)
+
+		// The outcome must be recorded even if the client has gone away, it is what a retry should see.
+		ctx := context.WithoutCancel(r.Context())
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if !settled(rec.status) {
+			if err = h.OrderService.AbortIdempotent(ctx, id, key); err != nil {
+				h.Logger.Error("aborting idempotent request", slog.Any("error", err))
+			}
+			return
+		}
+		err = h.OrderService.CompleteIdempotent(ctx, id, key, domain.IdempotentResponse{
+			StatusCode:  rec.status,
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body.Bytes(),
+		})
+		if err != nil {
+			h.Logger.Error("completing idempotent request", slog.Any("error", err))
+		}
+	})
+}
+
+// settled reports whether a response is the final outcome of the request rather than a failure to handle it.
+func settled(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return status < http.StatusInternalServerError
+}
+
+// fingerprint identifies a request so that a key reused for a different one can be told apart from a retry.
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping a copy of its status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b) //nolint: wrapcheck //passthrough
+}
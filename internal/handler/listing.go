@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+var errInvalidListQuery = errors.New("invalid list query")
+
+// listFilter parses the query of order and withdrawal listings: ?status= (orders only, comma-separated),
+// RFC 3339 ?from= (inclusive) and ?to= (exclusive), ?sort=asc|desc and ?limit= with ?cursor=. Lists are
+// paginated only when a limit or a cursor is given so that the plain request returns everything as
+// the specification requires.
+func listFilter(r *http.Request, withStatus bool) (domain.ListFilter, bool, error) {
+	query := r.URL.Query()
+	filter := domain.ListFilter{
+		Statuses:  nil,
+		From:      time.Time{},
+		To:        time.Time{},
+		Ascending: false,
+		After:     domain.ListCursor{Time: time.Time{}, Key: ""},
+		Limit:     0,
+	}
+	if v := query.Get("status"); v != "" {
+		if !withStatus {
+			return filter, false, fmt.Errorf("%w: status filter is not supported", errInvalidListQuery)
+		}
+		for _, i := range strings.Split(v, ",") {
+			status, err := domain.ParseOrderStatus(strings.TrimSpace(i))
+			if err != nil || status != status.Public() {
+				return filter, false, fmt.Errorf("%w: unknown status %q", errInvalidListQuery, i)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+			if status == domain.OrderStatusPROCESSING {
+				// Stuck orders are shown as processing.
+				filter.Statuses = append(filter.Statuses, domain.OrderStatusSTUCK)
+			}
+		}
+	}
+	var err error
+	if v := query.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, false, fmt.Errorf("%w: from must be an RFC 3339 time", errInvalidListQuery)
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, false, fmt.Errorf("%w: to must be an RFC 3339 time", errInvalidListQuery)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, false, fmt.Errorf("%w: from must be before to", errInvalidListQuery)
+	}
+	switch query.Get("sort") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, false, fmt.Errorf("%w: sort must be asc or desc", errInvalidListQuery)
+	}
+	limit, cursor := query.Get("limit"), query.Get("cursor")
+	if limit == "" && cursor == "" {
+		return filter, false, nil
+	}
+	filter.Limit = defaultListLimit
+	if limit != "" {
+		var n int64
+		if n, err = strconv.ParseInt(limit, 10, 32); err != nil || n < 1 || n > maxListLimit {
+			return filter, false, fmt.Errorf("%w: limit must be between 1 and %d", errInvalidListQuery, maxListLimit)
+		}
+		filter.Limit = int32(n)
+	}
+	if cursor != "" {
+		if filter.After, err = decodeListCursor(cursor); err != nil {
+			return filter, false, fmt.Errorf("%w: %w", errInvalidListQuery, err)
+		}
+	}
+	return filter, true, nil
+}
+
+// setNextLink points the client to the page after the given position with a Link header.
+func setNextLink(w http.ResponseWriter, r *http.Request, after domain.ListCursor) {
+	query := r.URL.Query()
+	query.Set("cursor", encodeCursor(after.Time.Format(time.RFC3339Nano)+" "+after.Key))
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, query.Encode()))
+}
+
+func decodeListCursor(cursor string) (domain.ListCursor, error) {
+	raw, err := decodeCursor(cursor)
+	if err != nil {
+		return domain.ListCursor{}, err
+	}
+	t, key, ok := strings.Cut(raw, " ")
+	if !ok || key == "" {
+		return domain.ListCursor{}, domain.ErrInvalidCursor
+	}
+	after, err := time.Parse(time.RFC3339Nano, t)
+	if err != nil {
+		return domain.ListCursor{}, domain.ErrInvalidCursor
+	}
+	return domain.ListCursor{Time: after, Key: key}, nil
+}
+
+// encodeCursor makes a pagination position opaque to clients so its format can change.
+func encodeCursor(raw string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", domain.ErrInvalidCursor
+	}
+	return string(raw), nil
+}
@@ -2,18 +2,29 @@ package handler
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/ttl256/gophermart-loyalty/internal/auth"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
 )
 
 type ctxKey int
 
 const (
 	userIDKey ctxKey = iota
+	sessionIDKey
+	apiKeyKey
+	roleKey
 )
 
+// AuthMiddleware authenticates requests with a session access token or an API key.
+// API key requests carry no session, see RequireSession and RequireScope.
 func (h *HTTPHandler) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if h.JWT == nil {
@@ -22,21 +33,164 @@ func (h *HTTPHandler) AuthMiddleware(next http.Handler) http.Handler {
 			http.Error(w, http.StatusText(hErr), hErr)
 			return
 		}
-		cookie, err := r.Cookie("Authorization")
-		if err != nil {
+		token, ok := accessToken(r)
+		if !ok {
 			hErr := http.StatusUnauthorized
 			http.Error(w, http.StatusText(hErr), hErr)
 			return
 		}
-		id, err := h.JWT.Parse(cookie.Value)
-		if err != nil {
-			h.Logger.Debug("parsing jwt", slog.Any("error", err))
+		var ctx context.Context
+		if auth.IsAPIKey(token) {
+			ctx, ok = h.authenticateAPIKey(w, r, auth.APIKey(token))
+		} else {
+			ctx, ok = h.authenticateSession(w, r, token)
+		}
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (h *HTTPHandler) authenticateSession(
+	w http.ResponseWriter,
+	r *http.Request,
+	token string,
+) (context.Context, bool) {
+	claims, err := h.JWT.Parse(token)
+	if err != nil {
+		h.Logger.Debug("parsing jwt", slog.Any("error", err))
+		hErr := http.StatusUnauthorized
+		http.Error(w, http.StatusText(hErr), hErr)
+		return nil, false
+	}
+	active, err := h.AuthService.SessionActive(r.Context(), claims.SessionID)
+	if err != nil {
+		h.Logger.Error("checking session", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return nil, false
+	}
+	if !active {
+		h.Logger.Debug("session revoked", slog.String("session_id", claims.SessionID.String()))
+		hErr := http.StatusUnauthorized
+		http.Error(w, http.StatusText(hErr), hErr)
+		return nil, false
+	}
+	ctx := context.WithValue(r.Context(), userIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, sessionIDKey, claims.SessionID)
+	ctx = context.WithValue(ctx, roleKey, claims.Role)
+	return ctx, true
+}
+
+func (h *HTTPHandler) authenticateAPIKey(
+	w http.ResponseWriter,
+	r *http.Request,
+	secret auth.APIKey,
+) (context.Context, bool) {
+	key, err := h.AuthService.AuthenticateAPIKey(r.Context(), secret)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAPIKey) {
+			h.Logger.Debug("authenticating api key", slog.Any("error", err))
 			hErr := http.StatusUnauthorized
 			http.Error(w, http.StatusText(hErr), hErr)
+			return nil, false
+		}
+		h.Logger.Error("authenticating api key", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return nil, false
+	}
+	ctx := context.WithValue(r.Context(), userIDKey, key.UserID)
+	ctx = context.WithValue(ctx, apiKeyKey, key)
+	return ctx, true
+}
+
+// RequireSession rejects requests authenticated with an API key.
+func (h *HTTPHandler) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := SessionIDFromContext(r.Context()); !ok {
+			hErr := http.StatusForbidden
+			http.Error(w, http.StatusText(hErr), hErr)
 			return
 		}
-		ctx := context.WithValue(r.Context(), userIDKey, id)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope rejects requests authenticated with an API key lacking scope. Sessions are not limited.
+func (h *HTTPHandler) RequireScope(scope domain.APIKeyScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key, ok := APIKeyFromContext(r.Context()); ok && !key.HasScope(scope) {
+				h.Logger.Debug(
+					"api key scope missing",
+					slog.String("key_id", key.ID.String()),
+					slog.String("scope", scope.String()),
+				)
+				hErr := http.StatusForbidden
+				http.Error(w, http.StatusText(hErr), hErr)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole rejects requests from anyone but sessions of users with one of roles.
+func (h *HTTPHandler) RequireRole(roles ...domain.UserRole) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, ok := RoleFromContext(r.Context())
+			if !ok || !slices.Contains(roles, role) {
+				userID, _ := UserIDFromContext(r.Context())
+				h.Logger.Info(
+					"insufficient role",
+					slog.String("user_id", userID.String()),
+					slog.String("path", r.URL.Path),
+				)
+				hErr := http.StatusForbidden
+				http.Error(w, http.StatusText(hErr), hErr)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// accessToken reads the access token from the Authorization header, falling back to the cookie.
+func accessToken(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, strings.TrimSpace(bearerPrefix)) || token == "" {
+			return "", false
+		}
+		return token, true
+	}
+	cookie, err := r.Cookie(accessCookieName)
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// AdminMiddleware admits sessions of support staff and admins, or requests carrying AdminToken,
+// which are treated as made by an admin.
+func (h *HTTPHandler) AdminMiddleware(next http.Handler) http.Handler {
+	staff := h.AuthMiddleware(h.RequireSession(h.RequireRole(domain.UserRoleSupport, domain.UserRoleAdmin)(next)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(adminTokenHeader)
+		if token == "" {
+			staff.ServeHTTP(w, r)
+			return
+		}
+		if h.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) != 1 {
+			h.Logger.Info("admin request rejected", slog.String("address", clientAddress(r)))
+			hErr := http.StatusUnauthorized
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), roleKey, domain.UserRoleAdmin)))
 	})
 }
 
@@ -45,3 +199,23 @@ func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
 	id, ok := v.(uuid.UUID)
 	return id, ok
 }
+
+func SessionIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	v := ctx.Value(sessionIDKey)
+	id, ok := v.(uuid.UUID)
+	return id, ok
+}
+
+// RoleFromContext returns the role of a session. Requests authenticated otherwise carry none,
+// except for the admin token.
+func RoleFromContext(ctx context.Context) (domain.UserRole, bool) {
+	v := ctx.Value(roleKey)
+	role, ok := v.(domain.UserRole)
+	return role, ok
+}
+
+func APIKeyFromContext(ctx context.Context) (domain.APIKey, bool) {
+	v := ctx.Value(apiKeyKey)
+	key, ok := v.(domain.APIKey)
+	return key, ok
+}
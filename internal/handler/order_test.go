@@ -3,14 +3,18 @@ package handler_test
 import (
 	"context"
 	"crypto/rand"
+	"encoding/base32"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/suite"
@@ -62,16 +66,27 @@ func (s *OrderSuite) SetupSuite() {
 	s.pool, err = pgxpool.New(s.ctx, s.pg.DSN)
 	s.Require().NoError(err)
 
-	authSvc := service.NewAuthService(repo)
-	authManager := auth.NewManager("test", 1*time.Hour)
+	authCfg := service.DefaultAuthConfig()
+	totpCipher, err := auth.NewSecretBox([]byte(strings.Repeat("k", 32)))
+	s.Require().NoError(err)
+	authCfg.TOTPCipher = totpCipher
+	authSvc := service.NewAuthService(repo, authCfg)
+	keys := auth.NewKeyring()
+	s.Require().NoError(keys.Add(auth.NewHMACKey("test", []byte("test"))))
+	authManager := auth.NewManager(keys, 1*time.Hour)
 	s.jwt = authManager
-	orderSvc := service.NewOrderService(repo)
+	orderSvc := service.NewOrderService(repo, service.DefaultOrderConfig())
 
 	h := handler.HTTPHandler{
 		AuthService:  authSvc,
 		OrderService: orderSvc,
 		JWT:          authManager,
 		Logger:       slog.Default(),
+		WithdrawStepUp: handler.StepUpConfig{
+			Enabled:   true,
+			Threshold: decimal.NewFromInt(100),
+		},
+		AdminToken: "admin",
 	}
 	srv := httptest.NewServer(h.Routes())
 	s.server = srv
@@ -149,6 +164,113 @@ func (s *OrderSuite) TestCreateExistingOrder() {
 	s.Equal(http.StatusConflict, resp.StatusCode())
 }
 
+func (s *OrderSuite) TestUploadOrdersBatch() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = s.client.R().SetBody(s.validOrderNumber).SetContentType("text/plain").Post("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusAccepted, resp.StatusCode())
+
+	login, password = rand.Text(), rand.Text()
+	registerReq = handler.RegisterRequest{Login: login, Password: password}
+	resp, err = s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	first, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	second, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	batch := []string{first, s.invalidOrderNumber, first, s.validOrderNumber}
+
+	var results []handler.OrderUploadResponse
+	resp, err = s.client.R().SetBody(batch).SetResult(&results).Post("/api/user/orders/batch")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal([]handler.OrderUploadResponse{
+		{Number: first, Result: domain.OrderUploadResultAccepted},
+		{Number: s.invalidOrderNumber, Result: domain.OrderUploadResultMalformed},
+		{Number: first, Result: domain.OrderUploadResultDuplicateOwn},
+		{Number: s.validOrderNumber, Result: domain.OrderUploadResultOwnedByOther},
+	}, results)
+
+	resp, err = s.client.R().
+		SetBody(first + "\n\n" + second + "\n").
+		SetContentType("text/plain").
+		SetResult(&results).
+		Post("/api/user/orders/batch")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal([]handler.OrderUploadResponse{
+		{Number: first, Result: domain.OrderUploadResultDuplicateOwn},
+		{Number: second, Result: domain.OrderUploadResultAccepted},
+	}, results)
+
+	var orders []handler.OrderResponse
+	resp, err = s.client.R().SetResult(&orders).Get("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Len(orders, 2)
+
+	resp, err = s.client.R().SetBody([]string{}).Post("/api/user/orders/batch")
+	s.Require().NoError(err)
+	s.Equal(http.StatusBadRequest, resp.StatusCode())
+
+	resp, err = s.client.R().SetBody(make([]string, 1001)).Post("/api/user/orders/batch")
+	s.Require().NoError(err)
+	s.Equal(http.StatusRequestEntityTooLarge, resp.StatusCode())
+}
+
+func (s *OrderSuite) TestGetOrder() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = s.client.R().SetBody(s.validOrderNumber).SetContentType("text/plain").Post("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusAccepted, resp.StatusCode())
+
+	var order handler.OrderDetailsResponse
+	resp, err = s.client.R().SetResult(&order).Get("/api/user/orders/" + s.validOrderNumber)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal(domain.OrderNumber(s.validOrderNumber), order.Number)
+	s.Equal(domain.OrderStatusNEW, order.Status)
+	s.True(order.CheckedAt.IsZero())
+
+	claimed, err := s.repo.ClaimOrdersForProcessing(s.ctx, "worker", time.Minute, 1)
+	s.Require().NoError(err)
+	s.Require().Len(claimed, 1)
+	err = s.repo.MarkOrderChecked(s.ctx, "worker", domain.OrderNumber(s.validOrderNumber), domain.Backoff{})
+	s.Require().NoError(err)
+	resp, err = s.client.R().SetResult(&order).Get("/api/user/orders/" + s.validOrderNumber)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.False(order.CheckedAt.IsZero())
+
+	unknown, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	resp, err = s.client.R().Get("/api/user/orders/" + unknown)
+	s.Require().NoError(err)
+	s.Equal(http.StatusNotFound, resp.StatusCode())
+
+	login, password = rand.Text(), rand.Text()
+	registerReq = handler.RegisterRequest{Login: login, Password: password}
+	resp, err = s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = s.client.R().Get("/api/user/orders/" + s.validOrderNumber)
+	s.Require().NoError(err)
+	s.Equal(http.StatusNotFound, resp.StatusCode(), "other users' orders are not found")
+}
+
 func (s *OrderSuite) TestUnauthorized() {
 	resp, err := s.client.R().SetBody(s.validOrderNumber).Post("/api/user/orders")
 	s.Require().NoError(err)
@@ -220,6 +342,107 @@ func (s *OrderSuite) TestOrdersSortedByTime() {
 	s.Equal(orderNumbers, orderResponseNumbers)
 }
 
+func (s *OrderSuite) TestOrdersPagination() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	const numOrders = 5
+	orderNumbers := make([]domain.OrderNumber, 0, numOrders)
+	for range numOrders {
+		var order string
+		order, err = generateLuhn(s.orderNumberSize)
+		s.Require().NoError(err)
+		resp, err = s.client.R().SetBody(order).SetContentType("text/plain").Post("/api/user/orders")
+		s.Require().NoError(err)
+		s.Equal(http.StatusAccepted, resp.StatusCode())
+		orderNumbers = append(orderNumbers, domain.OrderNumber(order))
+	}
+
+	got := make([]domain.OrderNumber, 0, numOrders)
+	next := "/api/user/orders?limit=2&sort=asc"
+	pages := 0
+	for next != "" {
+		var page []handler.OrderResponse
+		resp, err = s.client.R().SetResult(&page).Get(next)
+		s.Require().NoError(err)
+		s.Equal(http.StatusOK, resp.StatusCode())
+		s.LessOrEqual(len(page), 2)
+		for _, i := range page {
+			got = append(got, i.Number)
+		}
+		next = nextLink(resp.Header().Get("Link"))
+		pages++
+	}
+	s.Equal(orderNumbers, got)
+	s.Equal(3, pages)
+
+	resp, err = s.client.R().SetQueryParam("status", "PROCESSED,INVALID").Get("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+
+	var newOrders []handler.OrderResponse
+	resp, err = s.client.R().SetQueryParam("status", "NEW").SetResult(&newOrders).Get("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Len(newOrders, numOrders)
+	s.Empty(resp.Header().Get("Link"), "unpaginated by default")
+
+	for _, query := range []map[string]string{
+		{"status": "DONE"},
+		{"sort": "up"},
+		{"limit": "0"},
+		{"cursor": "garbage"},
+		{"from": "yesterday"},
+	} {
+		resp, err = s.client.R().SetQueryParams(query).Get("/api/user/orders")
+		s.Require().NoError(err)
+		s.Equal(http.StatusBadRequest, resp.StatusCode(), query)
+	}
+}
+
+func (s *OrderSuite) TestWithdrawalsPagination() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(claims.UserID, number, decimal.NewFromInt(10))
+	for range 3 {
+		s.Require().NoError(s.withdraw())
+	}
+
+	var page []handler.WithdrawalsResponse
+	resp, err = s.client.R().SetQueryParam("limit", "2").SetResult(&page).Get("/api/user/withdrawals")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Len(page, 2)
+	next := nextLink(resp.Header().Get("Link"))
+	s.Require().NotEmpty(next)
+
+	var last []handler.WithdrawalsResponse
+	resp, err = s.client.R().SetResult(&last).Get(next)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Len(last, 1)
+	s.Empty(resp.Header().Get("Link"))
+	s.False(last[0].ProcessedAt.After(page[1].ProcessedAt))
+
+	resp, err = s.client.R().SetQueryParam("status", "NEW").Get("/api/user/withdrawals")
+	s.Require().NoError(err)
+	s.Equal(http.StatusBadRequest, resp.StatusCode())
+}
+
 func (s *OrderSuite) TestGetBalanceFromEmpty() {
 	login, password := rand.Text(), rand.Text()
 	registerReq := handler.RegisterRequest{Login: login, Password: password}
@@ -248,10 +471,10 @@ func (s *OrderSuite) TestGetBalanceNoWithdrawals() {
 
 	authCookie, err := getAuthCookie(resp.Cookies())
 	s.Require().NoError(err)
-	id, err := s.jwt.Parse(authCookie.Value)
+	claims, err := s.jwt.Parse(authCookie.Value)
 	s.Require().NoError(err)
+	id := claims.UserID
 
-	queries := database.New(s.pool)
 	var total decimal.Decimal
 	for i := 1; i < 10; i++ {
 		var (
@@ -263,13 +486,7 @@ func (s *OrderSuite) TestGetBalanceNoWithdrawals() {
 		accrual, err = decimal.NewFromString(fmt.Sprintf("%[1]d.%[1]d%[1]d", i))
 		s.Require().NoError(err)
 		total = total.Add(accrual)
-		_, err = queries.InsertOrder(s.ctx, database.InsertOrderParams{
-			Number:  number,
-			UserID:  id,
-			Status:  domain.OrderStatusPROCESSED.String(),
-			Accrual: accrual,
-		})
-		s.Require().NoError(err)
+		s.accrue(id, number, accrual)
 	}
 
 	want, err := json.Marshal(
@@ -313,6 +530,44 @@ func (s *OrderSuite) TestWithdrawNoBalance() {
 	s.Equal(http.StatusPaymentRequired, resp.StatusCode())
 }
 
+func (s *OrderSuite) TestWithdrawStepUp() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	var enrollment handler.TOTPEnrollmentResponse
+	resp, err = s.client.R().SetResult(&enrollment).Post("/api/user/2fa/totp")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	s.Require().NoError(err)
+	secret := auth.TOTPSecret(raw)
+	resp, err = s.client.R().
+		SetBody(handler.TOTPCodeRequest{Code: secret.Code(time.Now())}).
+		Post("/api/user/2fa/totp/confirm")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = s.client.R().
+		SetBody(handler.WithdrawalRequest{s.validOrderNumber, handler.Money(decimal.NewFromInt(100))}).
+		Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusPaymentRequired, resp.StatusCode(), "no code required up to the threshold")
+
+	large := handler.WithdrawalRequest{s.validOrderNumber, handler.Money(decimal.NewFromInt(101))}
+	resp, err = s.client.R().SetBody(large).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode())
+
+	resp, err = s.client.R().
+		SetHeader("X-TOTP-Code", secret.Code(time.Now().Add(30*time.Second))).
+		SetBody(large).
+		Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusPaymentRequired, resp.StatusCode())
+}
+
 func (s *OrderSuite) TestWithdraw() {
 	login, password := rand.Text(), rand.Text()
 	registerReq := handler.RegisterRequest{Login: login, Password: password}
@@ -322,20 +577,14 @@ func (s *OrderSuite) TestWithdraw() {
 
 	authCookie, err := getAuthCookie(resp.Cookies())
 	s.Require().NoError(err)
-	id, err := s.jwt.Parse(authCookie.Value)
+	claims, err := s.jwt.Parse(authCookie.Value)
 	s.Require().NoError(err)
+	id := claims.UserID
 
 	const balanceTotal = 1000
 	number, err := generateLuhn(s.orderNumberSize)
 	s.Require().NoError(err)
-	queries := database.New(s.pool)
-	_, err = queries.InsertOrder(s.ctx, database.InsertOrderParams{
-		Number:  number,
-		UserID:  id,
-		Status:  domain.OrderStatusPROCESSED.String(),
-		Accrual: decimal.NewFromInt(balanceTotal),
-	})
-	s.Require().NoError(err)
+	s.accrue(id, number, decimal.NewFromInt(balanceTotal))
 
 	const withdrawalsNum = 2
 	orderNumbers := make([]domain.OrderNumber, 0, withdrawalsNum)
@@ -374,7 +623,7 @@ func (s *OrderSuite) TestWithdraw() {
 	s.Equal(string(want), string(resp.Bytes()))
 }
 
-func (s *OrderSuite) TestWithdrawConcurrent() {
+func (s *OrderSuite) TestWithdrawIdempotencyKey() {
 	login, password := rand.Text(), rand.Text()
 	registerReq := handler.RegisterRequest{Login: login, Password: password}
 	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
@@ -383,54 +632,1204 @@ func (s *OrderSuite) TestWithdrawConcurrent() {
 
 	authCookie, err := getAuthCookie(resp.Cookies())
 	s.Require().NoError(err)
-	id, err := s.jwt.Parse(authCookie.Value)
+	claims, err := s.jwt.Parse(authCookie.Value)
 	s.Require().NoError(err)
 
-	const balanceTotal = 1000
 	number, err := generateLuhn(s.orderNumberSize)
 	s.Require().NoError(err)
-	queries := database.New(s.pool)
-	_, err = queries.InsertOrder(s.ctx, database.InsertOrderParams{
-		Number:  number,
-		UserID:  id,
-		Status:  domain.OrderStatusPROCESSED.String(),
-		Accrual: decimal.NewFromInt(balanceTotal),
-	})
-	s.Require().NoError(err)
+	s.accrue(claims.UserID, number, decimal.NewFromInt(10))
 
-	g, _ := errgroup.WithContext(s.ctx)
-	for range balanceTotal {
-		g.Go(func() error {
-			return s.withdraw()
-		})
+	req := handler.WithdrawalRequest{Order: s.validOrderNumber, Sum: handler.Money(decimal.NewFromInt(3))}
+	for range 3 {
+		resp, err = s.client.R().SetHeader("Idempotency-Key", "withdraw-1").SetBody(req).Post("/api/user/balance/withdraw")
+		s.Require().NoError(err)
+		s.Equal(http.StatusOK, resp.StatusCode())
 	}
-	err = g.Wait()
+	s.Equal("true", resp.Header().Get("Idempotent-Replayed"))
+
+	var withdrawals []handler.WithdrawalsResponse
+	resp, err = s.client.R().SetResult(&withdrawals).Get("/api/user/withdrawals")
 	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Len(withdrawals, 1, "retries don't withdraw again")
 
-	var balanceResponse handler.BalanceResponse
-	resp, err = s.client.R().SetResult(&balanceResponse).Get("/api/user/balance")
+	req.Sum = handler.Money(decimal.NewFromInt(4))
+	resp, err = s.client.R().SetHeader("Idempotency-Key", "withdraw-1").SetBody(req).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "key reused with a different body")
+
+	req.Sum = handler.Money(decimal.NewFromInt(100))
+	resp, err = s.client.R().SetHeader("Idempotency-Key", "withdraw-2").SetBody(req).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusPaymentRequired, resp.StatusCode())
+	resp, err = s.client.R().SetHeader("Idempotency-Key", "withdraw-2").SetBody(req).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusPaymentRequired, resp.StatusCode(), "client errors are replayed too")
+	s.Equal("true", resp.Header().Get("Idempotent-Replayed"))
+
+	// A request that reserved withdraw-2 and crashed before completing it.
+	_, err = s.pool.Exec(
+		s.ctx,
+		`update idempotency_keys set status_code = null, content_type = null, body = null,
+		locked_until = now() + interval '1 minute' where user_id = $1 and key = 'withdraw-2'`,
+		claims.UserID,
+	)
+	s.Require().NoError(err)
+	resp, err = s.client.R().SetHeader("Idempotency-Key", "withdraw-2").SetBody(req).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "key is locked by the request in progress")
+
+	_, err = s.pool.Exec(
+		s.ctx,
+		"update idempotency_keys set locked_until = now() - interval '1 second' where user_id = $1 and key = 'withdraw-2'",
+		claims.UserID,
+	)
+	s.Require().NoError(err)
+	req.Sum = handler.Money(decimal.NewFromInt(5))
+	resp, err = s.client.R().SetHeader("Idempotency-Key", "withdraw-2").SetBody(req).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "only a retry of the same request takes the key over")
+	req.Sum = handler.Money(decimal.NewFromInt(100))
+	resp, err = s.client.R().SetHeader("Idempotency-Key", "withdraw-2").SetBody(req).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusPaymentRequired, resp.StatusCode(), "retry takes over the abandoned key")
+	s.Empty(resp.Header().Get("Idempotent-Replayed"))
+
+	_, err = s.pool.Exec(
+		s.ctx,
+		"update idempotency_keys set created_at = now() - interval '25 hours' where user_id = $1 and key = 'withdraw-1'",
+		claims.UserID,
+	)
+	s.Require().NoError(err)
+	purged, err := s.repo.PurgeIdempotencyKeys(s.ctx, time.Now().Add(-24*time.Hour))
+	s.Require().NoError(err)
+	s.EqualValues(1, purged)
+	var keys int
+	s.Require().NoError(
+		s.pool.QueryRow(s.ctx, "select count(*) from idempotency_keys where user_id = $1", claims.UserID).Scan(&keys),
+	)
+	s.Equal(1, keys, "only withdraw-2 is left")
+}
+
+func (s *OrderSuite) TestWithdrawOrderNumberTaken() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
 	s.Require().NoError(err)
 	s.Equal(http.StatusOK, resp.StatusCode())
-	s.True(decimal.NewFromInt(0).Equal(decimal.Decimal(balanceResponse.Current)))
-	s.True(decimal.NewFromInt(balanceTotal).Equal(decimal.Decimal(balanceResponse.Withdrawn)))
+
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+
+	accrualOrder, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(claims.UserID, accrualOrder, decimal.NewFromInt(10))
+
+	req := handler.WithdrawalRequest{Order: s.validOrderNumber, Sum: handler.Money(decimal.NewFromInt(1))}
+	resp, err = s.client.R().SetBody(req).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	resp, err = s.client.R().SetBody(req).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "order number already paid with points")
+
+	req.Order = accrualOrder
+	resp, err = s.client.R().SetBody(req).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "order number is an uploaded order")
+
+	resp, err = s.client.R().SetBody(s.validOrderNumber).SetContentType("text/plain").Post("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "order number already paid with points")
+
+	holdOrder, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	holdReq := handler.HoldRequest{Order: holdOrder, Sum: handler.Money(decimal.NewFromInt(1)), ExpiresIn: 0}
+	resp, err = s.client.R().SetBody(holdReq).Post("/api/user/balance/holds")
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusCreated, resp.StatusCode())
+
+	newOrder, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	var results []handler.OrderUploadResponse
+	resp, err = s.client.R().
+		SetBody([]string{s.validOrderNumber, holdOrder, newOrder}).
+		SetResult(&results).
+		Post("/api/user/orders/batch")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal([]handler.OrderUploadResponse{
+		{Number: s.validOrderNumber, Result: domain.OrderUploadResultUsedForWithdrawal},
+		{Number: holdOrder, Result: domain.OrderUploadResultUsedForWithdrawal},
+		{Number: newOrder, Result: domain.OrderUploadResultAccepted},
+	}, results)
+
+	var balance handler.BalanceResponse
+	resp, err = s.client.R().SetResult(&balance).Get("/api/user/balance")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.True(decimal.NewFromInt(8).Equal(decimal.Decimal(balance.Current)), "one point withdrawn and one held")
 }
 
-func (s *OrderSuite) withdraw() error {
-	s.T().Helper()
-	numberWithdraw, err := generateLuhn(s.orderNumberSize)
-	if err != nil {
-		return err
-	}
-	withdrawResp, err := s.client.R().
-		SetBody(handler.WithdrawalRequest{Order: numberWithdraw, Sum: handler.Money(decimal.NewFromInt(1))}).
-		Post("/api/user/balance/withdraw")
-	if err != nil {
-		return err
-	}
-	if withdrawResp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", withdrawResp.StatusCode())
+func (s *OrderSuite) TestWithdrawalHolds() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(claims.UserID, number, decimal.NewFromInt(100))
+
+	balanceIs := func(current, withdrawn, held int64) {
+		var balance handler.BalanceResponse
+		resp, err = s.client.R().SetResult(&balance).Get("/api/user/balance")
+		s.Require().NoError(err)
+		s.Equal(http.StatusOK, resp.StatusCode())
+		s.True(decimal.NewFromInt(current).Equal(decimal.Decimal(balance.Current)), "current")
+		s.True(decimal.NewFromInt(withdrawn).Equal(decimal.Decimal(balance.Withdrawn)), "withdrawn")
+		s.True(decimal.NewFromInt(held).Equal(decimal.Decimal(balance.Held)), "held")
 	}
-	return nil
+
+	var hold handler.HoldResponse
+	req := handler.HoldRequest{Order: s.validOrderNumber, Sum: handler.Money(decimal.NewFromInt(30)), ExpiresIn: 0}
+	resp, err = s.client.R().SetBody(req).SetResult(&hold).Post("/api/user/balance/holds")
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusCreated, resp.StatusCode())
+	s.Equal(domain.HoldStatusHeld, hold.Status)
+	balanceIs(70, 0, 30)
+
+	resp, err = s.client.R().SetBody(req).Post("/api/user/balance/holds")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "order number is held")
+
+	withdrawal := handler.WithdrawalRequest{Order: "79927398713", Sum: handler.Money(decimal.NewFromInt(80))}
+	resp, err = s.client.R().SetBody(withdrawal).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusPaymentRequired, resp.StatusCode(), "held points can't be withdrawn")
+
+	capturePath := fmt.Sprintf("/api/user/balance/holds/%s/capture", hold.ID)
+	releasePath := fmt.Sprintf("/api/user/balance/holds/%s/release", hold.ID)
+	resp, err = s.client.R().SetResult(&hold).Post(capturePath)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal(domain.HoldStatusCaptured, hold.Status)
+	s.False(hold.SettledAt.IsZero())
+
+	resp, err = s.client.R().Post(capturePath)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode(), "capture is repeatable")
+
+	resp, err = s.client.R().Post(releasePath)
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "captured hold can't be released")
+	balanceIs(70, 30, 0)
+
+	var withdrawals []handler.WithdrawalsResponse
+	resp, err = s.client.R().SetResult(&withdrawals).Get("/api/user/withdrawals")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Require().Len(withdrawals, 1)
+	s.Equal(domain.OrderNumber(s.validOrderNumber), withdrawals[0].Order)
+
+	req = handler.HoldRequest{Order: "79927398713", Sum: handler.Money(decimal.NewFromInt(20)), ExpiresIn: 60}
+	resp, err = s.client.R().SetBody(req).SetResult(&hold).Post("/api/user/balance/holds")
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusCreated, resp.StatusCode())
+	balanceIs(50, 30, 20)
+
+	resp, err = s.client.R().SetResult(&hold).Post(fmt.Sprintf("/api/user/balance/holds/%s/release", hold.ID))
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal(domain.HoldStatusReleased, hold.Status)
+	balanceIs(70, 30, 0)
+
+	req.ExpiresIn = int((48 * time.Hour).Seconds())
+	resp, err = s.client.R().SetBody(req).Post("/api/user/balance/holds")
+	s.Require().NoError(err)
+	s.Equal(http.StatusBadRequest, resp.StatusCode(), "expiry over the limit")
+
+	resp, err = s.client.R().Post(fmt.Sprintf("/api/user/balance/holds/%s/capture", uuid.New()))
+	s.Require().NoError(err)
+	s.Equal(http.StatusNotFound, resp.StatusCode())
+}
+
+func (s *OrderSuite) TestWithdrawalHoldExpires() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(claims.UserID, number, decimal.NewFromInt(100))
+
+	var hold handler.HoldResponse
+	req := handler.HoldRequest{Order: s.validOrderNumber, Sum: handler.Money(decimal.NewFromInt(40)), ExpiresIn: 0}
+	resp, err = s.client.R().SetBody(req).SetResult(&hold).Post("/api/user/balance/holds")
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusCreated, resp.StatusCode())
+
+	_, err = s.pool.Exec(
+		s.ctx, "update withdrawal_holds set expires_at = now() - interval '1 second' where id = $1", hold.ID,
+	)
+	s.Require().NoError(err)
+
+	var balance handler.BalanceResponse
+	resp, err = s.client.R().SetResult(&balance).Get("/api/user/balance")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.True(decimal.NewFromInt(100).Equal(decimal.Decimal(balance.Current)), "expired holds don't count")
+	s.True(decimal.Decimal(balance.Held).IsZero())
+
+	resp, err = s.client.R().Post(fmt.Sprintf("/api/user/balance/holds/%s/capture", hold.ID))
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode())
+
+	n, err := s.repo.ExpireHolds(s.ctx)
+	s.Require().NoError(err)
+	s.Equal(int64(1), n)
+
+	resp, err = s.client.R().SetResult(&hold).Get(fmt.Sprintf("/api/user/balance/holds/%s", hold.ID))
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal(domain.HoldStatusExpired, hold.Status)
+
+	resp, err = s.client.R().SetBody(req).Post("/api/user/balance/holds")
+	s.Require().NoError(err)
+	s.Equal(http.StatusCreated, resp.StatusCode(), "order number is free again")
+}
+
+func (s *OrderSuite) TestWithdrawConcurrent() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+	id := claims.UserID
+
+	const balanceTotal = 1000
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(id, number, decimal.NewFromInt(balanceTotal))
+
+	g, _ := errgroup.WithContext(s.ctx)
+	for range balanceTotal {
+		g.Go(func() error {
+			return s.withdraw()
+		})
+	}
+	err = g.Wait()
+	s.Require().NoError(err)
+
+	var balanceResponse handler.BalanceResponse
+	resp, err = s.client.R().SetResult(&balanceResponse).Get("/api/user/balance")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.True(decimal.NewFromInt(0).Equal(decimal.Decimal(balanceResponse.Current)))
+	s.True(decimal.NewFromInt(balanceTotal).Equal(decimal.Decimal(balanceResponse.Withdrawn)))
+}
+
+func (s *OrderSuite) TestAdjustBalance() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+	path := "/api/admin/users/" + claims.UserID.String() + "/adjustments"
+
+	admin, adminID := s.staff(domain.UserRoleAdmin)
+	defer func() { s.Require().NoError(admin.Close()) }()
+	support, supportID := s.staff(domain.UserRoleSupport)
+	defer func() { s.Require().NoError(support.Close()) }()
+
+	goodwill := handler.AdjustmentRequest{Amount: handler.Money(decimal.NewFromInt(50)), Reason: "goodwill"}
+	resp, err = s.client.R().SetHeader("X-Admin-Token", "admin").SetBody(goodwill).Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode(), "adjustments need an operator session")
+
+	resp, err = support.R().SetBody(goodwill).Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode(), "only admins credit")
+
+	resp, err = admin.R().SetBody(goodwill).Post("/api/admin/users/" + adminID.String() + "/adjustments")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "admins can't credit themselves")
+
+	resp, err = support.R().
+		SetBody(handler.AdjustmentRequest{Amount: handler.Money(decimal.NewFromInt(-1)), Reason: "reversal"}).
+		Post("/api/admin/users/" + supportID.String() + "/adjustments")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "staff can't adjust their own balance")
+
+	resp, err = admin.R().
+		SetBody(handler.AdjustmentRequest{Amount: handler.Money(decimal.NewFromInt(50)), Reason: ""}).
+		Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusBadRequest, resp.StatusCode(), "reason is mandatory")
+
+	resp, err = admin.R().
+		SetBody(handler.AdjustmentRequest{Amount: handler.Money(decimal.NewFromInt(-1)), Reason: "reversal"}).
+		Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "debit must not exceed the balance")
+
+	var created handler.AdjustmentResponse
+	resp, err = admin.R().SetBody(goodwill).SetResult(&created).Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusCreated, resp.StatusCode())
+	s.Equal("goodwill", created.Reason)
+	s.Equal(adminID, created.OperatorID)
+
+	resp, err = support.R().
+		SetBody(handler.AdjustmentRequest{Amount: handler.Money(decimal.NewFromInt(-20)), Reason: "reversal"}).
+		SetResult(&created).
+		Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusCreated, resp.StatusCode(), "support may debit")
+	s.Equal(supportID, created.OperatorID)
+
+	var adjustments []handler.AdjustmentResponse
+	resp, err = admin.R().SetResult(&adjustments).Get(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Len(adjustments, 2)
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	resp, err = s.client.R().
+		SetBody(handler.WithdrawalRequest{Order: number, Sum: handler.Money(decimal.NewFromInt(31))}).
+		Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusPaymentRequired, resp.StatusCode())
+
+	resp, err = s.client.R().
+		SetBody(handler.WithdrawalRequest{Order: number, Sum: handler.Money(decimal.NewFromInt(30))}).
+		Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode(), "adjustments count towards the balance")
+
+	var balance handler.BalanceResponse
+	resp, err = s.client.R().SetResult(&balance).Get("/api/user/balance")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.True(decimal.Zero.Equal(decimal.Decimal(balance.Current)))
+	s.True(decimal.NewFromInt(30).Equal(decimal.Decimal(balance.Withdrawn)))
+}
+
+func (s *OrderSuite) TestReverseWithdrawal() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(claims.UserID, number, decimal.NewFromInt(100))
+
+	withdrawal := handler.WithdrawalRequest{Order: s.validOrderNumber, Sum: handler.Money(decimal.NewFromInt(40))}
+	resp, err = s.client.R().SetBody(withdrawal).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	path := "/api/admin/withdrawals/" + s.validOrderNumber + "/reversals"
+	partial := handler.ReversalRequest{
+		Amount:    handler.Money(decimal.NewFromInt(10)),
+		Reason:    "item returned",
+		Reference: "return-1",
+	}
+	resp, err = s.client.R().SetBody(partial).Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode(), "users can't reverse their withdrawals")
+
+	resp, err = s.client.R().SetHeader("X-Admin-Token", "admin").SetBody(partial).Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode(), "reversals need an operator session")
+
+	admin, adminID := s.staff(domain.UserRoleAdmin)
+	defer func() { s.Require().NoError(admin.Close()) }()
+	support, supportID := s.staff(domain.UserRoleSupport)
+	defer func() { s.Require().NoError(support.Close()) }()
+
+	number, err = generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(supportID, number, decimal.NewFromInt(100))
+	number, err = generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	resp, err = support.R().
+		SetBody(handler.WithdrawalRequest{Order: number, Sum: handler.Money(decimal.NewFromInt(40))}).
+		Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	resp, err = support.R().SetBody(partial).Post("/api/admin/withdrawals/" + number + "/reversals")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "staff can't reverse their own withdrawals")
+
+	var first, repeated handler.ReversalResponse
+	resp, err = admin.R().SetBody(partial).SetResult(&first).Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusCreated, resp.StatusCode())
+	s.True(decimal.NewFromInt(10).Equal(decimal.Decimal(first.Amount)))
+	s.Equal(adminID, first.OperatorID)
+
+	resp, err = admin.R().SetBody(partial).SetResult(&repeated).Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode(), "same reference is applied once")
+	s.Equal(first.ID, repeated.ID)
+
+	var balance handler.BalanceResponse
+	resp, err = s.client.R().SetResult(&balance).Get("/api/user/balance")
+	s.Require().NoError(err)
+	s.True(decimal.NewFromInt(70).Equal(decimal.Decimal(balance.Current)))
+	s.True(decimal.NewFromInt(30).Equal(decimal.Decimal(balance.Withdrawn)))
+
+	var withdrawals []handler.WithdrawalsResponse
+	resp, err = s.client.R().SetResult(&withdrawals).Get("/api/user/withdrawals")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Require().Len(withdrawals, 1)
+	s.Equal(domain.WithdrawalStatusPartiallyReversed, withdrawals[0].Status)
+	s.True(decimal.NewFromInt(10).Equal(decimal.Decimal(withdrawals[0].Reversed)))
+
+	resp, err = admin.R().
+		SetBody(handler.ReversalRequest{Amount: handler.Money(decimal.NewFromInt(31)), Reason: "cancelled", Reference: ""}).
+		Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "more than the rest of the withdrawal")
+
+	var rest handler.ReversalResponse
+	resp, err = admin.R().
+		SetBody(handler.ReversalRequest{Amount: handler.Money(decimal.Zero), Reason: "cancelled", Reference: ""}).
+		SetResult(&rest).
+		Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusCreated, resp.StatusCode())
+	s.True(decimal.NewFromInt(30).Equal(decimal.Decimal(rest.Amount)), "refunds the rest")
+
+	resp, err = admin.R().
+		SetBody(handler.ReversalRequest{Amount: handler.Money(decimal.Zero), Reason: "cancelled", Reference: ""}).
+		Post(path)
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode(), "already reversed")
+
+	resp, err = s.client.R().SetResult(&withdrawals).Get("/api/user/withdrawals")
+	s.Require().NoError(err)
+	s.Require().Len(withdrawals, 1)
+	s.Equal(domain.WithdrawalStatusReversed, withdrawals[0].Status)
+
+	resp, err = s.client.R().SetResult(&balance).Get("/api/user/balance")
+	s.Require().NoError(err)
+	s.True(decimal.NewFromInt(100).Equal(decimal.Decimal(balance.Current)))
+	s.True(decimal.Decimal(balance.Withdrawn).IsZero())
+
+	resp, err = admin.R().SetBody(partial).Post("/api/admin/withdrawals/79927398713/reversals")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNotFound, resp.StatusCode())
+
+	var reconciliation handler.ReconciliationResponse
+	resp, err = admin.R().SetResult(&reconciliation).Get("/api/admin/reconciliation")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.True(reconciliation.OK)
+}
+
+func (s *OrderSuite) TestAccrualClawback() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(claims.UserID, number, decimal.NewFromInt(100))
+
+	orders, err := s.repo.ClaimOrdersForRecheck(s.ctx, time.Now().Add(-time.Hour), time.Now(), 100)
+	s.Require().NoError(err)
+	s.True(
+		slices.ContainsFunc(orders, func(o domain.Order) bool { return string(o.Number) == number }),
+		"recently processed orders are re-checked",
+	)
+	orders, err = s.repo.ClaimOrdersForRecheck(s.ctx, time.Now().Add(-time.Hour), time.Now(), 100)
+	s.Require().NoError(err)
+	s.False(
+		slices.ContainsFunc(orders, func(o domain.Order) bool { return string(o.Number) == number }),
+		"claimed orders aren't re-checked again until they're due",
+	)
+
+	withdrawNumber, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	withdrawal := handler.WithdrawalRequest{Order: withdrawNumber, Sum: handler.Money(decimal.NewFromInt(80))}
+	resp, err = s.client.R().SetBody(withdrawal).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	delta, err := s.repo.ReviseOrderAccrual(
+		s.ctx, domain.OrderNumber(number), domain.OrderStatusPROCESSED, decimal.NewFromInt(100),
+	)
+	s.Require().NoError(err)
+	s.True(delta.IsZero(), "unchanged accrual")
+
+	delta, err = s.repo.ReviseOrderAccrual(s.ctx, domain.OrderNumber(number), domain.OrderStatusINVALID, decimal.Zero)
+	s.Require().NoError(err)
+	s.True(decimal.NewFromInt(-100).Equal(delta))
+
+	delta, err = s.repo.ReviseOrderAccrual(s.ctx, domain.OrderNumber(number), domain.OrderStatusINVALID, decimal.Zero)
+	s.Require().NoError(err)
+	s.True(delta.IsZero(), "invalid orders aren't revised again")
+
+	var order handler.OrderDetailsResponse
+	resp, err = s.client.R().SetResult(&order).Get("/api/user/orders/" + number)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal(domain.OrderStatusINVALID, order.Status)
+
+	var balance handler.BalanceResponse
+	resp, err = s.client.R().SetResult(&balance).Get("/api/user/balance")
+	s.Require().NoError(err)
+	s.True(decimal.NewFromInt(-20).Equal(decimal.Decimal(balance.Current)), "clawback leaves a debt")
+
+	adjustments, err := s.repo.GetAdjustments(s.ctx, claims.UserID)
+	s.Require().NoError(err)
+	s.Require().Len(adjustments, 1)
+	s.True(decimal.NewFromInt(-100).Equal(adjustments[0].Amount))
+	s.Contains(adjustments[0].Reason, number)
+
+	withdrawNumber, err = generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	withdrawal = handler.WithdrawalRequest{Order: withdrawNumber, Sum: handler.Money(decimal.NewFromInt(1))}
+	resp, err = s.client.R().SetBody(withdrawal).Post("/api/user/balance/withdraw")
+	s.Require().NoError(err)
+	s.Equal(http.StatusPaymentRequired, resp.StatusCode(), "withdrawals are blocked until the debt is repaid")
+
+	admin := resty.New().SetBaseURL(s.server.URL).SetHeader("X-Admin-Token", "admin")
+	defer func() { s.Require().NoError(admin.Close()) }()
+	var reconciliation handler.ReconciliationResponse
+	resp, err = admin.R().SetResult(&reconciliation).Get("/api/admin/reconciliation")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.True(reconciliation.OK)
+}
+
+func (s *OrderSuite) TestCaptureHoldInDebt() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(claims.UserID, number, decimal.NewFromInt(100))
+
+	var hold handler.HoldResponse
+	req := handler.HoldRequest{Order: s.validOrderNumber, Sum: handler.Money(decimal.NewFromInt(80)), ExpiresIn: 0}
+	resp, err = s.client.R().SetBody(req).SetResult(&hold).Post("/api/user/balance/holds")
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusCreated, resp.StatusCode())
+
+	_, err = s.repo.ReviseOrderAccrual(s.ctx, domain.OrderNumber(number), domain.OrderStatusINVALID, decimal.Zero)
+	s.Require().NoError(err)
+
+	resp, err = s.client.R().Post(fmt.Sprintf("/api/user/balance/holds/%s/capture", hold.ID))
+	s.Require().NoError(err)
+	s.Equal(http.StatusPaymentRequired, resp.StatusCode(), "captures are blocked until the debt is repaid")
+
+	var balance handler.BalanceResponse
+	resp, err = s.client.R().SetResult(&balance).Get("/api/user/balance")
+	s.Require().NoError(err)
+	s.True(decimal.NewFromInt(-80).Equal(decimal.Decimal(balance.Current)))
+	s.True(decimal.Decimal(balance.Withdrawn).IsZero())
+	s.True(decimal.NewFromInt(80).Equal(decimal.Decimal(balance.Held)), "the hold stays active")
+
+	resp, err = s.client.R().SetResult(&hold).Post(fmt.Sprintf("/api/user/balance/holds/%s/release", hold.ID))
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal(domain.HoldStatusReleased, hold.Status)
+}
+
+func (s *OrderSuite) TestPointsExpire() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+	id := claims.UserID
+
+	now := time.Now()
+	cfg := service.DefaultOrderConfig()
+	cfg.PointsTTLMonths = 6
+	cfg.ExpiringSoonWindow = 30 * 24 * time.Hour
+	cfg.Now = func() time.Time { return now }
+	svc := service.NewOrderService(s.repo, cfg)
+
+	older, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(id, older, decimal.NewFromInt(100))
+	_, err = s.pool.Exec(
+		s.ctx,
+		"update point_lots set created_at = created_at - interval '160 days' where user_id = $1",
+		id,
+	)
+	s.Require().NoError(err)
+	withdrawNumber, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.Require().NoError(s.repo.Withdraw(s.ctx, id, domain.OrderNumber(withdrawNumber), decimal.NewFromInt(30), false))
+
+	newer, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(id, newer, decimal.NewFromInt(50))
+
+	balance, err := svc.GetBalance(s.ctx, id)
+	s.Require().NoError(err)
+	s.True(decimal.NewFromInt(120).Equal(balance.Current))
+	s.Require().Len(balance.ExpiringSoon, 1, "the newer lot expires later")
+	s.True(decimal.NewFromInt(70).Equal(balance.ExpiringSoon[0].Sum), "withdrawals consume the oldest lot first")
+
+	holdNumber, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	hold, err := s.repo.CreateHold(s.ctx, domain.NewWithdrawalHold(
+		id, domain.OrderNumber(holdNumber), decimal.NewFromInt(20), time.Now().Add(time.Hour),
+	), false)
+	s.Require().NoError(err)
+
+	balance, err = svc.GetBalance(s.ctx, id)
+	s.Require().NoError(err)
+	s.Require().Len(balance.ExpiringSoon, 1)
+	s.True(decimal.NewFromInt(50).Equal(balance.ExpiringSoon[0].Sum), "held points aren't expiring")
+
+	n, err := svc.ExpirePoints(s.ctx)
+	s.Require().NoError(err)
+	s.Zero(n, "nothing is due yet")
+
+	now = now.Add(30 * 24 * time.Hour)
+	n, err = svc.ExpirePoints(s.ctx)
+	s.Require().NoError(err)
+	s.Equal(int64(1), n)
+	n, err = svc.ExpirePoints(s.ctx)
+	s.Require().NoError(err)
+	s.Zero(n, "expiry is posted once")
+
+	balance, err = svc.GetBalance(s.ctx, id)
+	s.Require().NoError(err)
+	s.True(decimal.NewFromInt(50).Equal(balance.Current))
+	s.True(decimal.NewFromInt(20).Equal(balance.Held))
+	s.True(decimal.NewFromInt(30).Equal(balance.Withdrawn), "expired points aren't withdrawn")
+
+	_, err = s.repo.CaptureHold(s.ctx, id, hold.ID)
+	s.Require().NoError(err)
+	balance, err = svc.GetBalance(s.ctx, id)
+	s.Require().NoError(err)
+	s.True(decimal.NewFromInt(50).Equal(balance.Current))
+	s.Empty(balance.ExpiringSoon)
+
+	statement, err := s.repo.GetStatement(s.ctx, id, domain.StatementFilter{Limit: 10})
+	s.Require().NoError(err)
+	s.Require().NotEmpty(statement)
+	s.Equal(domain.LedgerEntryKindWithdrawal, statement[0].Kind)
+	s.Equal(domain.LedgerEntryKindExpiry, statement[1].Kind)
+	s.True(decimal.NewFromInt(-50).Equal(statement[1].Amount))
+
+	mismatches, err := s.repo.ReconcileBalances(s.ctx)
+	s.Require().NoError(err)
+	s.Empty(mismatches)
+}
+
+func (s *OrderSuite) TestClaimOrdersForProcessing() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+
+	numbers := make([]domain.OrderNumber, 0, 3)
+	for range 3 {
+		var number string
+		number, err = generateLuhn(s.orderNumberSize)
+		s.Require().NoError(err)
+		numbers = append(numbers, domain.OrderNumber(number))
+	}
+	_, err = s.repo.RegisterOrders(s.ctx, claims.UserID, numbers, false)
+	s.Require().NoError(err)
+
+	first, err := s.repo.ClaimOrdersForProcessing(s.ctx, "first", time.Minute, 2)
+	s.Require().NoError(err)
+	s.Len(first, 2)
+	second, err := s.repo.ClaimOrdersForProcessing(s.ctx, "second", time.Minute, 2)
+	s.Require().NoError(err)
+	s.Require().Len(second, 1, "leased orders are skipped")
+	s.NotContains([]domain.OrderNumber{first[0].Number, first[1].Number}, second[0].Number)
+	second, err = s.repo.ClaimOrdersForProcessing(s.ctx, "second", time.Minute, 2)
+	s.Require().NoError(err)
+	s.Empty(second)
+
+	n, err := s.repo.RenewOrderLeases(
+		s.ctx, "second", []domain.OrderNumber{first[0].Number, first[1].Number}, time.Minute,
+	)
+	s.Require().NoError(err)
+	s.Zero(n, "only the owner renews its leases")
+	n, err = s.repo.RenewOrderLeases(
+		s.ctx, "first", []domain.OrderNumber{first[0].Number, first[1].Number}, time.Minute,
+	)
+	s.Require().NoError(err)
+	s.Equal(int64(2), n)
+
+	err = s.repo.UpdateOrderStatus(s.ctx, first[0].Number, domain.OrderStatusPROCESSING, decimal.Zero, domain.Backoff{})
+	s.Require().NoError(err)
+	second, err = s.repo.ClaimOrdersForProcessing(s.ctx, "second", time.Minute, 2)
+	s.Require().NoError(err)
+	s.Require().Len(second, 1, "a status update ends the lease")
+	s.Equal(first[0].Number, second[0].Number)
+
+	_, err = s.pool.Exec(s.ctx, "update orders set lease_until = now() - interval '1 second' where claimed_by = 'first'")
+	s.Require().NoError(err)
+	second, err = s.repo.ClaimOrdersForProcessing(s.ctx, "second", time.Minute, 2)
+	s.Require().NoError(err)
+	s.Require().Len(second, 1, "expired leases are taken over")
+	s.Equal(first[1].Number, second[0].Number)
+
+	retry := domain.Backoff{Base: time.Minute, Max: time.Minute}
+	s.Require().NoError(s.repo.MarkOrderChecked(s.ctx, "first", first[1].Number, retry))
+	s.Require().NoError(s.repo.PostponeOrder(s.ctx, "first", first[1].Number, retry))
+	third, err := s.repo.ClaimOrdersForProcessing(s.ctx, "third", time.Minute, 2)
+	s.Require().NoError(err)
+	s.Empty(third)
+	n, err = s.repo.RenewOrderLeases(s.ctx, "second", []domain.OrderNumber{first[1].Number}, time.Minute)
+	s.Require().NoError(err)
+	s.Equal(int64(1), n, "a replica whose lease lapsed leaves the new owner's lease alone")
+}
+
+func (s *OrderSuite) TestOrderBackoff() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	order := domain.OrderNumber(number)
+	_, err = s.repo.RegisterOrders(s.ctx, claims.UserID, []domain.OrderNumber{order}, false)
+	s.Require().NoError(err)
+	due := func() {
+		s.T().Helper()
+		_, err = s.pool.Exec(s.ctx, "update orders set next_attempt_at = now() where number = $1", number)
+		s.Require().NoError(err)
+	}
+	claim := func() []domain.Order {
+		s.T().Helper()
+		var orders []domain.Order
+		orders, err = s.repo.ClaimOrdersForProcessing(s.ctx, "worker", time.Minute, 1)
+		s.Require().NoError(err)
+		return orders
+	}
+	// assertScheduled checks the attempt count and that the next check is delay away.
+	assertScheduled := func(attempts int32, delay time.Duration) {
+		s.T().Helper()
+		var got domain.Order
+		got, err = s.repo.GetOrder(s.ctx, claims.UserID, order)
+		s.Require().NoError(err)
+		s.Equal(attempts, got.Attempts)
+		s.WithinDuration(time.Now().Add(delay), got.NextAttemptAt, 5*time.Second)
+		s.Empty(claim(), "orders backing off aren't claimed")
+	}
+	retry := domain.Backoff{Base: time.Minute, Max: 3 * time.Minute}
+
+	s.Len(claim(), 1)
+	s.Require().NoError(s.repo.MarkOrderChecked(s.ctx, "worker", order, retry))
+	assertScheduled(1, time.Minute)
+	due()
+	s.Len(claim(), 1)
+	s.Require().NoError(s.repo.MarkOrderChecked(s.ctx, "worker", order, retry))
+	assertScheduled(2, 2*time.Minute)
+	due()
+	s.Len(claim(), 1)
+	s.Require().NoError(s.repo.PostponeOrder(s.ctx, "worker", order, retry))
+	// The delay is capped.
+	assertScheduled(3, 3*time.Minute)
+
+	due()
+	s.Len(claim(), 1)
+	err = s.repo.UpdateOrderStatus(s.ctx, order, domain.OrderStatusPROCESSING, decimal.Zero, retry)
+	s.Require().NoError(err)
+	assertScheduled(1, time.Minute)
+	due()
+	err = s.repo.UpdateOrderStatus(s.ctx, order, domain.OrderStatusPROCESSING, decimal.Zero, retry)
+	s.Require().NoError(err)
+	assertScheduled(2, 2*time.Minute)
+}
+
+func (s *OrderSuite) TestStuckOrders() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+
+	numbers := make([]domain.OrderNumber, 0, 2)
+	for range 2 {
+		var number string
+		number, err = generateLuhn(s.orderNumberSize)
+		s.Require().NoError(err)
+		numbers = append(numbers, domain.OrderNumber(number))
+	}
+	_, err = s.repo.RegisterOrders(s.ctx, claims.UserID, numbers, false)
+	s.Require().NoError(err)
+	retried, aged := numbers[0], numbers[1]
+
+	for range 2 {
+		_, err = s.pool.Exec(s.ctx, "update orders set claimed_by = 'worker' where number = $1", string(retried))
+		s.Require().NoError(err)
+		s.Require().NoError(s.repo.MarkOrderChecked(s.ctx, "worker", retried, domain.Backoff{}))
+	}
+	n, err := s.repo.MarkOrdersStuck(s.ctx, 2, time.Time{})
+	s.Require().NoError(err)
+	s.Equal(int64(1), n, "orders out of attempts are stuck")
+	_, err = s.pool.Exec(
+		s.ctx, "update orders set queued_at = now() - interval '2 hours' where number = $1", string(aged),
+	)
+	s.Require().NoError(err)
+	n, err = s.repo.MarkOrdersStuck(s.ctx, 0, time.Now().Add(-time.Hour))
+	s.Require().NoError(err)
+	s.Equal(int64(1), n, "orders waiting too long are stuck")
+	claimed, err := s.repo.ClaimOrdersForProcessing(s.ctx, "worker", time.Minute, 2)
+	s.Require().NoError(err)
+	s.Empty(claimed, "stuck orders aren't processed")
+
+	var order handler.OrderDetailsResponse
+	resp, err = s.client.R().SetResult(&order).Get("/api/user/orders/" + string(retried))
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal(domain.OrderStatusPROCESSING, order.Status, "users see stuck orders as processing")
+	var orders []handler.OrderResponse
+	resp, err = s.client.R().SetResult(&orders).SetQueryParam("status", "PROCESSING").Get("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Len(orders, 2)
+	resp, err = s.client.R().SetQueryParam("status", "STUCK").Get("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusBadRequest, resp.StatusCode())
+
+	var stuck []handler.StuckOrderResponse
+	resp, err = s.client.R().SetHeader("X-Admin-Token", "admin").SetResult(&stuck).Get("/api/admin/orders/stuck")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Require().Len(stuck, 2)
+	s.Equal(retried, stuck[0].Number)
+	s.Equal(domain.OrderStatusSTUCK, stuck[0].Status)
+	s.Equal(claims.UserID, stuck[0].UserID)
+	s.Equal(int32(2), stuck[0].Attempts)
+	s.False(stuck[0].StuckAt.IsZero())
+
+	var requeued handler.StuckOrderResponse
+	resp, err = s.client.R().
+		SetHeader("X-Admin-Token", "admin").
+		SetResult(&requeued).
+		Post("/api/admin/orders/" + string(retried) + "/requeue")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Equal(domain.OrderStatusPROCESSING, requeued.Status)
+	s.Zero(requeued.Attempts)
+	resp, err = s.client.R().SetHeader("X-Admin-Token", "admin").Post("/api/admin/orders/" + string(retried) + "/requeue")
+	s.Require().NoError(err)
+	s.Equal(http.StatusConflict, resp.StatusCode())
+	unknown, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	resp, err = s.client.R().SetHeader("X-Admin-Token", "admin").Post("/api/admin/orders/" + unknown + "/requeue")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNotFound, resp.StatusCode())
+
+	claimed, err = s.repo.ClaimOrdersForProcessing(s.ctx, "worker", time.Minute, 2)
+	s.Require().NoError(err)
+	s.Require().Len(claimed, 1, "requeued orders are due right away")
+	s.Equal(retried, claimed[0].Number)
+}
+
+func (s *OrderSuite) TestListenNewOrders() {
+	registerReq := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	notifications := make(chan struct{}, 10)
+	listened := make(chan error, 1)
+	go func() {
+		listened <- s.repo.ListenNewOrders(ctx, func() { notifications <- struct{}{} })
+	}()
+	select {
+	case <-notifications:
+	case <-time.After(5 * time.Second):
+		s.FailNow("not listening")
+	}
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	resp, err = s.client.R().SetBody(number).SetContentType("text/plain").Post("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusAccepted, resp.StatusCode())
+	select {
+	case <-notifications:
+	case <-time.After(5 * time.Second):
+		s.FailNow("upload not announced")
+	}
+
+	resp, err = s.client.R().SetBody(number).SetContentType("text/plain").Post("/api/user/orders")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	select {
+	case <-notifications:
+		s.Fail("duplicate upload announced")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err = s.pool.Exec(s.ctx, "update orders set status = 'STUCK', stuck_at = now() where number = $1", number)
+	s.Require().NoError(err)
+	_, err = s.repo.RequeueOrder(s.ctx, domain.OrderNumber(number))
+	s.Require().NoError(err)
+	select {
+	case <-notifications:
+	case <-time.After(5 * time.Second):
+		s.FailNow("requeue not announced")
+	}
+
+	cancel()
+	s.Error(<-listened)
+}
+
+func (s *OrderSuite) TestLedgerReconciles() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+	id := claims.UserID
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(id, number, decimal.NewFromInt(100))
+	err = s.repo.UpdateOrderStatus(
+		s.ctx, domain.OrderNumber(number), domain.OrderStatusPROCESSED, decimal.NewFromInt(100), domain.Backoff{},
+	)
+	s.Require().NoError(err, "final orders are left alone")
+	s.Require().NoError(s.withdraw())
+
+	admin, _ := s.staff(domain.UserRoleAdmin)
+	defer func() { s.Require().NoError(admin.Close()) }()
+	resp, err = admin.R().
+		SetBody(handler.AdjustmentRequest{Amount: handler.Money(decimal.NewFromInt(-9)), Reason: "goodwill reversal"}).
+		Post("/api/admin/users/" + id.String() + "/adjustments")
+	s.Require().NoError(err)
+	s.Equal(http.StatusCreated, resp.StatusCode())
+
+	var balance handler.BalanceResponse
+	resp, err = s.client.R().SetResult(&balance).Get("/api/user/balance")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.True(decimal.NewFromInt(90).Equal(decimal.Decimal(balance.Current)), "accrual is credited once")
+	s.True(decimal.NewFromInt(1).Equal(decimal.Decimal(balance.Withdrawn)))
+
+	var reconciliation handler.ReconciliationResponse
+	resp, err = s.client.R().
+		SetHeader("X-Admin-Token", "admin").
+		SetResult(&reconciliation).
+		Get("/api/admin/reconciliation")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.True(reconciliation.OK)
+	s.Empty(reconciliation.Mismatches)
+
+	_, err = s.pool.Exec(s.ctx, "update balances set current = current + 1 where user_id = $1", id)
+	s.Require().NoError(err)
+	resp, err = s.client.R().
+		SetHeader("X-Admin-Token", "admin").
+		SetResult(&reconciliation).
+		Get("/api/admin/reconciliation")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.False(reconciliation.OK)
+	s.Require().Len(reconciliation.Mismatches, 1)
+	s.Equal(id, reconciliation.Mismatches[0].UserID)
+
+	_, err = s.pool.Exec(s.ctx, "delete from ledger_entries where user_id = $1", id)
+	s.Require().Error(err, "ledger is append-only")
+}
+
+func (s *OrderSuite) TestStatement() {
+	login, password := rand.Text(), rand.Text()
+	registerReq := handler.RegisterRequest{Login: login, Password: password}
+	resp, err := s.client.R().SetBody(registerReq).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+
+	authCookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(authCookie.Value)
+	s.Require().NoError(err)
+	id := claims.UserID
+
+	resp, err = s.client.R().Get("/api/user/statement")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+
+	number, err := generateLuhn(s.orderNumberSize)
+	s.Require().NoError(err)
+	s.accrue(id, number, decimal.NewFromInt(10))
+	s.Require().NoError(s.withdraw())
+	s.Require().NoError(s.withdraw())
+
+	var page handler.StatementResponse
+	resp, err = s.client.R().SetQueryParam("limit", "2").SetResult(&page).Get("/api/user/statement")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Require().Len(page.Entries, 2)
+	s.Equal(domain.LedgerEntryKindWithdrawal, page.Entries[0].Type)
+	s.True(decimal.NewFromInt(-1).Equal(decimal.Decimal(page.Entries[0].Amount)))
+	s.True(decimal.NewFromInt(8).Equal(decimal.Decimal(page.Entries[0].Balance)))
+	s.True(decimal.NewFromInt(9).Equal(decimal.Decimal(page.Entries[1].Balance)))
+	s.NotEmpty(page.NextCursor)
+
+	var last handler.StatementResponse
+	resp, err = s.client.R().
+		SetQueryParams(map[string]string{"limit": "2", "cursor": page.NextCursor}).
+		SetResult(&last).
+		Get("/api/user/statement")
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode())
+	s.Require().Len(last.Entries, 1)
+	s.Equal(domain.LedgerEntryKindAccrual, last.Entries[0].Type)
+	s.Equal(domain.OrderNumber(number), last.Entries[0].Order)
+	s.True(decimal.NewFromInt(10).Equal(decimal.Decimal(last.Entries[0].Balance)))
+	s.Empty(last.NextCursor)
+
+	resp, err = s.client.R().
+		SetQueryParam("from", time.Now().Add(time.Hour).Format(time.RFC3339)).
+		Get("/api/user/statement")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, resp.StatusCode())
+
+	resp, err = s.client.R().SetQueryParam("cursor", "!").Get("/api/user/statement")
+	s.Require().NoError(err)
+	s.Equal(http.StatusBadRequest, resp.StatusCode())
+}
+
+// accrue registers a processed order the way the accrual worker does.
+func (s *OrderSuite) accrue(userID uuid.UUID, number string, accrual decimal.Decimal) {
+	s.T().Helper()
+	queries := database.New(s.pool)
+	_, err := queries.InsertOrder(s.ctx, database.InsertOrderParams{
+		Number:  number,
+		UserID:  userID,
+		Status:  domain.OrderStatusNEW.String(),
+		Accrual: decimal.Zero,
+	})
+	s.Require().NoError(err)
+	err = s.repo.UpdateOrderStatus(
+		s.ctx, domain.OrderNumber(number), domain.OrderStatusPROCESSED, accrual, domain.Backoff{},
+	)
+	s.Require().NoError(err)
+}
+
+// staff registers a user with role and returns a client with a session of theirs.
+func (s *OrderSuite) staff(role domain.UserRole) (*resty.Client, uuid.UUID) {
+	s.T().Helper()
+	req := handler.RegisterRequest{Login: rand.Text(), Password: rand.Text()}
+	client := resty.New().SetBaseURL(s.server.URL)
+	resp, err := client.R().SetBody(req).Post("/api/user/register")
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, resp.StatusCode())
+	cookie, err := getAuthCookie(resp.Cookies())
+	s.Require().NoError(err)
+	claims, err := s.jwt.Parse(cookie.Value)
+	s.Require().NoError(err)
+	resp, err = client.R().
+		SetHeader("X-Admin-Token", "admin").
+		SetBody(handler.SetUserRoleRequest{Role: &role}).
+		Put("/api/admin/users/" + claims.UserID.String() + "/role")
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusNoContent, resp.StatusCode())
+	resp, err = client.R().SetBody(req).Post("/api/user/login")
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, resp.StatusCode())
+	return client, claims.UserID
+}
+
+func (s *OrderSuite) withdraw() error {
+	s.T().Helper()
+	numberWithdraw, err := generateLuhn(s.orderNumberSize)
+	if err != nil {
+		return err
+	}
+	withdrawResp, err := s.client.R().
+		SetBody(handler.WithdrawalRequest{Order: numberWithdraw, Sum: handler.Money(decimal.NewFromInt(1))}).
+		Post("/api/user/balance/withdraw")
+	if err != nil {
+		return err
+	}
+	if withdrawResp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", withdrawResp.StatusCode())
+	}
+	return nil
+}
+
+// nextLink extracts the target of a rel="next" Link header.
+func nextLink(header string) string {
+	target, _, ok := strings.Cut(strings.TrimPrefix(header, "<"), `>; rel="next"`)
+	if !ok {
+		return ""
+	}
+	return target
 }
 
 func generateLuhn(size int) (string, error) {
@@ -2,9 +2,25 @@ package handler
 
 import (
 	"errors"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
 )
 
-var errEmptyFields = errors.New("empty fields")
+const (
+	maxAPIKeyNameLen        = 64
+	maxAdjustmentReasonLen  = 1024
+	maxReversalReferenceLen = 255
+)
+
+var (
+	errEmptyFields       = errors.New("empty fields")
+	errAPIKeyNameTooLong = errors.New("api key name is too long")
+	errReasonTooLong     = errors.New("reason is too long")
+	errReferenceTooLong  = errors.New("reference is too long")
+	errInvalidSum        = errors.New("sum must be positive")
+)
 
 type RegisterRequest struct {
 	Login    string `json:"login"`
@@ -18,7 +34,130 @@ func (r RegisterRequest) Validate() error {
 	return nil
 }
 
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func (r ChangePasswordRequest) Validate() error {
+	if r.OldPassword == "" || r.NewPassword == "" {
+		return errEmptyFields
+	}
+	return nil
+}
+
 type WithdrawalRequest struct {
 	Order string `json:"order"`
 	Sum   Money  `json:"sum"`
 }
+
+// HoldRequest reserves Sum for Order. ExpiresIn is the hold's lifetime in seconds, the server default if zero.
+type HoldRequest struct {
+	Order     string `json:"order"`
+	Sum       Money  `json:"sum"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+func (r HoldRequest) Validate() error {
+	if r.Order == "" {
+		return errEmptyFields
+	}
+	if !decimal.Decimal(r.Sum).IsPositive() {
+		return errInvalidSum
+	}
+	return nil
+}
+
+// RefreshRequest lets clients that don't keep cookies pass the refresh token in the body.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string               `json:"name"`
+	Scopes []domain.APIKeyScope `json:"scopes"`
+}
+
+func (r CreateAPIKeyRequest) Validate() error {
+	if r.Name == "" || len(r.Scopes) == 0 {
+		return errEmptyFields
+	}
+	if len(r.Name) > maxAPIKeyNameLen {
+		return errAPIKeyNameTooLong
+	}
+	return nil
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (r TOTPCodeRequest) Validate() error {
+	if r.Code == "" {
+		return errEmptyFields
+	}
+	return nil
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (r MFALoginRequest) Validate() error {
+	if r.MFAToken == "" || r.Code == "" {
+		return errEmptyFields
+	}
+	return nil
+}
+
+// SetUserRoleRequest holds Role as a pointer so that a missing role isn't taken for the zero one.
+type SetUserRoleRequest struct {
+	Role *domain.UserRole `json:"role"`
+}
+
+func (r SetUserRoleRequest) Validate() error {
+	if r.Role == nil {
+		return errEmptyFields
+	}
+	return nil
+}
+
+type AdjustmentRequest struct {
+	Amount Money  `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+func (r AdjustmentRequest) Validate() error {
+	if r.Amount.IsZero() || strings.TrimSpace(r.Reason) == "" {
+		return errEmptyFields
+	}
+	if len(r.Reason) > maxAdjustmentReasonLen {
+		return errReasonTooLong
+	}
+	return nil
+}
+
+// ReversalRequest refunds a withdrawal. A zero Amount refunds what is left of it. Reference lets the caller
+// retry the request without refunding twice.
+type ReversalRequest struct {
+	Amount    Money  `json:"amount"`
+	Reason    string `json:"reason"`
+	Reference string `json:"reference"`
+}
+
+func (r ReversalRequest) Validate() error {
+	if strings.TrimSpace(r.Reason) == "" {
+		return errEmptyFields
+	}
+	if decimal.Decimal(r.Amount).IsNegative() {
+		return errInvalidSum
+	}
+	if len(r.Reason) > maxAdjustmentReasonLen {
+		return errReasonTooLong
+	}
+	if len(r.Reference) > maxReversalReferenceLen {
+		return errReferenceTooLong
+	}
+	return nil
+}
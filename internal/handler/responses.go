@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"github.com/ttl256/gophermart-loyalty/internal/domain"
 )
@@ -17,6 +18,50 @@ type HealthResponse struct {
 	Status HealthStatus `json:"status"`
 }
 
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type APIKeyResponse struct {
+	ID         uuid.UUID            `json:"id"`
+	Name       string               `json:"name"`
+	Prefix     string               `json:"prefix"`
+	Scopes     []domain.APIKeyScope `json:"scopes"`
+	CreatedAt  time.Time            `json:"created_at"`
+	LastUsedAt time.Time            `json:"last_used_at,omitzero"`
+}
+
+// CreateAPIKeyResponse is the only response carrying the key itself.
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+
+	Key string `json:"key"`
+}
+
+type UserResponse struct {
+	ID        uuid.UUID       `json:"id"`
+	Login     string          `json:"login"`
+	Role      domain.UserRole `json:"role"`
+	Blocked   bool            `json:"blocked"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type MFAChallengeResponse struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
 type Money decimal.Decimal //nolint: recvcheck //json
 
 func (m Money) MarshalJSON() ([]byte, error) {
@@ -53,13 +98,107 @@ type OrderResponse struct {
 	UploadedAt time.Time          `json:"uploaded_at"`
 }
 
+type OrderUploadResponse struct {
+	Number string                   `json:"number"`
+	Result domain.OrderUploadResult `json:"result"`
+}
+
+// OrderDetailsResponse is a single order. CheckedAt is omitted until the accrual system is first asked about it.
+type OrderDetailsResponse struct {
+	OrderResponse
+
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+}
+
+// StuckOrderResponse is an order the accrual worker gave up on, for admins. Attempts counts the checks in a row
+// that got the same answer, CheckedAt is omitted if the accrual system was never asked about it.
+type StuckOrderResponse struct {
+	Number     domain.OrderNumber `json:"number"`
+	UserID     uuid.UUID          `json:"user_id"`
+	Status     domain.OrderStatus `json:"status"`
+	UploadedAt time.Time          `json:"uploaded_at"`
+	CheckedAt  time.Time          `json:"checked_at,omitzero"`
+	Attempts   int32              `json:"attempts"`
+	StuckAt    time.Time          `json:"stuck_at,omitzero"`
+}
+
+// BalanceResponse is the user's balance. Current is what can be spent, points reserved by holds are in Held.
+// ExpiringSoon lists the points about to expire, earliest first, and is omitted if there are none.
 type BalanceResponse struct {
-	Current   Money `json:"current"`
-	Withdrawn Money `json:"withdrawn"`
+	Current      Money                    `json:"current"`
+	Withdrawn    Money                    `json:"withdrawn"`
+	Held         Money                    `json:"held"`
+	ExpiringSoon []ExpiringPointsResponse `json:"expiring_soon,omitempty"`
+}
+
+type ExpiringPointsResponse struct {
+	Sum       Money     `json:"sum"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
+// WithdrawalsResponse is a withdrawal. Reversed is the part of Sum refunded since, omitted if none.
 type WithdrawalsResponse struct {
-	Order       domain.OrderNumber `json:"order"`
-	Sum         Money              `json:"sum"`
-	ProcessedAt time.Time          `json:"processed_at"`
+	Order       domain.OrderNumber      `json:"order"`
+	Sum         Money                   `json:"sum"`
+	Status      domain.WithdrawalStatus `json:"status"`
+	Reversed    Money                   `json:"reversed,omitzero"`
+	ProcessedAt time.Time               `json:"processed_at"`
+}
+
+// HoldResponse is a withdrawal hold. SettledAt is omitted while the hold is active.
+type HoldResponse struct {
+	ID        uuid.UUID          `json:"id"`
+	Order     domain.OrderNumber `json:"order"`
+	Sum       Money              `json:"sum"`
+	Status    domain.HoldStatus  `json:"status"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	CreatedAt time.Time          `json:"created_at"`
+	SettledAt time.Time          `json:"settled_at,omitzero"`
+}
+
+type ReversalResponse struct {
+	ID         uuid.UUID          `json:"id"`
+	Order      domain.OrderNumber `json:"order"`
+	Amount     Money              `json:"amount"`
+	Reason     string             `json:"reason"`
+	Reference  string             `json:"reference,omitempty"`
+	OperatorID uuid.UUID          `json:"operator_id,omitzero"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+type AdjustmentResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Amount     Money     `json:"amount"`
+	Reason     string    `json:"reason"`
+	OperatorID uuid.UUID `json:"operator_id,omitzero"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReconciliationResponse lists the users whose balance snapshot doesn't match their ledger. OK is true when
+// there are none.
+type ReconciliationResponse struct {
+	OK         bool                      `json:"ok"`
+	Mismatches []BalanceMismatchResponse `json:"mismatches"`
+}
+
+type BalanceMismatchResponse struct {
+	UserID   uuid.UUID       `json:"user_id"`
+	Snapshot BalanceResponse `json:"snapshot"`
+	Ledger   BalanceResponse `json:"ledger"`
+}
+
+// StatementResponse is a page of a statement. NextCursor is empty on the last page.
+type StatementResponse struct {
+	Entries    []StatementEntryResponse `json:"entries"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// StatementEntryResponse is a balance change. Amount is negative for debits, Balance is the balance after it.
+type StatementEntryResponse struct {
+	Type      domain.LedgerEntryKind `json:"type"`
+	Amount    Money                  `json:"amount"`
+	Balance   Money                  `json:"balance"`
+	Order     domain.OrderNumber     `json:"order,omitempty"`
+	Reason    string                 `json:"reason,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
 }
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+const (
+	defaultStatementLimit = 100
+	maxStatementLimit     = 1000
+)
+
+var errInvalidStatementQuery = errors.New("invalid statement query")
+
+// GetStatement lists the user's balance changes newest first with the balance after each of them.
+// Pages are requested with ?limit= and ?cursor=, the time range with RFC 3339 ?from= (inclusive)
+// and ?to= (exclusive).
+func (h *HTTPHandler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	filter, err := statementFilter(r)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	entries, err := h.OrderService.GetStatement(r.Context(), id, filter)
+	if err != nil {
+		h.Logger.Error("getting statement", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if len(entries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp := StatementResponse{
+		Entries:    make([]StatementEntryResponse, 0, len(entries)),
+		NextCursor: "",
+	}
+	for _, i := range entries {
+		resp.Entries = append(resp.Entries, StatementEntryResponse{
+			Type:      i.Kind,
+			Amount:    Money(i.Amount),
+			Balance:   Money(i.Balance),
+			Order:     i.OrderNumber,
+			Reason:    i.Reason,
+			CreatedAt: i.CreatedAt,
+		})
+	}
+	if len(entries) == int(filter.Limit) {
+		resp.NextCursor = encodeCursor(strconv.FormatInt(entries[len(entries)-1].ID, 10))
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func statementFilter(r *http.Request) (domain.StatementFilter, error) {
+	query := r.URL.Query()
+	filter := domain.StatementFilter{
+		From:     time.Time{},
+		To:       time.Time{},
+		BeforeID: 0,
+		Limit:    defaultStatementLimit,
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || limit < 1 || limit > maxStatementLimit {
+			return filter, fmt.Errorf("%w: limit must be between 1 and %d", errInvalidStatementQuery, maxStatementLimit)
+		}
+		filter.Limit = int32(limit)
+	}
+	if v := query.Get("cursor"); v != "" {
+		raw, err := decodeCursor(v)
+		if err != nil {
+			return filter, fmt.Errorf("%w: malformed cursor", errInvalidStatementQuery)
+		}
+		if filter.BeforeID, err = strconv.ParseInt(raw, 10, 64); err != nil || filter.BeforeID < 1 {
+			return filter, fmt.Errorf("%w: malformed cursor", errInvalidStatementQuery)
+		}
+	}
+	var err error
+	if v := query.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("%w: from must be an RFC 3339 time", errInvalidStatementQuery)
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("%w: to must be an RFC 3339 time", errInvalidStatementQuery)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("%w: from must be before to", errInvalidStatementQuery)
+	}
+	return filter, nil
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// AdminGetStuckOrders lists the orders the accrual worker gave up on, longest stuck first, paginated with ?limit=
+// and ?offset=.
+func (h *HTTPHandler) AdminGetStuckOrders(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pagination(r)
+	if err != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, err.Error(), hErr)
+		return
+	}
+	orders, err := h.OrderService.GetStuckOrders(r.Context(), limit, offset)
+	if err != nil {
+		h.Logger.Error("getting stuck orders", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	if len(orders) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp := make([]StuckOrderResponse, 0, len(orders))
+	for _, i := range orders {
+		resp = append(resp, newStuckOrderResponse(i))
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// AdminRequeueOrder hands a stuck order back to the accrual worker, which checks it again right away.
+func (h *HTTPHandler) AdminRequeueOrder(w http.ResponseWriter, r *http.Request) {
+	number := domain.OrderNumber(chi.URLParam(r, "number"))
+	order, err := h.OrderService.RequeueOrder(r.Context(), number)
+	if err != nil {
+		if errors.Is(err, domain.ErrOrderNotFound) {
+			h.Logger.Debug("order not found", slog.String("order", string(number)))
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, domain.ErrOrderNotStuck) {
+			h.Logger.Debug("requeueing order", slog.Any("error", err))
+			hErr := http.StatusConflict
+			http.Error(w, err.Error(), hErr)
+			return
+		}
+		h.Logger.Error("requeueing order", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	h.Logger.Info("order requeued", slog.String("order", string(order.Number)), slog.String("by", actor(r.Context())))
+	data, err := json.Marshal(newStuckOrderResponse(order))
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func newStuckOrderResponse(order domain.Order) StuckOrderResponse {
+	return StuckOrderResponse{
+		Number:     order.Number,
+		UserID:     order.UserID,
+		Status:     order.Status,
+		UploadedAt: order.UploadedAt,
+		CheckedAt:  order.CheckedAt,
+		Attempts:   order.Attempts,
+		StuckAt:    order.StuckAt,
+	}
+}
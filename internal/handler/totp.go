@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/ttl256/gophermart-loyalty/internal/auth"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// StepUpConfig describes when an operation needs a fresh second factor.
+type StepUpConfig struct {
+	Enabled bool
+	// Threshold is the sum above which a code is required.
+	Threshold decimal.Decimal
+}
+
+func (c StepUpConfig) required(sum decimal.Decimal) bool {
+	return c.Enabled && sum.GreaterThan(c.Threshold)
+}
+
+func (h *HTTPHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	secret, uri, err := h.AuthService.EnrollTOTP(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrTOTPUnavailable) {
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, domain.ErrTOTPAlreadyEnabled) {
+			hErr := http.StatusConflict
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		h.Logger.Error("enrolling totp", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	data, err := json.Marshal(TOTPEnrollmentResponse{Secret: secret.String(), URI: uri})
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (h *HTTPHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	var req TOTPCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Validate() != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	codes, err := h.AuthService.ConfirmTOTP(r.Context(), id, req.Code)
+	if err != nil {
+		if h.writeTOTPError(w, r, err) {
+			return
+		}
+		h.Logger.Error("confirming totp", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	resp := RecoveryCodesResponse{RecoveryCodes: make([]string, 0, len(codes))}
+	for _, i := range codes {
+		resp.RecoveryCodes = append(resp.RecoveryCodes, string(i))
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (h *HTTPHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	err := h.AuthService.DisableTOTP(r.Context(), id, r.Header.Get(totpCodeHeader), clientAddress(r))
+	if err != nil {
+		if h.writeTOTPError(w, r, err) {
+			return
+		}
+		h.Logger.Error("disabling totp", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginSecondFactor exchanges an MFA token from LoginHandler and a TOTP or recovery code for a session.
+func (h *HTTPHandler) LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req MFALoginRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Validate() != nil {
+		h.Logger.Debug("bad request", slog.Any("error", err))
+		hErr := http.StatusBadRequest
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	userID, err := h.AuthService.VerifyMFAChallenge(
+		r.Context(),
+		auth.MFAToken(req.MFAToken),
+		req.Code,
+		clientAddress(r),
+	)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidMFAToken) || errors.Is(err, domain.ErrInvalidOTP) {
+			h.Logger.Debug("verifying second factor", slog.Any("error", err))
+			hErr := http.StatusUnauthorized
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		if h.writeThrottled(w, err) {
+			h.Logger.Info("second factor throttled", slog.Any("error", err))
+			return
+		}
+		h.Logger.Error("verifying second factor", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	err = h.startSession(w, r, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserBlocked) {
+			h.Logger.Info("blocked user login", slog.String("user_id", userID.String()))
+			hErr := http.StatusForbidden
+			http.Error(w, http.StatusText(hErr), hErr)
+			return
+		}
+		h.Logger.Error("starting session", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+}
+
+func (h *HTTPHandler) writeMFAChallenge(w http.ResponseWriter, token auth.MFAToken) {
+	data, err := json.Marshal(MFAChallengeResponse{MFAToken: string(token)})
+	if err != nil {
+		h.Logger.Error("encoding json", slog.Any("error", err))
+		hErr := http.StatusInternalServerError
+		http.Error(w, http.StatusText(hErr), hErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write(data)
+}
+
+// checkStepUp verifies the TOTP code header if sum requires it. It writes the response and returns false on failure.
+func (h *HTTPHandler) checkStepUp(w http.ResponseWriter, r *http.Request, userID uuid.UUID, sum decimal.Decimal) bool {
+	if !h.WithdrawStepUp.required(sum) {
+		return true
+	}
+	err := h.AuthService.VerifyStepUp(r.Context(), userID, r.Header.Get(totpCodeHeader), clientAddress(r))
+	if err == nil {
+		return true
+	}
+	if h.writeTOTPError(w, r, err) {
+		return false
+	}
+	h.Logger.Error("verifying step-up", slog.Any("error", err))
+	hErr := http.StatusInternalServerError
+	http.Error(w, http.StatusText(hErr), hErr)
+	return false
+}
+
+// writeTOTPError responds to second factor errors. It returns false if err is not one of them.
+func (h *HTTPHandler) writeTOTPError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, domain.ErrTOTPUnavailable), errors.Is(err, domain.ErrTOTPNotEnabled):
+		http.NotFound(w, r)
+		return true
+	case errors.Is(err, domain.ErrTOTPAlreadyEnabled):
+		hErr := http.StatusConflict
+		http.Error(w, http.StatusText(hErr), hErr)
+		return true
+	case errors.Is(err, domain.ErrTOTPRequired), errors.Is(err, domain.ErrInvalidOTP):
+		h.Logger.Debug("second factor rejected", slog.Any("error", err))
+		hErr := http.StatusForbidden
+		http.Error(w, err.Error(), hErr)
+		return true
+	}
+	if h.writeThrottled(w, err) {
+		h.Logger.Info("second factor throttled", slog.Any("error", err))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// CreateAdjustment records a manual balance change. Debits can't take the balance below zero.
+func (m *DBStorage) CreateAdjustment(ctx context.Context, adj domain.Adjustment) (domain.Adjustment, error) {
+	return withTx(ctx, m, func(q *database.Queries) (domain.Adjustment, error) {
+		err := q.AcquireUserLock(ctx, adj.UserID)
+		if err != nil {
+			return domain.Adjustment{}, fmt.Errorf("acquiring user lock: %w", err)
+		}
+		if adj.Amount.IsNegative() {
+			balance, err := getBalance(ctx, q, adj.UserID)
+			if err != nil {
+				return domain.Adjustment{}, err
+			}
+			if balance.Current.Add(adj.Amount).IsNegative() {
+				return domain.Adjustment{}, domain.ErrNotEnoughFunds
+			}
+		}
+		return insertAdjustment(ctx, q, adj, "")
+	})
+}
+
+func (m *DBStorage) GetAdjustments(ctx context.Context, userID uuid.UUID) ([]domain.Adjustment, error) {
+	rows, err := m.queries.GetAdjustments(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("getting adjustments: %w", err)
+	}
+	adjustments := make([]domain.Adjustment, 0, len(rows))
+	for _, row := range rows {
+		adjustments = append(adjustments, domain.Adjustment{
+			ID:         row.ID,
+			UserID:     userID,
+			Amount:     row.Amount,
+			Reason:     row.Reason,
+			OperatorID: row.OperatorID.Bytes,
+			CreatedAt:  row.CreatedAt,
+		})
+	}
+	return adjustments, nil
+}
+
+// insertAdjustment records the adjustment and its ledger entry. The order is set for adjustments made
+// by the system to correct an order's accrual.
+func insertAdjustment(
+	ctx context.Context,
+	q *database.Queries,
+	adj domain.Adjustment,
+	order domain.OrderNumber,
+) (domain.Adjustment, error) {
+	createdAt, err := q.InsertAdjustment(ctx, database.InsertAdjustmentParams{
+		ID:         adj.ID,
+		UserID:     adj.UserID,
+		Amount:     adj.Amount,
+		Reason:     adj.Reason,
+		OperatorID: pgtype.UUID{Bytes: adj.OperatorID, Valid: adj.OperatorID != uuid.Nil},
+	})
+	if err != nil {
+		return domain.Adjustment{}, fmt.Errorf("inserting adjustment: %w", err)
+	}
+	err = appendLedgerEntry(ctx, q, domain.LedgerEntry{
+		UserID:       adj.UserID,
+		Kind:         domain.LedgerEntryKindAdjustment,
+		Amount:       adj.Amount,
+		OrderNumber:  order,
+		AdjustmentID: adj.ID,
+	})
+	if err != nil {
+		return domain.Adjustment{}, err
+	}
+	adj.CreatedAt = createdAt
+	return adj, nil
+}
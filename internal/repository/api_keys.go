@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+func (m *DBStorage) CreateAPIKey(ctx context.Context, key domain.APIKey, keyHash string) (domain.APIKey, error) {
+	createdAt, err := m.queries.InsertAPIKey(ctx, database.InsertAPIKeyParams{
+		ID:      key.ID,
+		UserID:  key.UserID,
+		Name:    key.Name,
+		Prefix:  key.Prefix,
+		KeyHash: keyHash,
+		Scopes:  formatScopes(key.Scopes),
+	})
+	if err != nil {
+		return domain.APIKey{}, fmt.Errorf("inserting api key: %w", err)
+	}
+	key.CreatedAt = createdAt
+	return key, nil
+}
+
+func (m *DBStorage) GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]domain.APIKey, error) {
+	rows, err := m.queries.SelectAPIKeysByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("getting api keys: %w", err)
+	}
+	keys := make([]domain.APIKey, 0, len(rows))
+	for _, row := range rows {
+		scopes, err := parseScopes(row.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, domain.APIKey{
+			ID:         row.ID,
+			UserID:     userID,
+			Name:       row.Name,
+			Prefix:     row.Prefix,
+			Scopes:     scopes,
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: row.LastUsedAt.Time,
+		})
+	}
+	return keys, nil
+}
+
+// UseAPIKey looks up an active key by its hash and records that it was used.
+func (m *DBStorage) UseAPIKey(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	row, err := m.queries.TouchAPIKey(ctx, keyHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.APIKey{}, domain.ErrInvalidAPIKey
+		}
+		return domain.APIKey{}, fmt.Errorf("getting api key: %w", err)
+	}
+	scopes, err := parseScopes(row.Scopes)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return domain.APIKey{
+		ID:         row.ID,
+		UserID:     row.UserID,
+		Name:       row.Name,
+		Prefix:     row.Prefix,
+		Scopes:     scopes,
+		CreatedAt:  row.CreatedAt,
+		LastUsedAt: row.LastUsedAt.Time,
+	}, nil
+}
+
+func (m *DBStorage) RevokeAPIKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID) error {
+	n, err := m.queries.RevokeAPIKey(ctx, database.RevokeAPIKeyParams{ID: keyID, UserID: userID})
+	if err != nil {
+		return fmt.Errorf("revoking api key: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func formatScopes(scopes []domain.APIKeyScope) []string {
+	s := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		s = append(s, scope.String())
+	}
+	return s
+}
+
+func parseScopes(s []string) ([]domain.APIKeyScope, error) {
+	scopes := make([]domain.APIKeyScope, 0, len(s))
+	for _, i := range s {
+		scope, err := domain.ParseAPIKeyScope(i)
+		if err != nil {
+			return nil, fmt.Errorf("parsing api key scope: %w", err)
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 
 	"github.com/cenkalti/backoff/v5"
 	"github.com/golang-migrate/migrate/v4"
@@ -14,6 +16,7 @@ import (
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
 	xerrors "github.com/pkg/errors"
@@ -86,6 +89,7 @@ func (m *DBStorage) createUser(
 			ID:           user.ID,
 			Login:        user.Login,
 			PasswordHash: string(passwordHash),
+			Role:         user.Role.String(),
 		}
 		id, err := q.InsertUser(ctx, params)
 		if err != nil {
@@ -114,7 +118,11 @@ func (m *DBStorage) GetUserByLogin(ctx context.Context, login string) (domain.Us
 		}
 		return domain.User{}, "", fmt.Errorf("getting user: %w", err)
 	}
-	return domain.User{ID: user.ID, Login: user.Login}, auth.PasswordHash(user.PasswordHash), nil
+	u, err := newUser(user.ID, user.Login, user.Role, user.BlockedAt, user.CreatedAt)
+	if err != nil {
+		return domain.User{}, "", err
+	}
+	return u, auth.PasswordHash(user.PasswordHash), nil
 }
 
 func (m *DBStorage) getUserByLogin(ctx context.Context, login string) (database.User, error) {
@@ -127,8 +135,90 @@ func (m *DBStorage) getUserByLogin(ctx context.Context, login string) (database.
 	})
 }
 
-func (m *DBStorage) RegisterOrder(ctx context.Context, userID uuid.UUID, order domain.OrderNumber) (uuid.UUID, error) {
+func (m *DBStorage) GetUserByID(ctx context.Context, id uuid.UUID) (domain.User, auth.PasswordHash, error) {
+	user, err := m.queries.SelectUserByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.User{}, "", domain.ErrUserNotFound
+		}
+		return domain.User{}, "", fmt.Errorf("getting user: %w", err)
+	}
+	u, err := newUser(user.ID, user.Login, user.Role, user.BlockedAt, user.CreatedAt)
+	if err != nil {
+		return domain.User{}, "", err
+	}
+	return u, auth.PasswordHash(user.PasswordHash), nil
+}
+
+// UpdatePasswordHash replaces the hash unless it was changed concurrently. Reports whether it was replaced.
+func (m *DBStorage) UpdatePasswordHash(
+	ctx context.Context,
+	userID uuid.UUID,
+	oldHash auth.PasswordHash,
+	newHash auth.PasswordHash,
+) (bool, error) {
+	n, err := m.queries.UpdatePasswordHash(ctx, database.UpdatePasswordHashParams{
+		NewHash: string(newHash),
+		ID:      userID,
+		OldHash: string(oldHash),
+	})
+	if err != nil {
+		return false, fmt.Errorf("updating password hash: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ChangePassword sets a new password hash and revokes every session of the user except keepSessionID.
+func (m *DBStorage) ChangePassword(
+	ctx context.Context,
+	userID uuid.UUID,
+	oldHash auth.PasswordHash,
+	newHash auth.PasswordHash,
+	keepSessionID uuid.UUID,
+) error {
+	_, err := withTx(ctx, m, func(q *database.Queries) (struct{}, error) {
+		n, err := q.UpdatePasswordHash(ctx, database.UpdatePasswordHashParams{
+			NewHash: string(newHash),
+			ID:      userID,
+			OldHash: string(oldHash),
+		})
+		if err != nil {
+			return struct{}{}, fmt.Errorf("updating password hash: %w", err)
+		}
+		if n == 0 {
+			return struct{}{}, domain.ErrInvalidCredentials
+		}
+		err = q.RevokeOtherSessions(ctx, database.RevokeOtherSessionsParams{UserID: userID, KeepID: keepSessionID})
+		if err != nil {
+			return struct{}{}, fmt.Errorf("revoking sessions: %w", err)
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// RegisterOrder uploads an order. Unless allowCollision is set, the number can't be one already used for
+// a withdrawal or an active hold. A new order is announced to ListenNewOrders once the transaction commits.
+func (m *DBStorage) RegisterOrder(
+	ctx context.Context,
+	userID uuid.UUID,
+	order domain.OrderNumber,
+	allowCollision bool,
+) (uuid.UUID, error) {
 	return withTx(ctx, m, func(q *database.Queries) (uuid.UUID, error) {
+		if !allowCollision {
+			err := q.AcquireOrderNumberLocks(ctx, []string{string(order)})
+			if err != nil {
+				return uuid.UUID{}, fmt.Errorf("acquiring order number lock: %w", err)
+			}
+			taken, err := q.WithdrawalOrderTaken(ctx, string(order))
+			if err != nil {
+				return uuid.UUID{}, fmt.Errorf("checking withdrawal order: %w", err)
+			}
+			if taken {
+				return uuid.UUID{}, domain.ErrWithdrawalOrderUsed
+			}
+		}
 		idInsert, err := q.InsertOrder(
 			ctx, database.InsertOrderParams{
 				Number:  string(order),
@@ -138,6 +228,9 @@ func (m *DBStorage) RegisterOrder(ctx context.Context, userID uuid.UUID, order d
 			},
 		)
 		if err == nil {
+			if err = q.NotifyNewOrders(ctx); err != nil {
+				return uuid.UUID{}, fmt.Errorf("notifying new orders: %w", err)
+			}
 			return idInsert, nil
 		}
 		if !errors.Is(err, pgx.ErrNoRows) {
@@ -154,9 +247,105 @@ func (m *DBStorage) RegisterOrder(ctx context.Context, userID uuid.UUID, order d
 	})
 }
 
-func (m *DBStorage) GetOrders(ctx context.Context, userID uuid.UUID) ([]domain.Order, error) {
+// RegisterOrders uploads a batch of distinct order numbers in one statement and reports what happened
+// to each of them. Collisions with withdrawals and new orders are handled like in RegisterOrder.
+func (m *DBStorage) RegisterOrders(
+	ctx context.Context,
+	userID uuid.UUID,
+	orders []domain.OrderNumber,
+	allowCollision bool,
+) (map[domain.OrderNumber]domain.OrderUploadResult, error) {
+	numbers := make([]string, 0, len(orders))
+	for _, i := range orders {
+		numbers = append(numbers, string(i))
+	}
+	return withTx(ctx, m, func(q *database.Queries) (map[domain.OrderNumber]domain.OrderUploadResult, error) {
+		results := make(map[domain.OrderNumber]domain.OrderUploadResult, len(orders))
+		pending := numbers
+		if !allowCollision {
+			err := q.AcquireOrderNumberLocks(ctx, numbers)
+			if err != nil {
+				return nil, fmt.Errorf("acquiring order number locks: %w", err)
+			}
+			taken, err := q.GetWithdrawalOrdersTaken(ctx, numbers)
+			if err != nil {
+				return nil, fmt.Errorf("checking withdrawal orders: %w", err)
+			}
+			for _, i := range taken {
+				results[domain.OrderNumber(i)] = domain.OrderUploadResultUsedForWithdrawal
+			}
+			if len(taken) == len(numbers) {
+				return results, nil
+			}
+			pending = slices.DeleteFunc(slices.Clone(numbers), func(number string) bool {
+				_, ok := results[domain.OrderNumber(number)]
+				return ok
+			})
+		}
+		inserted, err := q.InsertOrders(ctx, database.InsertOrdersParams{Numbers: pending, UserID: userID})
+		if err != nil {
+			return nil, fmt.Errorf("inserting orders: %w", err)
+		}
+		for _, i := range inserted {
+			results[domain.OrderNumber(i)] = domain.OrderUploadResultAccepted
+		}
+		if len(inserted) > 0 {
+			if err = q.NotifyNewOrders(ctx); err != nil {
+				return nil, fmt.Errorf("notifying new orders: %w", err)
+			}
+		}
+		if len(results) == len(orders) {
+			return results, nil
+		}
+		owners, err := q.GetOrderOwners(ctx, pending)
+		if err != nil {
+			return nil, fmt.Errorf("getting order owners: %w", err)
+		}
+		for _, i := range owners {
+			number := domain.OrderNumber(i.Number)
+			if _, ok := results[number]; ok {
+				continue
+			}
+			if i.UserID == userID {
+				results[number] = domain.OrderUploadResultDuplicateOwn
+			} else {
+				results[number] = domain.OrderUploadResultOwnedByOther
+			}
+		}
+		return results, nil
+	})
+}
+
+func (m *DBStorage) GetOrders(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter domain.ListFilter,
+) ([]domain.Order, error) {
+	statuses := make([]string, 0, len(filter.Statuses))
+	for _, i := range filter.Statuses {
+		statuses = append(statuses, i.String())
+	}
+	params := database.GetOrdersAscParams{
+		UserID:      userID,
+		Statuses:    statuses,
+		FromTime:    pgtype.Timestamptz{Time: filter.From, Valid: !filter.From.IsZero()},
+		ToTime:      pgtype.Timestamptz{Time: filter.To, Valid: !filter.To.IsZero()},
+		AfterTime:   pgtype.Timestamptz{Time: filter.After.Time, Valid: !filter.After.Time.IsZero()},
+		AfterNumber: filter.After.Key,
+		RowLimit:    pgtype.Int4{Int32: filter.Limit, Valid: filter.Limit > 0},
+	}
 	return withTx(ctx, m, func(q *database.Queries) ([]domain.Order, error) {
-		dbOrders, err := q.GetOrders(ctx, userID)
+		var dbOrders []database.GetOrdersAscRow
+		var err error
+		if filter.Ascending {
+			dbOrders, err = q.GetOrdersAsc(ctx, params)
+		} else {
+			var rows []database.GetOrdersDescRow
+			rows, err = q.GetOrdersDesc(ctx, database.GetOrdersDescParams(params))
+			for _, i := range rows {
+				dbOrders = append(dbOrders, database.GetOrdersAscRow(i))
+			}
+		}
 		if err != nil {
 			return nil, fmt.Errorf("getting orders: %w", err)
 		}
@@ -168,11 +357,15 @@ func (m *DBStorage) GetOrders(ctx context.Context, userID uuid.UUID) ([]domain.O
 				return nil, xerrors.WithStack(err)
 			}
 			order := domain.Order{
-				Number:     domain.OrderNumber(i.Number),
-				Status:     status,
-				UserID:     userID,
-				Accrual:    i.Accrual,
-				UploadedAt: i.UploadedAt,
+				Number:        domain.OrderNumber(i.Number),
+				Status:        status,
+				UserID:        userID,
+				Accrual:       i.Accrual,
+				UploadedAt:    i.UploadedAt,
+				CheckedAt:     time.Time{},
+				Attempts:      0,
+				NextAttemptAt: time.Time{},
+				StuckAt:       time.Time{},
 			}
 			orders = append(orders, order)
 		}
@@ -180,57 +373,167 @@ func (m *DBStorage) GetOrders(ctx context.Context, userID uuid.UUID) ([]domain.O
 	})
 }
 
-func (m *DBStorage) GetBalance(ctx context.Context, userID uuid.UUID) (domain.Balance, error) {
-	row, err := m.queries.GetBalance(ctx, userID)
+func (m *DBStorage) OrderExists(ctx context.Context, number domain.OrderNumber) (bool, error) {
+	return orderExists(ctx, m.queries, number)
+}
+
+func orderExists(ctx context.Context, q *database.Queries, number domain.OrderNumber) (bool, error) {
+	_, err := q.GetOrderOwner(ctx, string(number))
 	if err != nil {
-		return domain.Balance{}, fmt.Errorf("getting balance: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("getting order owner: %w", err)
 	}
-	return domain.Balance{Current: row.Current, Withdrawn: row.Withdrawn}, nil
+	return true, nil
 }
 
+// GetOrder returns the user's order. Orders of other users are reported as not found.
+func (m *DBStorage) GetOrder(ctx context.Context, userID uuid.UUID, number domain.OrderNumber) (domain.Order, error) {
+	row, err := m.queries.GetOrder(ctx, string(number))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.Order{}, domain.ErrOrderNotFound
+		}
+		return domain.Order{}, fmt.Errorf("getting order: %w", err)
+	}
+	if row.UserID != userID {
+		return domain.Order{}, domain.ErrOrderNotFound
+	}
+	return newOrder(row)
+}
+
+func newOrder(row database.Order) (domain.Order, error) {
+	status, err := domain.ParseOrderStatus(row.Status)
+	if err != nil {
+		return domain.Order{}, xerrors.WithStack(err)
+	}
+	return domain.Order{
+		Number:        domain.OrderNumber(row.Number),
+		Status:        status,
+		UserID:        row.UserID,
+		Accrual:       row.Accrual,
+		UploadedAt:    row.UploadedAt,
+		CheckedAt:     row.CheckedAt.Time,
+		Attempts:      row.Attempts,
+		NextAttemptAt: row.NextAttemptAt,
+		StuckAt:       row.StuckAt.Time,
+	}, nil
+}
+
+func newOrders(rows []database.Order) ([]domain.Order, error) {
+	orders := make([]domain.Order, 0, len(rows))
+	for _, row := range rows {
+		order, err := newOrder(row)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+func (m *DBStorage) GetBalance(ctx context.Context, userID uuid.UUID) (domain.Balance, error) {
+	return getBalance(ctx, m.queries, userID)
+}
+
+// Withdraw spends sum on the order. Unless allowCollision is set, the order number can't be the number of
+// an uploaded order.
 func (m *DBStorage) Withdraw(
 	ctx context.Context,
 	userID uuid.UUID,
 	order domain.OrderNumber,
 	sum decimal.Decimal,
+	allowCollision bool,
 ) error {
 	_, err := withTx(ctx, m, func(q *database.Queries) (struct{}, error) {
 		err := q.AcquireUserLock(ctx, userID)
 		if err != nil {
 			return struct{}{}, fmt.Errorf("acquiring user lock: %w", err)
 		}
-		balance, err := q.GetBalance(ctx, userID)
+		balance, err := getBalance(ctx, q, userID)
 		if err != nil {
-			return struct{}{}, fmt.Errorf("getting balance: %w", err)
+			return struct{}{}, err
+		}
+		if balance.Current.IsNegative() {
+			return struct{}{}, domain.ErrBalanceInDebt
 		}
 		if balance.Current.Cmp(sum) < 0 {
 			return struct{}{}, domain.ErrNotEnoughFunds
 		}
+		err = checkWithdrawalOrder(ctx, q, order, allowCollision)
+		if err != nil {
+			return struct{}{}, err
+		}
 
-		err = q.InsertWithdrawal(ctx, database.InsertWithdrawalParams{
+		_, err = q.InsertWithdrawal(ctx, database.InsertWithdrawalParams{
 			UserID:      userID,
 			OrderNumber: string(order),
 			Sum:         sum,
 		})
 		if err != nil {
+			var pgError *pgconn.PgError
+			if errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation {
+				return struct{}{}, domain.ErrWithdrawalOrderUsed
+			}
 			return struct{}{}, fmt.Errorf("inserting withdrawal: %w", err)
 		}
+		err = appendLedgerEntry(ctx, q, domain.LedgerEntry{
+			UserID:      userID,
+			Kind:        domain.LedgerEntryKindWithdrawal,
+			Amount:      sum.Neg(),
+			OrderNumber: order,
+		})
+		if err != nil {
+			return struct{}{}, err
+		}
 		return struct{}{}, nil
 	})
 	return err
 }
 
-func (m *DBStorage) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]domain.Withdrawal, error) {
+func (m *DBStorage) GetWithdrawals(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter domain.ListFilter,
+) ([]domain.Withdrawal, error) {
+	var afterID uuid.UUID
+	if filter.After.Key != "" {
+		var err error
+		if afterID, err = uuid.Parse(filter.After.Key); err != nil {
+			return nil, domain.ErrInvalidCursor
+		}
+	}
+	params := database.GetWithdrawalsAscParams{
+		UserID:    userID,
+		FromTime:  pgtype.Timestamptz{Time: filter.From, Valid: !filter.From.IsZero()},
+		ToTime:    pgtype.Timestamptz{Time: filter.To, Valid: !filter.To.IsZero()},
+		AfterTime: pgtype.Timestamptz{Time: filter.After.Time, Valid: !filter.After.Time.IsZero()},
+		AfterID:   afterID,
+		RowLimit:  pgtype.Int4{Int32: filter.Limit, Valid: filter.Limit > 0},
+	}
 	return withTx(ctx, m, func(q *database.Queries) ([]domain.Withdrawal, error) {
-		dbWithdrawals, err := q.GetWithdrawals(ctx, userID)
+		var dbWithdrawals []database.GetWithdrawalsAscRow
+		var err error
+		if filter.Ascending {
+			dbWithdrawals, err = q.GetWithdrawalsAsc(ctx, params)
+		} else {
+			var rows []database.GetWithdrawalsDescRow
+			rows, err = q.GetWithdrawalsDesc(ctx, database.GetWithdrawalsDescParams(params))
+			for _, i := range rows {
+				dbWithdrawals = append(dbWithdrawals, database.GetWithdrawalsAscRow(i))
+			}
+		}
 		if err != nil {
-			return nil, fmt.Errorf("getting orders: %w", err)
+			return nil, fmt.Errorf("getting withdrawals: %w", err)
 		}
 		withdrawals := make([]domain.Withdrawal, 0, len(dbWithdrawals))
 		for _, i := range dbWithdrawals {
 			withdrawals = append(withdrawals, domain.Withdrawal{
+				ID:          i.ID,
 				Order:       domain.OrderNumber(i.OrderNumber),
 				Sum:         i.Sum,
+				Reversed:    i.Reversed,
 				ProcessedAt: i.ProcessedAt,
 			})
 		}
@@ -238,52 +541,199 @@ func (m *DBStorage) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]dom
 	})
 }
 
-func (m *DBStorage) GetOrdersForProcessing(ctx context.Context) ([]domain.Order, error) {
-	return withTx(ctx, m, func(q *database.Queries) ([]domain.Order, error) {
-		dbOrders, err := q.GetOrdersForProcessing(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("getting orders: %w", err)
-		}
-		orders := make([]domain.Order, 0, len(dbOrders))
-		for _, i := range dbOrders {
-			var status domain.OrderStatus
-			status, err = domain.ParseOrderStatus(i.Status)
-			if err != nil {
-				return nil, xerrors.WithStack(err)
-			}
-			order := domain.Order{
-				Number:     domain.OrderNumber(i.Number),
-				Status:     status,
-				UserID:     i.UserID,
-				Accrual:    i.Accrual,
-				UploadedAt: i.UploadedAt,
-			}
-			orders = append(orders, order)
-		}
-		return orders, nil
+// ClaimOrdersForProcessing leases up to limit of the pending orders that are due for a check to owner, longest
+// overdue first. Orders leased to someone else are skipped until their lease runs out, so replicas don't process
+// the same orders. Updating an order's status or marking it checked ends the lease.
+func (m *DBStorage) ClaimOrdersForProcessing(
+	ctx context.Context,
+	owner string,
+	lease time.Duration,
+	limit int32,
+) ([]domain.Order, error) {
+	dbOrders, err := m.queries.ClaimOrdersForProcessing(ctx, database.ClaimOrdersForProcessingParams{
+		RowLimit:     limit,
+		ClaimedBy:    owner,
+		LeaseSeconds: lease.Seconds(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("claiming orders: %w", err)
+	}
+	return newOrders(dbOrders)
+}
+
+// RenewOrderLeases extends owner's leases on the orders that are still pending and returns how many it extended.
+func (m *DBStorage) RenewOrderLeases(
+	ctx context.Context,
+	owner string,
+	orders []domain.OrderNumber,
+	lease time.Duration,
+) (int64, error) {
+	numbers := make([]string, 0, len(orders))
+	for _, i := range orders {
+		numbers = append(numbers, string(i))
+	}
+	n, err := m.queries.RenewOrderLeases(ctx, database.RenewOrderLeasesParams{
+		LeaseSeconds: lease.Seconds(),
+		Numbers:      numbers,
+		ClaimedBy:    owner,
 	})
+	if err != nil {
+		return 0, fmt.Errorf("renewing order leases: %w", err)
+	}
+	return n, nil
 }
 
+// UpdateOrderStatus records the accrual system's answer for a pending order. If the order is still pending, its
+// next check is scheduled by retry, which starts over whenever the status changes.
 func (m *DBStorage) UpdateOrderStatus(
 	ctx context.Context,
 	order domain.OrderNumber,
 	status domain.OrderStatus,
 	accrual decimal.Decimal,
+	retry domain.Backoff,
 ) error {
 	_, err := withTx(ctx, m, func(q *database.Queries) (struct{}, error) {
-		err := q.UpdateOrderStatus(ctx, database.UpdateOrderStatusParams{
-			Number:  string(order),
-			Status:  status.String(),
-			Accrual: accrual,
+		userID, err := q.UpdateOrderStatus(ctx, database.UpdateOrderStatusParams{
+			Status:           status.String(),
+			Accrual:          accrual,
+			RetryBaseSeconds: retry.Base.Seconds(),
+			RetryMaxSeconds:  retry.Max.Seconds(),
+			Number:           string(order),
 		})
 		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				// Already final, the accrual has been credited before.
+				return struct{}{}, nil
+			}
 			return struct{}{}, fmt.Errorf("updating order: %w", err)
 		}
+		if status != domain.OrderStatusPROCESSED || !accrual.IsPositive() {
+			return struct{}{}, nil
+		}
+		err = appendLedgerEntry(ctx, q, domain.LedgerEntry{
+			UserID:      userID,
+			Kind:        domain.LedgerEntryKindAccrual,
+			Amount:      accrual,
+			OrderNumber: order,
+		})
+		if err != nil {
+			return struct{}{}, err
+		}
 		return struct{}{}, nil
 	})
 	return err
 }
 
+// MarkOrderChecked records that the accrual system was asked about the order without a status change and
+// schedules the next check by retry. The order is left alone unless it's pending and leased to owner.
+func (m *DBStorage) MarkOrderChecked(
+	ctx context.Context,
+	owner string,
+	order domain.OrderNumber,
+	retry domain.Backoff,
+) error {
+	err := m.queries.MarkOrderChecked(ctx, database.MarkOrderCheckedParams{
+		RetryBaseSeconds: retry.Base.Seconds(),
+		RetryMaxSeconds:  retry.Max.Seconds(),
+		Number:           string(order),
+		ClaimedBy:        owner,
+	})
+	if err != nil {
+		return fmt.Errorf("marking order checked: %w", err)
+	}
+	return nil
+}
+
+// PostponeOrder schedules the next check of an order the accrual system couldn't be asked about by retry.
+// The order is left alone unless it's pending and leased to owner.
+func (m *DBStorage) PostponeOrder(
+	ctx context.Context,
+	owner string,
+	order domain.OrderNumber,
+	retry domain.Backoff,
+) error {
+	err := m.queries.PostponeOrder(ctx, database.PostponeOrderParams{
+		RetryBaseSeconds: retry.Base.Seconds(),
+		RetryMaxSeconds:  retry.Max.Seconds(),
+		Number:           string(order),
+		ClaimedBy:        owner,
+	})
+	if err != nil {
+		return fmt.Errorf("postponing order: %w", err)
+	}
+	return nil
+}
+
+// ClaimOrdersForRecheck returns up to limit orders processed after processedAfter that haven't been checked
+// since checkedBefore, least recently checked first. They're marked checked as they're claimed, so replicas
+// don't recheck the same orders; an order whose recheck fails waits for the next interval.
+func (m *DBStorage) ClaimOrdersForRecheck(
+	ctx context.Context,
+	processedAfter time.Time,
+	checkedBefore time.Time,
+	limit int32,
+) ([]domain.Order, error) {
+	dbOrders, err := m.queries.ClaimOrdersForRecheck(ctx, database.ClaimOrdersForRecheckParams{
+		ProcessedAfter: pgtype.Timestamptz{Time: processedAfter, Valid: true},
+		CheckedBefore:  pgtype.Timestamptz{Time: checkedBefore, Valid: true},
+		RowLimit:       limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("claiming orders: %w", err)
+	}
+	return newOrders(dbOrders)
+}
+
+// ReviseOrderAccrual applies a later verdict of the accrual system to a processed order. The difference to the
+// credited accrual is recorded as a system adjustment and returned. A clawback may take the balance below zero,
+// the user then can't withdraw until it's repaid. Orders that aren't processed are left alone.
+func (m *DBStorage) ReviseOrderAccrual(
+	ctx context.Context,
+	order domain.OrderNumber,
+	status domain.OrderStatus,
+	accrual decimal.Decimal,
+) (decimal.Decimal, error) {
+	return withTx(ctx, m, func(q *database.Queries) (decimal.Decimal, error) {
+		row, err := q.GetProcessedOrderForUpdate(ctx, string(order))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return decimal.Zero, nil
+			}
+			return decimal.Zero, fmt.Errorf("getting order: %w", err)
+		}
+		delta := accrual.Sub(row.Accrual)
+		if status == domain.OrderStatusPROCESSED && delta.IsZero() {
+			// Nothing to revise, the check was recorded when the order was claimed.
+			return decimal.Zero, nil
+		}
+		err = q.AcquireUserLock(ctx, row.UserID)
+		if err != nil {
+			return decimal.Zero, fmt.Errorf("acquiring user lock: %w", err)
+		}
+		err = q.ReviseOrder(ctx, database.ReviseOrderParams{
+			Number:  string(order),
+			Status:  status.String(),
+			Accrual: accrual,
+		})
+		if err != nil {
+			return decimal.Zero, fmt.Errorf("revising order: %w", err)
+		}
+		if delta.IsZero() {
+			return decimal.Zero, nil
+		}
+		const centsPlaces = 2
+		reason := fmt.Sprintf(
+			"accrual for order %s revised from %s to %s (%s)",
+			order, row.Accrual.StringFixed(centsPlaces), accrual.StringFixed(centsPlaces), status,
+		)
+		_, err = insertAdjustment(ctx, q, domain.NewAdjustment(row.UserID, delta, reason, uuid.Nil), order)
+		if err != nil {
+			return decimal.Zero, err
+		}
+		return delta, nil
+	})
+}
+
 func withTx[T any]( //nolint: nonamedreturns //fine
 	ctx context.Context,
 	db *DBStorage, fn func(q *database.Queries) (T, error),
@@ -361,3 +811,36 @@ func (m *DBStorage) Migrate(action MigrationAction) error {
 	m.logger.Info("migration is complete", slog.String("op", action.String()))
 	return nil
 }
+
+// checkWithdrawalOrder makes sure a withdrawal or hold may use the order number: it isn't used by another one
+// and, unless allowCollision is set, isn't the number of an uploaded order. The number is locked for the rest of
+// the transaction so that an upload of it can't slip in.
+func checkWithdrawalOrder(
+	ctx context.Context,
+	q *database.Queries,
+	order domain.OrderNumber,
+	allowCollision bool,
+) error {
+	err := q.AcquireOrderNumberLocks(ctx, []string{string(order)})
+	if err != nil {
+		return fmt.Errorf("acquiring order number lock: %w", err)
+	}
+	taken, err := q.WithdrawalOrderTaken(ctx, string(order))
+	if err != nil {
+		return fmt.Errorf("checking withdrawal order: %w", err)
+	}
+	if taken {
+		return domain.ErrWithdrawalOrderUsed
+	}
+	if allowCollision {
+		return nil
+	}
+	exists, err := orderExists(ctx, q, order)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return domain.ErrWithdrawalOrderUploaded
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	xerrors "github.com/pkg/errors"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// CreateHold reserves the hold's sum out of the user's available balance. The order number is checked like in
+// Withdraw.
+func (m *DBStorage) CreateHold(
+	ctx context.Context,
+	hold domain.WithdrawalHold,
+	allowCollision bool,
+) (domain.WithdrawalHold, error) {
+	return withTx(ctx, m, func(q *database.Queries) (domain.WithdrawalHold, error) {
+		err := q.AcquireUserLock(ctx, hold.UserID)
+		if err != nil {
+			return domain.WithdrawalHold{}, fmt.Errorf("acquiring user lock: %w", err)
+		}
+		balance, err := getBalance(ctx, q, hold.UserID)
+		if err != nil {
+			return domain.WithdrawalHold{}, err
+		}
+		if balance.Current.IsNegative() {
+			return domain.WithdrawalHold{}, domain.ErrBalanceInDebt
+		}
+		if balance.Current.Cmp(hold.Sum) < 0 {
+			return domain.WithdrawalHold{}, domain.ErrNotEnoughFunds
+		}
+		err = checkWithdrawalOrder(ctx, q, hold.Order, allowCollision)
+		if err != nil {
+			return domain.WithdrawalHold{}, err
+		}
+		row, err := q.InsertHold(ctx, database.InsertHoldParams{
+			ID:          hold.ID,
+			UserID:      hold.UserID,
+			OrderNumber: string(hold.Order),
+			Sum:         hold.Sum,
+			ExpiresAt:   hold.ExpiresAt,
+		})
+		if err != nil {
+			var pgError *pgconn.PgError
+			if errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation {
+				return domain.WithdrawalHold{}, domain.ErrWithdrawalOrderUsed
+			}
+			return domain.WithdrawalHold{}, fmt.Errorf("inserting hold: %w", err)
+		}
+		return newWithdrawalHold(row)
+	})
+}
+
+// GetHold returns the user's hold. Holds of other users are reported as not found.
+func (m *DBStorage) GetHold(ctx context.Context, userID uuid.UUID, holdID uuid.UUID) (domain.WithdrawalHold, error) {
+	row, err := m.queries.GetHold(ctx, holdID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.WithdrawalHold{}, domain.ErrHoldNotFound
+		}
+		return domain.WithdrawalHold{}, fmt.Errorf("getting hold: %w", err)
+	}
+	if row.UserID != userID {
+		return domain.WithdrawalHold{}, domain.ErrHoldNotFound
+	}
+	return newWithdrawalHold(row)
+}
+
+// CaptureHold turns an active hold into a withdrawal. Capturing a captured hold again returns it unchanged.
+// Like withdrawals, captures are blocked while the balance is in debt, e.g. after a clawback.
+func (m *DBStorage) CaptureHold(
+	ctx context.Context,
+	userID uuid.UUID,
+	holdID uuid.UUID,
+) (domain.WithdrawalHold, error) {
+	return withTx(ctx, m, func(q *database.Queries) (domain.WithdrawalHold, error) {
+		hold, err := lockHold(ctx, q, userID, holdID)
+		if err != nil {
+			return domain.WithdrawalHold{}, err
+		}
+		switch hold.Status {
+		case domain.HoldStatusCaptured:
+			return hold, nil
+		case domain.HoldStatusReleased:
+			return domain.WithdrawalHold{}, domain.ErrHoldSettled
+		case domain.HoldStatusExpired:
+			return domain.WithdrawalHold{}, domain.ErrHoldExpired
+		case domain.HoldStatusHeld:
+		}
+		if !hold.ExpiresAt.After(time.Now()) {
+			return domain.WithdrawalHold{}, domain.ErrHoldExpired
+		}
+		balance, err := getBalance(ctx, q, userID)
+		if err != nil {
+			return domain.WithdrawalHold{}, err
+		}
+		// The hold is already taken out of the current balance, so a negative one means the debt isn't repaid.
+		if balance.Current.IsNegative() {
+			return domain.WithdrawalHold{}, domain.ErrBalanceInDebt
+		}
+
+		withdrawalID, err := q.InsertWithdrawal(ctx, database.InsertWithdrawalParams{
+			UserID:      userID,
+			OrderNumber: string(hold.Order),
+			Sum:         hold.Sum,
+		})
+		if err != nil {
+			var pgError *pgconn.PgError
+			if errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation {
+				return domain.WithdrawalHold{}, domain.ErrWithdrawalOrderUsed
+			}
+			return domain.WithdrawalHold{}, fmt.Errorf("inserting withdrawal: %w", err)
+		}
+		err = appendLedgerEntry(ctx, q, domain.LedgerEntry{
+			UserID:      userID,
+			Kind:        domain.LedgerEntryKindWithdrawal,
+			Amount:      hold.Sum.Neg(),
+			OrderNumber: hold.Order,
+		})
+		if err != nil {
+			return domain.WithdrawalHold{}, err
+		}
+		return settleHold(ctx, q, holdID, domain.HoldStatusCaptured, withdrawalID)
+	})
+}
+
+// ReleaseHold gives the held points back. Releasing a released or expired hold again is a no-op.
+func (m *DBStorage) ReleaseHold(
+	ctx context.Context,
+	userID uuid.UUID,
+	holdID uuid.UUID,
+) (domain.WithdrawalHold, error) {
+	return withTx(ctx, m, func(q *database.Queries) (domain.WithdrawalHold, error) {
+		hold, err := lockHold(ctx, q, userID, holdID)
+		if err != nil {
+			return domain.WithdrawalHold{}, err
+		}
+		switch hold.Status {
+		case domain.HoldStatusReleased, domain.HoldStatusExpired:
+			return hold, nil
+		case domain.HoldStatusCaptured:
+			return domain.WithdrawalHold{}, domain.ErrHoldSettled
+		case domain.HoldStatusHeld:
+		}
+		return settleHold(ctx, q, holdID, domain.HoldStatusReleased, uuid.Nil)
+	})
+}
+
+// ExpireHolds releases the holds that are past their expiry and returns how many there were.
+func (m *DBStorage) ExpireHolds(ctx context.Context) (int64, error) {
+	n, err := m.queries.ExpireHolds(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("expiring holds: %w", err)
+	}
+	return n, nil
+}
+
+// lockHold locks the user and then the hold so that settling it is serialized with the user's other
+// balance changes.
+func lockHold(
+	ctx context.Context,
+	q *database.Queries,
+	userID uuid.UUID,
+	holdID uuid.UUID,
+) (domain.WithdrawalHold, error) {
+	err := q.AcquireUserLock(ctx, userID)
+	if err != nil {
+		return domain.WithdrawalHold{}, fmt.Errorf("acquiring user lock: %w", err)
+	}
+	row, err := q.GetHoldForUpdate(ctx, holdID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.WithdrawalHold{}, domain.ErrHoldNotFound
+		}
+		return domain.WithdrawalHold{}, fmt.Errorf("getting hold: %w", err)
+	}
+	if row.UserID != userID {
+		return domain.WithdrawalHold{}, domain.ErrHoldNotFound
+	}
+	return newWithdrawalHold(row)
+}
+
+func settleHold(
+	ctx context.Context,
+	q *database.Queries,
+	holdID uuid.UUID,
+	status domain.HoldStatus,
+	withdrawalID uuid.UUID,
+) (domain.WithdrawalHold, error) {
+	row, err := q.SettleHold(ctx, database.SettleHoldParams{
+		ID:           holdID,
+		Status:       status.String(),
+		WithdrawalID: pgtype.UUID{Bytes: withdrawalID, Valid: withdrawalID != uuid.Nil},
+	})
+	if err != nil {
+		return domain.WithdrawalHold{}, fmt.Errorf("settling hold: %w", err)
+	}
+	return newWithdrawalHold(row)
+}
+
+func newWithdrawalHold(row database.WithdrawalHold) (domain.WithdrawalHold, error) {
+	status, err := domain.ParseHoldStatus(row.Status)
+	if err != nil {
+		return domain.WithdrawalHold{}, xerrors.WithStack(err)
+	}
+	return domain.WithdrawalHold{
+		ID:           row.ID,
+		UserID:       row.UserID,
+		Order:        domain.OrderNumber(row.OrderNumber),
+		Sum:          row.Sum,
+		Status:       status,
+		ExpiresAt:    row.ExpiresAt,
+		CreatedAt:    row.CreatedAt,
+		SettledAt:    row.SettledAt.Time,
+		WithdrawalID: row.WithdrawalID.Bytes,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// ReserveIdempotencyKey claims the key for a new request for lock and returns true. Keys created before
+// expiredBefore are claimed anew, as are keys of the same request that weren't completed within their lock.
+// If the key is taken it returns the request it was taken by.
+func (m *DBStorage) ReserveIdempotencyKey(
+	ctx context.Context,
+	userID uuid.UUID,
+	key string,
+	fingerprint string,
+	lock time.Duration,
+	expiredBefore time.Time,
+) (domain.IdempotentRequest, bool, error) {
+	var reserved bool
+	req, err := withTx(ctx, m, func(q *database.Queries) (domain.IdempotentRequest, error) {
+		n, err := q.InsertIdempotencyKey(ctx, database.InsertIdempotencyKeyParams{
+			UserID:        userID,
+			Key:           key,
+			Fingerprint:   fingerprint,
+			LockSeconds:   lock.Seconds(),
+			ExpiredBefore: expiredBefore,
+		})
+		if err != nil {
+			return domain.IdempotentRequest{}, fmt.Errorf("inserting idempotency key: %w", err)
+		}
+		if n == 1 {
+			reserved = true
+			return domain.IdempotentRequest{Fingerprint: fingerprint, Response: nil}, nil
+		}
+		row, err := q.GetIdempotencyKey(ctx, database.GetIdempotencyKeyParams{UserID: userID, Key: key})
+		if err != nil {
+			return domain.IdempotentRequest{}, fmt.Errorf("getting idempotency key: %w", err)
+		}
+		req := domain.IdempotentRequest{Fingerprint: row.Fingerprint, Response: nil}
+		if row.StatusCode.Valid {
+			req.Response = &domain.IdempotentResponse{
+				StatusCode:  int(row.StatusCode.Int32),
+				ContentType: row.ContentType.String,
+				Body:        row.Body,
+			}
+		}
+		return req, nil
+	})
+	return req, reserved, err
+}
+
+// CompleteIdempotencyKey stores the response to replay for retries with the key.
+func (m *DBStorage) CompleteIdempotencyKey(
+	ctx context.Context,
+	userID uuid.UUID,
+	key string,
+	resp domain.IdempotentResponse,
+) error {
+	err := m.queries.CompleteIdempotencyKey(ctx, database.CompleteIdempotencyKeyParams{
+		UserID:      userID,
+		Key:         key,
+		StatusCode:  pgtype.Int4{Int32: int32(resp.StatusCode), Valid: true}, //nolint: gosec //http status codes fit
+		ContentType: pgtype.Text{String: resp.ContentType, Valid: resp.ContentType != ""},
+		Body:        resp.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("completing idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets the key so that the request can be retried.
+func (m *DBStorage) ReleaseIdempotencyKey(ctx context.Context, userID uuid.UUID, key string) error {
+	err := m.queries.DeleteIdempotencyKey(ctx, database.DeleteIdempotencyKeyParams{UserID: userID, Key: key})
+	if err != nil {
+		return fmt.Errorf("deleting idempotency key: %w", err)
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys deletes the keys created before expiredBefore and returns how many it deleted.
+func (m *DBStorage) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	n, err := m.queries.DeleteExpiredIdempotencyKeys(ctx, expiredBefore)
+	if err != nil {
+		return 0, fmt.Errorf("deleting expired idempotency keys: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	xerrors "github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// appendLedgerEntry records a balance change and applies it to the user's balance snapshot and point lots.
+// It must run in the same transaction as the change it records. The balance row stays locked until the
+// transaction ends, so a user's entries are numbered in the order they apply and each records the balance
+// right after it.
+func appendLedgerEntry(ctx context.Context, q *database.Queries, entry domain.LedgerEntry) error {
+	withdrawn := decimal.Zero
+	if entry.Kind == domain.LedgerEntryKindWithdrawal || entry.Kind == domain.LedgerEntryKindReversal {
+		withdrawn = entry.Amount.Neg()
+	}
+	current, err := q.ApplyToBalance(ctx, database.ApplyToBalanceParams{
+		UserID:    entry.UserID,
+		Amount:    entry.Amount,
+		Withdrawn: withdrawn,
+	})
+	if err != nil {
+		return fmt.Errorf("applying to balance: %w", err)
+	}
+	id, err := q.InsertLedgerEntry(ctx, database.InsertLedgerEntryParams{
+		UserID:       entry.UserID,
+		Kind:         entry.Kind.String(),
+		Amount:       entry.Amount,
+		OrderNumber:  pgtype.Text{String: string(entry.OrderNumber), Valid: entry.OrderNumber != ""},
+		AdjustmentID: pgtype.UUID{Bytes: entry.AdjustmentID, Valid: entry.AdjustmentID != uuid.Nil},
+		ReversalID:   pgtype.UUID{Bytes: entry.ReversalID, Valid: entry.ReversalID != uuid.Nil},
+		BalanceAfter: current,
+	})
+	if err != nil {
+		return fmt.Errorf("inserting ledger entry: %w", err)
+	}
+	if entry.Amount.IsPositive() {
+		return addPointLot(ctx, q, entry.UserID, id, decimal.Min(entry.Amount, current))
+	}
+	return consumePointLots(ctx, q, entry.UserID, id, entry.Amount.Neg())
+}
+
+// getBalance reads the balance snapshot less active holds. Users without any ledger entries have a zero balance.
+func getBalance(ctx context.Context, q *database.Queries, userID uuid.UUID) (domain.Balance, error) {
+	row, err := q.GetBalance(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.Balance{Current: decimal.Zero, Withdrawn: decimal.Zero, Held: decimal.Zero, ExpiringSoon: nil}, nil
+		}
+		return domain.Balance{}, fmt.Errorf("getting balance: %w", err)
+	}
+	return domain.Balance{
+		Current:      row.Current.Sub(row.Held),
+		Withdrawn:    row.Withdrawn,
+		Held:         row.Held,
+		ExpiringSoon: nil,
+	}, nil
+}
+
+// ReconcileBalances returns the users whose balance snapshot doesn't match the sum of their ledger.
+func (m *DBStorage) ReconcileBalances(ctx context.Context) ([]domain.BalanceMismatch, error) {
+	rows, err := m.queries.ReconcileBalances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reconciling balances: %w", err)
+	}
+	mismatches := make([]domain.BalanceMismatch, 0, len(rows))
+	for _, row := range rows {
+		mismatches = append(mismatches, domain.BalanceMismatch{
+			UserID:   row.UserID,
+			Snapshot: domain.Balance{Current: row.SnapshotCurrent, Withdrawn: row.SnapshotWithdrawn, Held: decimal.Zero},
+			Ledger:   domain.Balance{Current: row.LedgerCurrent, Withdrawn: row.LedgerWithdrawn, Held: decimal.Zero},
+		})
+	}
+	return mismatches, nil
+}
+
+// GetStatement returns the user's ledger entries newest first, each with the running balance after it.
+func (m *DBStorage) GetStatement(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter domain.StatementFilter,
+) ([]domain.StatementEntry, error) {
+	rows, err := m.queries.GetStatement(ctx, database.GetStatementParams{
+		UserID:   userID,
+		BeforeID: pgtype.Int8{Int64: filter.BeforeID, Valid: filter.BeforeID != 0},
+		FromTime: pgtype.Timestamptz{Time: filter.From, Valid: !filter.From.IsZero()},
+		ToTime:   pgtype.Timestamptz{Time: filter.To, Valid: !filter.To.IsZero()},
+		RowLimit: filter.Limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting statement: %w", err)
+	}
+	entries := make([]domain.StatementEntry, 0, len(rows))
+	for _, row := range rows {
+		var kind domain.LedgerEntryKind
+		kind, err = domain.ParseLedgerEntryKind(row.Kind)
+		if err != nil {
+			return nil, xerrors.WithStack(err)
+		}
+		entries = append(entries, domain.StatementEntry{
+			LedgerEntry: domain.LedgerEntry{
+				ID:           row.ID,
+				UserID:       userID,
+				Kind:         kind,
+				Amount:       row.Amount,
+				OrderNumber:  domain.OrderNumber(row.OrderNumber.String),
+				AdjustmentID: row.AdjustmentID.Bytes,
+				CreatedAt:    row.CreatedAt,
+			},
+			Reason:  row.Reason.String,
+			Balance: row.BalanceAfter,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+func (m *DBStorage) GetLoginAttempts(
+	ctx context.Context,
+	scope domain.LoginAttemptScope,
+	key string,
+) (domain.LoginAttempts, error) {
+	row, err := m.queries.GetLoginAttempts(ctx, database.GetLoginAttemptsParams{
+		Scope: scope.String(),
+		Key:   key,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.LoginAttempts{}, nil
+		}
+		return domain.LoginAttempts{}, fmt.Errorf("getting login attempts: %w", err)
+	}
+	return domain.LoginAttempts{
+		Failures:      int(row.Failures),
+		LastFailureAt: row.LastFailureAt,
+		LockedUntil:   row.LockedUntil.Time,
+	}, nil
+}
+
+// ReserveLoginAttempt counts an attempt as failed before the credentials are checked, see
+// domain.LoginAttemptReservation. It returns false without reserving if the key is locked or another attempt
+// was reserved since the seen failures were read.
+func (m *DBStorage) ReserveLoginAttempt(
+	ctx context.Context,
+	r domain.LoginAttemptReservation,
+) (domain.LoginAttempts, bool, error) {
+	var seen pgtype.Int4
+	if r.SeenFailures != nil {
+		seen = pgtype.Int4{Int32: int32(*r.SeenFailures), Valid: true} //nolint: gosec //failure counts fit
+	}
+	row, err := m.queries.ReserveLoginAttempt(ctx, database.ReserveLoginAttemptParams{
+		Scope:        r.Scope.String(),
+		Key:          r.Key,
+		Now:          r.Now,
+		MaxFailures:  int32(r.Limit), //nolint: gosec //failure limits fit
+		LockUntil:    r.LockUntil,
+		WindowStart:  r.WindowStart,
+		SeenFailures: seen,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.LoginAttempts{}, false, nil
+		}
+		return domain.LoginAttempts{}, false, fmt.Errorf("reserving login attempt: %w", err)
+	}
+	return domain.LoginAttempts{
+		Failures:      int(row.Failures),
+		LastFailureAt: row.LastFailureAt,
+		LockedUntil:   row.LockedUntil.Time,
+	}, true, nil
+}
+
+// RefundLoginAttempt gives back an attempt reserved by ReserveLoginAttempt that didn't fail. A lock the
+// reservation set is lifted.
+func (m *DBStorage) RefundLoginAttempt(
+	ctx context.Context,
+	scope domain.LoginAttemptScope,
+	key string,
+	reserved domain.LoginAttempts,
+) error {
+	err := m.queries.RefundLoginAttempt(ctx, database.RefundLoginAttemptParams{
+		ReservedLock: pgtype.Timestamptz{
+			Time:             reserved.LockedUntil,
+			InfinityModifier: pgtype.Finite,
+			Valid:            !reserved.LockedUntil.IsZero(),
+		},
+		Scope: scope.String(),
+		Key:   key,
+	})
+	if err != nil {
+		return fmt.Errorf("refunding login attempt: %w", err)
+	}
+	return nil
+}
+
+func (m *DBStorage) ResetLoginAttempts(ctx context.Context, scope domain.LoginAttemptScope, key string) error {
+	err := m.queries.ResetLoginAttempts(ctx, database.ResetLoginAttemptsParams{
+		Scope: scope.String(),
+		Key:   key,
+	})
+	if err != nil {
+		return fmt.Errorf("resetting login attempts: %w", err)
+	}
+	return nil
+}
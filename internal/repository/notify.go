@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+)
+
+// ListenNewOrders calls notify whenever orders are uploaded. It listens on a connection of its own, outside
+// of the pool, and calls notify once it has started listening too, for the orders uploaded while it wasn't.
+// It returns when ctx is done or the connection fails, always with an error.
+func (m *DBStorage) ListenNewOrders(ctx context.Context, notify func()) error {
+	conn, err := pgx.ConnectConfig(ctx, m.db.Config().ConnConfig)
+	if err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+	if err = database.New(conn).ListenNewOrders(ctx); err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+	notify()
+	for {
+		if _, err = conn.WaitForNotification(ctx); err != nil {
+			return fmt.Errorf("waiting for notification: %w", err)
+		}
+		notify()
+	}
+}
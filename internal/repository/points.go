@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// GetPointLots returns the user's lots with points left that were credited before accruedBefore, oldest first.
+func (m *DBStorage) GetPointLots(
+	ctx context.Context,
+	userID uuid.UUID,
+	accruedBefore time.Time,
+) ([]domain.PointLot, error) {
+	rows, err := m.queries.GetPointLots(ctx, database.GetPointLotsParams{
+		UserID:        userID,
+		AccruedBefore: accruedBefore,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting point lots: %w", err)
+	}
+	lots := make([]domain.PointLot, 0, len(rows))
+	for _, row := range rows {
+		lots = append(lots, domain.PointLot{
+			ID:        row.ID,
+			UserID:    row.UserID,
+			Amount:    row.Amount,
+			Remaining: row.Remaining,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+	return lots, nil
+}
+
+// ExpirePoints posts an expiry entry for every user with points credited before accruedBefore still left
+// and returns how many users lost points. Points that back an active hold don't expire.
+func (m *DBStorage) ExpirePoints(ctx context.Context, accruedBefore time.Time) (int64, error) {
+	users, err := m.queries.GetUsersWithExpiredPoints(ctx, accruedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("getting users with expired points: %w", err)
+	}
+	var n int64
+	for _, userID := range users {
+		var expired bool
+		expired, err = withTx(ctx, m, func(q *database.Queries) (bool, error) {
+			return expirePoints(ctx, q, userID, accruedBefore)
+		})
+		if err != nil {
+			return n, err
+		}
+		if expired {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func expirePoints(ctx context.Context, q *database.Queries, userID uuid.UUID, accruedBefore time.Time) (bool, error) {
+	err := q.AcquireUserLock(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("acquiring user lock: %w", err)
+	}
+	expired, err := q.GetExpiredPoints(ctx, database.GetExpiredPointsParams{
+		UserID:        userID,
+		AccruedBefore: accruedBefore,
+	})
+	if err != nil {
+		return false, fmt.Errorf("getting expired points: %w", err)
+	}
+	balance, err := getBalance(ctx, q, userID)
+	if err != nil {
+		return false, err
+	}
+	// Holds are captured from the oldest lots first, so they keep the expired points they need.
+	amount := expired.Sub(balance.Held)
+	if !amount.IsPositive() {
+		return false, nil
+	}
+	err = appendLedgerEntry(ctx, q, domain.LedgerEntry{
+		UserID: userID,
+		Kind:   domain.LedgerEntryKindExpiry,
+		Amount: amount.Neg(),
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// addPointLot starts a lot for a credit. Only the part of the credit left after paying off a negative balance
+// goes into the lot.
+func addPointLot(
+	ctx context.Context,
+	q *database.Queries,
+	userID uuid.UUID,
+	entryID int64,
+	amount decimal.Decimal,
+) error {
+	if !amount.IsPositive() {
+		return nil
+	}
+	err := q.InsertPointLot(ctx, database.InsertPointLotParams{
+		UserID:        userID,
+		LedgerEntryID: pgtype.Int8{Int64: entryID, Valid: true},
+		Amount:        amount,
+	})
+	if err != nil {
+		return fmt.Errorf("inserting point lot: %w", err)
+	}
+	return nil
+}
+
+// consumePointLots takes a debit out of the user's lots, oldest first, and records what it took from each.
+// The part of the debit the lots don't cover is the debt a clawback leaves.
+func consumePointLots(
+	ctx context.Context,
+	q *database.Queries,
+	userID uuid.UUID,
+	entryID int64,
+	amount decimal.Decimal,
+) error {
+	lots, err := q.GetOpenPointLotsForUpdate(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("getting point lots: %w", err)
+	}
+	for _, lot := range lots {
+		if !amount.IsPositive() {
+			break
+		}
+		taken := decimal.Min(lot.Remaining, amount)
+		err = q.ConsumePointLot(ctx, database.ConsumePointLotParams{Amount: taken, ID: lot.ID})
+		if err != nil {
+			return fmt.Errorf("consuming point lot: %w", err)
+		}
+		err = q.InsertPointLotConsumption(ctx, database.InsertPointLotConsumptionParams{
+			LotID:         lot.ID,
+			LedgerEntryID: entryID,
+			Amount:        taken,
+		})
+		if err != nil {
+			return fmt.Errorf("inserting point lot consumption: %w", err)
+		}
+		amount = amount.Sub(taken)
+	}
+	return nil
+}
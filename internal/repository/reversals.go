@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// ReverseWithdrawal refunds the withdrawal made for rev.Order. A zero Amount refunds what is left of it.
+// If a reversal with the same reference was made before, it is returned instead and the bool is false.
+// The operator must not own the withdrawal.
+func (m *DBStorage) ReverseWithdrawal(
+	ctx context.Context,
+	rev domain.WithdrawalReversal,
+) (domain.WithdrawalReversal, bool, error) {
+	var created bool
+	rev, err := withTx(ctx, m, func(q *database.Queries) (domain.WithdrawalReversal, error) {
+		withdrawal, err := q.GetWithdrawalForUpdate(ctx, string(rev.Order))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return domain.WithdrawalReversal{}, domain.ErrWithdrawalNotFound
+			}
+			return domain.WithdrawalReversal{}, fmt.Errorf("getting withdrawal: %w", err)
+		}
+		if withdrawal.UserID == rev.OperatorID {
+			return domain.WithdrawalReversal{}, domain.ErrSelfReversal
+		}
+		rev.WithdrawalID = withdrawal.ID
+		rev.UserID = withdrawal.UserID
+		reference := pgtype.Text{String: rev.Reference, Valid: rev.Reference != ""}
+		if reference.Valid {
+			var prev database.WithdrawalReversal
+			prev, err = q.GetReversalByReference(ctx, database.GetReversalByReferenceParams{
+				WithdrawalID: withdrawal.ID,
+				Reference:    reference,
+			})
+			if err == nil {
+				return domain.WithdrawalReversal{
+					ID:           prev.ID,
+					WithdrawalID: prev.WithdrawalID,
+					UserID:       withdrawal.UserID,
+					Order:        rev.Order,
+					Amount:       prev.Amount,
+					Reason:       prev.Reason,
+					Reference:    prev.Reference.String,
+					OperatorID:   prev.OperatorID.Bytes,
+					CreatedAt:    prev.CreatedAt,
+				}, nil
+			}
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return domain.WithdrawalReversal{}, fmt.Errorf("getting reversal: %w", err)
+			}
+		}
+
+		remaining := withdrawal.Sum.Sub(withdrawal.Reversed)
+		if !remaining.IsPositive() {
+			return domain.WithdrawalReversal{}, domain.ErrWithdrawalReversed
+		}
+		if rev.Amount.IsZero() {
+			rev.Amount = remaining
+		}
+		if rev.Amount.GreaterThan(remaining) {
+			return domain.WithdrawalReversal{}, domain.ErrReversalExceedsWithdrawal
+		}
+
+		err = q.AcquireUserLock(ctx, withdrawal.UserID)
+		if err != nil {
+			return domain.WithdrawalReversal{}, fmt.Errorf("acquiring user lock: %w", err)
+		}
+		rev.CreatedAt, err = q.InsertReversal(ctx, database.InsertReversalParams{
+			ID:           rev.ID,
+			WithdrawalID: withdrawal.ID,
+			Amount:       rev.Amount,
+			Reason:       rev.Reason,
+			Reference:    reference,
+			OperatorID:   pgtype.UUID{Bytes: rev.OperatorID, Valid: rev.OperatorID != uuid.Nil},
+		})
+		if err != nil {
+			return domain.WithdrawalReversal{}, fmt.Errorf("inserting reversal: %w", err)
+		}
+		err = q.AddWithdrawalReversed(ctx, database.AddWithdrawalReversedParams{
+			ID:       withdrawal.ID,
+			Reversed: rev.Amount,
+		})
+		if err != nil {
+			return domain.WithdrawalReversal{}, fmt.Errorf("updating withdrawal: %w", err)
+		}
+		err = appendLedgerEntry(ctx, q, domain.LedgerEntry{
+			UserID:      withdrawal.UserID,
+			Kind:        domain.LedgerEntryKindReversal,
+			Amount:      rev.Amount,
+			OrderNumber: rev.Order,
+			ReversalID:  rev.ID,
+		})
+		if err != nil {
+			return domain.WithdrawalReversal{}, err
+		}
+		created = true
+		return rev, nil
+	})
+	if err != nil {
+		return domain.WithdrawalReversal{}, false, err
+	}
+	return rev, created, nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+func (m *DBStorage) CreateSession(ctx context.Context, session domain.Session, tokenHash string) error {
+	_, err := withTx(ctx, m, func(q *database.Queries) (struct{}, error) {
+		err := q.InsertSession(ctx, database.InsertSessionParams{
+			ID:     session.ID,
+			UserID: session.UserID,
+		})
+		if err != nil {
+			return struct{}{}, fmt.Errorf("inserting session: %w", err)
+		}
+		err = q.InsertRefreshToken(ctx, database.InsertRefreshTokenParams{
+			TokenHash: tokenHash,
+			SessionID: session.ID,
+			ExpiresAt: session.ExpiresAt,
+		})
+		if err != nil {
+			return struct{}{}, fmt.Errorf("inserting refresh token: %w", err)
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one within the same session.
+// Presenting an already used token revokes the whole session: either the legitimate
+// client or an attacker holds a stolen copy, and we can't tell which.
+func (m *DBStorage) RotateRefreshToken(
+	ctx context.Context,
+	oldHash string,
+	newHash string,
+	expiresAt time.Time,
+) (domain.Session, error) {
+	type result struct {
+		session domain.Session
+		reused  bool
+	}
+	res, err := withTx(ctx, m, func(q *database.Queries) (result, error) {
+		token, err := q.SelectRefreshTokenForUpdate(ctx, oldHash)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return result{}, domain.ErrInvalidRefreshToken
+			}
+			return result{}, fmt.Errorf("getting refresh token: %w", err)
+		}
+		if token.RevokedAt.Valid || token.BlockedAt.Valid {
+			return result{}, domain.ErrSessionRevoked
+		}
+		role, err := domain.ParseUserRole(token.Role)
+		if err != nil {
+			return result{}, fmt.Errorf("parsing user role: %w", err)
+		}
+		if token.UsedAt.Valid {
+			if err = q.RevokeSession(ctx, token.SessionID); err != nil {
+				return result{}, fmt.Errorf("revoking session: %w", err)
+			}
+			return result{reused: true}, nil
+		}
+		if !token.ExpiresAt.After(time.Now()) {
+			return result{}, domain.ErrInvalidRefreshToken
+		}
+		if err = q.MarkRefreshTokenUsed(ctx, oldHash); err != nil {
+			return result{}, fmt.Errorf("marking refresh token used: %w", err)
+		}
+		err = q.InsertRefreshToken(ctx, database.InsertRefreshTokenParams{
+			TokenHash: newHash,
+			SessionID: token.SessionID,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return result{}, fmt.Errorf("inserting refresh token: %w", err)
+		}
+		return result{
+			session: domain.Session{ID: token.SessionID, UserID: token.UserID, Role: role, ExpiresAt: expiresAt},
+		}, nil
+	})
+	if err != nil {
+		return domain.Session{}, err
+	}
+	if res.reused {
+		return domain.Session{}, domain.ErrRefreshTokenReused
+	}
+	return res.session, nil
+}
+
+func (m *DBStorage) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	err := m.queries.RevokeSession(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("revoking session: %w", err)
+	}
+	return nil
+}
+
+func (m *DBStorage) IsSessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	active, err := m.queries.IsSessionActive(ctx, sessionID)
+	if err != nil {
+		return false, fmt.Errorf("checking session: %w", err)
+	}
+	return active, nil
+}
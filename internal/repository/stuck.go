@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// MarkOrdersStuck gives up on pending orders checked maxAttempts times with the same answer or waiting on
+// the accrual system since before queuedBefore and returns how many it gave up on. A zero maxAttempts or
+// queuedBefore disables that limit. Orders leased to a replica are left to it.
+func (m *DBStorage) MarkOrdersStuck(ctx context.Context, maxAttempts int32, queuedBefore time.Time) (int64, error) {
+	n, err := m.queries.MarkOrdersStuck(ctx, database.MarkOrdersStuckParams{
+		MaxAttempts:  maxAttempts,
+		QueuedBefore: pgtype.Timestamptz{Time: queuedBefore, Valid: !queuedBefore.IsZero()},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("marking orders stuck: %w", err)
+	}
+	return n, nil
+}
+
+// GetStuckOrders lists stuck orders, longest stuck first.
+func (m *DBStorage) GetStuckOrders(ctx context.Context, limit int32, offset int32) ([]domain.Order, error) {
+	rows, err := m.queries.GetStuckOrders(ctx, database.GetStuckOrdersParams{Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, fmt.Errorf("getting stuck orders: %w", err)
+	}
+	return newOrders(rows)
+}
+
+// RequeueOrder puts a stuck order back to PROCESSING and due for a check right away. Its attempts and the
+// time it has been waiting start over. The accrual worker is notified like of a new order.
+func (m *DBStorage) RequeueOrder(ctx context.Context, number domain.OrderNumber) (domain.Order, error) {
+	return withTx(ctx, m, func(q *database.Queries) (domain.Order, error) {
+		row, err := q.RequeueOrder(ctx, string(number))
+		if err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return domain.Order{}, fmt.Errorf("requeueing order: %w", err)
+			}
+			exists, errExists := orderExists(ctx, q, number)
+			if errExists != nil {
+				return domain.Order{}, errExists
+			}
+			if !exists {
+				return domain.Order{}, domain.ErrOrderNotFound
+			}
+			return domain.Order{}, domain.ErrOrderNotStuck
+		}
+		if err = q.NotifyNewOrders(ctx); err != nil {
+			return domain.Order{}, fmt.Errorf("notifying new orders: %w", err)
+		}
+		return newOrder(row)
+	})
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// SaveTOTPSecret starts or restarts an enrollment. A confirmed enrollment isn't replaced.
+func (m *DBStorage) SaveTOTPSecret(ctx context.Context, userID uuid.UUID, secret []byte) error {
+	n, err := m.queries.UpsertTOTPCredential(ctx, database.UpsertTOTPCredentialParams{
+		UserID: userID,
+		Secret: secret,
+	})
+	if err != nil {
+		return fmt.Errorf("saving totp secret: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+func (m *DBStorage) GetTOTPCredential(ctx context.Context, userID uuid.UUID) (domain.TOTPCredential, error) {
+	row, err := m.queries.SelectTOTPCredential(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.TOTPCredential{}, domain.ErrTOTPNotEnabled
+		}
+		return domain.TOTPCredential{}, fmt.Errorf("getting totp credential: %w", err)
+	}
+	return domain.TOTPCredential{
+		Secret:       row.Secret,
+		LastUsedStep: row.LastUsedStep,
+		Confirmed:    row.ConfirmedAt.Valid,
+	}, nil
+}
+
+// ConfirmTOTP completes an enrollment and replaces the user's recovery codes.
+func (m *DBStorage) ConfirmTOTP(ctx context.Context, userID uuid.UUID, step int64, codeHashes []string) error {
+	_, err := withTx(ctx, m, func(q *database.Queries) (struct{}, error) {
+		n, err := q.ConfirmTOTPCredential(ctx, database.ConfirmTOTPCredentialParams{
+			UserID:       userID,
+			LastUsedStep: step,
+		})
+		if err != nil {
+			return struct{}{}, fmt.Errorf("confirming totp: %w", err)
+		}
+		if n == 0 {
+			return struct{}{}, domain.ErrTOTPAlreadyEnabled
+		}
+		if err = q.DeleteRecoveryCodes(ctx, userID); err != nil {
+			return struct{}{}, fmt.Errorf("deleting recovery codes: %w", err)
+		}
+		err = q.InsertRecoveryCodes(ctx, database.InsertRecoveryCodesParams{
+			UserID:     userID,
+			CodeHashes: codeHashes,
+		})
+		if err != nil {
+			return struct{}{}, fmt.Errorf("inserting recovery codes: %w", err)
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// UseTOTPStep records a step as used. It reports false if the step or a later one was already used.
+func (m *DBStorage) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	n, err := m.queries.UseTOTPStep(ctx, database.UseTOTPStepParams{Step: step, UserID: userID})
+	if err != nil {
+		return false, fmt.Errorf("using totp step: %w", err)
+	}
+	return n > 0, nil
+}
+
+// UseRecoveryCode burns a recovery code. It reports false if the code is unknown or already used.
+func (m *DBStorage) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	n, err := m.queries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{UserID: userID, CodeHash: codeHash})
+	if err != nil {
+		return false, fmt.Errorf("using recovery code: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (m *DBStorage) DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	_, err := withTx(ctx, m, func(q *database.Queries) (struct{}, error) {
+		if err := q.DeleteRecoveryCodes(ctx, userID); err != nil {
+			return struct{}{}, fmt.Errorf("deleting recovery codes: %w", err)
+		}
+		if err := q.DeleteTOTPCredential(ctx, userID); err != nil {
+			return struct{}{}, fmt.Errorf("deleting totp credential: %w", err)
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+func (m *DBStorage) CreateMFAChallenge(
+	ctx context.Context,
+	tokenHash string,
+	userID uuid.UUID,
+	expiresAt time.Time,
+) error {
+	_, err := withTx(ctx, m, func(q *database.Queries) (struct{}, error) {
+		if err := q.DeleteExpiredMFAChallenges(ctx); err != nil {
+			return struct{}{}, fmt.Errorf("deleting expired mfa challenges: %w", err)
+		}
+		err := q.InsertMFAChallenge(ctx, database.InsertMFAChallengeParams{
+			TokenHash: tokenHash,
+			UserID:    userID,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return struct{}{}, fmt.Errorf("inserting mfa challenge: %w", err)
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+func (m *DBStorage) GetMFAChallenge(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	userID, err := m.queries.SelectMFAChallenge(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.UUID{}, domain.ErrInvalidMFAToken
+		}
+		return uuid.UUID{}, fmt.Errorf("getting mfa challenge: %w", err)
+	}
+	return userID, nil
+}
+
+// DeleteMFAChallenge consumes a challenge. It fails if the challenge was already consumed.
+func (m *DBStorage) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	n, err := m.queries.DeleteMFAChallenge(ctx, tokenHash)
+	if err != nil {
+		return fmt.Errorf("deleting mfa challenge: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrInvalidMFAToken
+	}
+	return nil
+}
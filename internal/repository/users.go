@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/ttl256/gophermart-loyalty/internal/database"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+func (m *DBStorage) ListUsers(ctx context.Context, limit int32, offset int32) ([]domain.User, error) {
+	rows, err := m.queries.SelectUsers(ctx, database.SelectUsersParams{Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, fmt.Errorf("getting users: %w", err)
+	}
+	users := make([]domain.User, 0, len(rows))
+	for _, row := range rows {
+		user, err := newUser(row.ID, row.Login, row.Role, row.BlockedAt, row.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// SetUserRole changes the role and revokes the user's sessions so that tokens carrying the old role stop working.
+func (m *DBStorage) SetUserRole(ctx context.Context, userID uuid.UUID, role domain.UserRole) error {
+	_, err := withTx(ctx, m, func(q *database.Queries) (struct{}, error) {
+		n, err := q.UpdateUserRole(ctx, database.UpdateUserRoleParams{ID: userID, Role: role.String()})
+		if err != nil {
+			return struct{}{}, fmt.Errorf("updating role: %w", err)
+		}
+		if n == 0 {
+			return struct{}{}, domain.ErrUserNotFound
+		}
+		if err = q.RevokeUserSessions(ctx, userID); err != nil {
+			return struct{}{}, fmt.Errorf("revoking sessions: %w", err)
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// BlockUser marks the user blocked and revokes all of their sessions.
+func (m *DBStorage) BlockUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := withTx(ctx, m, func(q *database.Queries) (struct{}, error) {
+		n, err := q.BlockUser(ctx, userID)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("blocking user: %w", err)
+		}
+		if n == 0 {
+			return struct{}{}, domain.ErrUserNotFound
+		}
+		if err = q.RevokeUserSessions(ctx, userID); err != nil {
+			return struct{}{}, fmt.Errorf("revoking sessions: %w", err)
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+func (m *DBStorage) UnblockUser(ctx context.Context, userID uuid.UUID) error {
+	n, err := m.queries.UnblockUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("unblocking user: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func newUser(
+	id uuid.UUID,
+	login string,
+	role string,
+	blockedAt pgtype.Timestamptz,
+	createdAt time.Time,
+) (domain.User, error) {
+	r, err := domain.ParseUserRole(role)
+	if err != nil {
+		return domain.User{}, fmt.Errorf("parsing user role: %w", err)
+	}
+	return domain.User{
+		ID:        id,
+		Login:     login,
+		Role:      r,
+		Blocked:   blockedAt.Valid,
+		CreatedAt: createdAt,
+	}, nil
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+func (s *AuthService) ListUsers(ctx context.Context, limit int32, offset int32) ([]domain.User, error) {
+	users, err := s.repo.ListUsers(ctx, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("listing users: %w", err)
+	}
+	return users, nil
+}
+
+func (s *AuthService) GetUser(ctx context.Context, userID uuid.UUID) (domain.User, error) {
+	user, _, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.User{}, fmt.Errorf("getting user: %w", err)
+	}
+	return user, nil
+}
+
+// SetUserRole changes the user's role. The user has to log in again for it to take effect.
+func (s *AuthService) SetUserRole(ctx context.Context, userID uuid.UUID, role domain.UserRole) error {
+	if err := s.repo.SetUserRole(ctx, userID, role); err != nil {
+		return fmt.Errorf("setting user role: %w", err)
+	}
+	return nil
+}
+
+// BlockUser ends the user's sessions and denies further logins and API key use until unblocked.
+func (s *AuthService) BlockUser(ctx context.Context, userID uuid.UUID) error {
+	if err := s.repo.BlockUser(ctx, userID); err != nil {
+		return fmt.Errorf("blocking user: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthService) UnblockUser(ctx context.Context, userID uuid.UUID) error {
+	if err := s.repo.UnblockUser(ctx, userID); err != nil {
+		return fmt.Errorf("unblocking user: %w", err)
+	}
+	return nil
+}
@@ -2,8 +2,12 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/google/uuid"
 	"github.com/ttl256/gophermart-loyalty/internal/auth"
 	"github.com/ttl256/gophermart-loyalty/internal/domain"
@@ -12,20 +16,107 @@ import (
 type UserRepo interface {
 	CreateUser(ctx context.Context, user domain.User, password auth.PasswordHash) (uuid.UUID, error)
 	GetUserByLogin(ctx context.Context, login string) (domain.User, auth.PasswordHash, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (domain.User, auth.PasswordHash, error)
+	ListUsers(ctx context.Context, limit int32, offset int32) ([]domain.User, error)
+	SetUserRole(ctx context.Context, userID uuid.UUID, role domain.UserRole) error
+	BlockUser(ctx context.Context, userID uuid.UUID) error
+	UnblockUser(ctx context.Context, userID uuid.UUID) error
+	UpdatePasswordHash(
+		ctx context.Context,
+		userID uuid.UUID,
+		oldHash auth.PasswordHash,
+		newHash auth.PasswordHash,
+	) (bool, error)
+	ChangePassword(
+		ctx context.Context,
+		userID uuid.UUID,
+		oldHash auth.PasswordHash,
+		newHash auth.PasswordHash,
+		keepSessionID uuid.UUID,
+	) error
+	CreateSession(ctx context.Context, session domain.Session, tokenHash string) error
+	RotateRefreshToken(ctx context.Context, oldHash string, newHash string, expiresAt time.Time) (domain.Session, error)
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
+	IsSessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error)
+	GetLoginAttempts(ctx context.Context, scope domain.LoginAttemptScope, key string) (domain.LoginAttempts, error)
+	ReserveLoginAttempt(ctx context.Context, r domain.LoginAttemptReservation) (domain.LoginAttempts, bool, error)
+	RefundLoginAttempt(
+		ctx context.Context,
+		scope domain.LoginAttemptScope,
+		key string,
+		reserved domain.LoginAttempts,
+	) error
+	ResetLoginAttempts(ctx context.Context, scope domain.LoginAttemptScope, key string) error
+	CreateAPIKey(ctx context.Context, key domain.APIKey, keyHash string) (domain.APIKey, error)
+	GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]domain.APIKey, error)
+	UseAPIKey(ctx context.Context, keyHash string) (domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID) error
+	SaveTOTPSecret(ctx context.Context, userID uuid.UUID, secret []byte) error
+	GetTOTPCredential(ctx context.Context, userID uuid.UUID) (domain.TOTPCredential, error)
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, step int64, codeHashes []string) error
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+	DeleteTOTP(ctx context.Context, userID uuid.UUID) error
+	CreateMFAChallenge(ctx context.Context, tokenHash string, userID uuid.UUID, expiresAt time.Time) error
+	GetMFAChallenge(ctx context.Context, tokenHash string) (uuid.UUID, error)
+	DeleteMFAChallenge(ctx context.Context, tokenHash string) error
+}
+
+type AuthConfig struct {
+	Hasher          *auth.Hasher
+	PasswordPolicy  *auth.PasswordPolicy
+	RefreshTokenTTL time.Duration
+	// MaxLoginFailures locks a login after that many failures within FailureWindow.
+	MaxLoginFailures int
+	// MaxAddressFailures locks a client address after that many failures within FailureWindow.
+	MaxAddressFailures int
+	FailureWindow      time.Duration
+	LockoutDuration    time.Duration
+	// LoginBaseDelay is the pause required after the first failure, doubled with every next one.
+	LoginBaseDelay time.Duration
+	// TOTPCipher encrypts TOTP secrets at rest. Two-factor authentication is unavailable without it.
+	TOTPCipher      *auth.SecretBox
+	TOTPIssuer      string
+	MFAChallengeTTL time.Duration
+	RecoveryCodes   int
+}
+
+func DefaultAuthConfig() AuthConfig {
+	return AuthConfig{
+		Hasher:             auth.NewHasher(argon2id.DefaultParams),
+		PasswordPolicy:     auth.NewPasswordPolicy(1, 256), //nolint: mnd //fine
+		RefreshTokenTTL:    30 * 24 * time.Hour,            //nolint: mnd //fine
+		MaxLoginFailures:   5,                              //nolint: mnd //fine
+		MaxAddressFailures: 50,                             //nolint: mnd //fine
+		FailureWindow:      15 * time.Minute,               //nolint: mnd //fine
+		LockoutDuration:    15 * time.Minute,               //nolint: mnd //fine
+		LoginBaseDelay:     time.Second,
+		TOTPCipher:         nil,
+		TOTPIssuer:         "Gophermart",
+		MFAChallengeTTL:    5 * time.Minute, //nolint: mnd //fine
+		RecoveryCodes:      10,              //nolint: mnd //fine
+	}
 }
 
 type AuthService struct {
-	repo UserRepo
+	repo   UserRepo
+	cfg    AuthConfig
+	logger *slog.Logger
 }
 
-func NewAuthService(repo UserRepo) *AuthService {
+func NewAuthService(repo UserRepo, cfg AuthConfig) *AuthService {
 	return &AuthService{
-		repo: repo,
+		repo:   repo,
+		cfg:    cfg,
+		logger: slog.Default(),
 	}
 }
 
 func (s *AuthService) RegisterUser(ctx context.Context, user domain.User, password string) (uuid.UUID, error) {
-	hash, err := auth.NewHashPassword(password)
+	if err := s.cfg.PasswordPolicy.Validate(password); err != nil {
+		return uuid.UUID{}, fmt.Errorf("validating password: %w", err)
+	}
+	hash, err := s.cfg.Hasher.Hash(password)
 	if err != nil {
 		return uuid.UUID{}, fmt.Errorf("hashing password: %w", err)
 	}
@@ -36,7 +127,95 @@ func (s *AuthService) RegisterUser(ctx context.Context, user domain.User, passwo
 	return id, nil
 }
 
-func (s *AuthService) LoginUser(ctx context.Context, login string, password string) (domain.User, error) {
+// LoginUser checks credentials unless the login or the client address is throttled.
+// The attempt is reserved before the password hash is computed so lockouts are cheap and concurrent
+// attempts can't slip past them. Blocked users are told so only after presenting the right password.
+func (s *AuthService) LoginUser(
+	ctx context.Context,
+	login string,
+	password string,
+	address string,
+) (domain.User, error) {
+	attempt, err := s.reserveAttempt(ctx, login, address, time.Now())
+	if err != nil {
+		return domain.User{}, err
+	}
+	user, err := s.authenticate(ctx, login, password)
+	if err != nil {
+		if !errors.Is(err, domain.ErrInvalidCredentials) {
+			return domain.User{}, errors.Join(err, s.refundAttempt(ctx, attempt))
+		}
+		return domain.User{}, err
+	}
+	if err = s.refundAttempt(ctx, attempt); err != nil {
+		return domain.User{}, err
+	}
+	if err = s.repo.ResetLoginAttempts(ctx, domain.LoginAttemptScopeLogin, login); err != nil {
+		return domain.User{}, fmt.Errorf("resetting login attempts: %w", err)
+	}
+	if user.Blocked {
+		return domain.User{}, domain.ErrUserBlocked
+	}
+	return user, nil
+}
+
+// ChangePassword replaces the password after checking the current one and revokes
+// every session except the one the change was made from.
+func (s *AuthService) ChangePassword(
+	ctx context.Context,
+	userID uuid.UUID,
+	sessionID uuid.UUID,
+	oldPassword string,
+	newPassword string,
+	address string,
+) error {
+	user, hash, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+	attempt, err := s.reserveAttempt(ctx, user.Login, address, time.Now())
+	if err != nil {
+		return err
+	}
+	ok, err := hash.ComparePassword(oldPassword)
+	if err != nil {
+		return errors.Join(fmt.Errorf("comparing hash: %w", err), s.refundAttempt(ctx, attempt))
+	}
+	if !ok {
+		return domain.ErrInvalidCredentials
+	}
+	if err = s.refundAttempt(ctx, attempt); err != nil {
+		return err
+	}
+	if err = s.cfg.PasswordPolicy.Validate(newPassword); err != nil {
+		return fmt.Errorf("validating password: %w", err)
+	}
+	newHash, err := s.cfg.Hasher.Hash(newPassword)
+	if err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+	if err = s.repo.ChangePassword(ctx, userID, hash, newHash, sessionID); err != nil {
+		return fmt.Errorf("changing password: %w", err)
+	}
+	return nil
+}
+
+// UnlockLogin clears failed attempts and lockouts for a login and a client address. Empty values are skipped.
+func (s *AuthService) UnlockLogin(ctx context.Context, login string, address string) error {
+	if login != "" {
+		if err := s.repo.ResetLoginAttempts(ctx, domain.LoginAttemptScopeLogin, login); err != nil {
+			return fmt.Errorf("unlocking login: %w", err)
+		}
+	}
+	if address != "" {
+		if err := s.repo.ResetLoginAttempts(ctx, domain.LoginAttemptScopeAddress, address); err != nil {
+			return fmt.Errorf("unlocking address: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *AuthService) authenticate(ctx context.Context, login string, password string) (domain.User, error) {
 	user, hash, err := s.repo.GetUserByLogin(ctx, login)
 	if err != nil {
 		return domain.User{}, fmt.Errorf("getting user: %w", err)
@@ -48,5 +227,234 @@ func (s *AuthService) LoginUser(ctx context.Context, login string, password stri
 	if !ok {
 		return domain.User{}, domain.ErrInvalidCredentials
 	}
+	s.rehash(ctx, user.ID, hash, password)
 	return user, nil
 }
+
+// rehash upgrades a hash created with outdated parameters. Failing to do so doesn't fail the login.
+func (s *AuthService) rehash(ctx context.Context, userID uuid.UUID, hash auth.PasswordHash, password string) {
+	if !s.cfg.Hasher.NeedsRehash(hash) {
+		return
+	}
+	newHash, err := s.cfg.Hasher.Hash(password)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "rehashing password", slog.Any("error", err))
+		return
+	}
+	if _, err = s.repo.UpdatePasswordHash(ctx, userID, hash, newHash); err != nil {
+		s.logger.ErrorContext(ctx, "rehashing password", slog.Any("error", err))
+		return
+	}
+	s.logger.InfoContext(ctx, "password rehashed", slog.String("user_id", userID.String()))
+}
+
+// checkThrottle fails if the login or the client address is locked or the login has to wait after its last
+// failure. It returns the attempts of the login it went by.
+func (s *AuthService) checkThrottle(
+	ctx context.Context,
+	login string,
+	address string,
+	now time.Time,
+) (domain.LoginAttempts, error) {
+	byLogin, err := s.repo.GetLoginAttempts(ctx, domain.LoginAttemptScopeLogin, login)
+	if err != nil {
+		return domain.LoginAttempts{}, fmt.Errorf("getting login attempts: %w", err)
+	}
+	if byLogin.LockedUntil.After(now) {
+		return domain.LoginAttempts{}, domain.AccountLockedError{RetryAfter: byLogin.LockedUntil.Sub(now)}
+	}
+	byAddress, err := s.repo.GetLoginAttempts(ctx, domain.LoginAttemptScopeAddress, address)
+	if err != nil {
+		return domain.LoginAttempts{}, fmt.Errorf("getting address attempts: %w", err)
+	}
+	if byAddress.LockedUntil.After(now) {
+		return domain.LoginAttempts{}, domain.LoginThrottledError{RetryAfter: byAddress.LockedUntil.Sub(now)}
+	}
+	if wait := s.delay(byLogin, now); wait > 0 {
+		return domain.LoginAttempts{}, domain.LoginThrottledError{RetryAfter: wait}
+	}
+	return byLogin, nil
+}
+
+// delay returns how long a client has to wait after the last failure: LoginBaseDelay doubled per failure.
+func (s *AuthService) delay(attempts domain.LoginAttempts, now time.Time) time.Duration {
+	if attempts.Failures == 0 || s.cfg.LoginBaseDelay <= 0 {
+		return 0
+	}
+	if attempts.LastFailureAt.Before(now.Add(-s.cfg.FailureWindow)) {
+		return 0
+	}
+	delay := s.cfg.LoginBaseDelay
+	for range attempts.Failures - 1 {
+		delay *= 2
+		if delay >= s.cfg.LockoutDuration {
+			delay = s.cfg.LockoutDuration
+			break
+		}
+	}
+	return attempts.LastFailureAt.Add(delay).Sub(now)
+}
+
+// reservedAttempt is an attempt counted as failed by reserveAttempt until it's refunded.
+type reservedAttempt struct {
+	login     string
+	address   string
+	byLogin   domain.LoginAttempts
+	byAddress domain.LoginAttempts
+}
+
+// reserveAttempt counts an attempt as failed for the login and the client address before the credentials are
+// checked, locking them once their limit is reached. The login's attempt is only reserved if no other one was
+// since its throttle was checked, so concurrent attempts can't all get past it. Attempts that don't fail must
+// be handed to refundAttempt.
+func (s *AuthService) reserveAttempt(
+	ctx context.Context,
+	login string,
+	address string,
+	now time.Time,
+) (reservedAttempt, error) {
+	seen, err := s.checkThrottle(ctx, login, address, now)
+	if err != nil {
+		return reservedAttempt{}, err
+	}
+	byLogin, ok, err := s.repo.ReserveLoginAttempt(ctx, domain.LoginAttemptReservation{
+		Scope:        domain.LoginAttemptScopeLogin,
+		Key:          login,
+		SeenFailures: &seen.Failures,
+		Limit:        s.cfg.MaxLoginFailures,
+		Now:          now,
+		WindowStart:  now.Add(-s.cfg.FailureWindow),
+		LockUntil:    now.Add(s.cfg.LockoutDuration),
+	})
+	if err != nil {
+		return reservedAttempt{}, fmt.Errorf("reserving login attempt: %w", err)
+	}
+	if !ok {
+		return reservedAttempt{}, s.throttled(ctx, login, address, now)
+	}
+	byAddress, ok, err := s.repo.ReserveLoginAttempt(ctx, domain.LoginAttemptReservation{
+		Scope:        domain.LoginAttemptScopeAddress,
+		Key:          address,
+		SeenFailures: nil,
+		Limit:        s.cfg.MaxAddressFailures,
+		Now:          now,
+		WindowStart:  now.Add(-s.cfg.FailureWindow),
+		LockUntil:    now.Add(s.cfg.LockoutDuration),
+	})
+	if err != nil || !ok {
+		errRefund := s.repo.RefundLoginAttempt(ctx, domain.LoginAttemptScopeLogin, login, byLogin)
+		if err != nil {
+			return reservedAttempt{}, errors.Join(fmt.Errorf("reserving address attempt: %w", err), errRefund)
+		}
+		return reservedAttempt{}, errors.Join(s.throttled(ctx, login, address, now), errRefund)
+	}
+	return reservedAttempt{login: login, address: address, byLogin: byLogin, byAddress: byAddress}, nil
+}
+
+// throttled explains why an attempt couldn't be reserved. If the throttle passes by now, another attempt got
+// reserved in between and the client is asked to wait the base delay.
+func (s *AuthService) throttled(ctx context.Context, login string, address string, now time.Time) error {
+	if _, err := s.checkThrottle(ctx, login, address, now); err != nil {
+		return err
+	}
+	return domain.LoginThrottledError{RetryAfter: max(s.cfg.LoginBaseDelay, time.Second)}
+}
+
+// refundAttempt gives back an attempt that didn't fail.
+func (s *AuthService) refundAttempt(ctx context.Context, attempt reservedAttempt) error {
+	err := s.repo.RefundLoginAttempt(ctx, domain.LoginAttemptScopeLogin, attempt.login, attempt.byLogin)
+	if err != nil {
+		return fmt.Errorf("refunding login attempt: %w", err)
+	}
+	err = s.repo.RefundLoginAttempt(ctx, domain.LoginAttemptScopeAddress, attempt.address, attempt.byAddress)
+	if err != nil {
+		return fmt.Errorf("refunding address attempt: %w", err)
+	}
+	return nil
+}
+
+// StartSession opens a new session for the user and returns its first refresh token.
+// Blocked users can't start sessions.
+func (s *AuthService) StartSession(ctx context.Context, userID uuid.UUID) (domain.Session, auth.RefreshToken, error) {
+	user, _, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.Session{}, "", fmt.Errorf("getting user: %w", err)
+	}
+	if user.Blocked {
+		return domain.Session{}, "", domain.ErrUserBlocked
+	}
+	session := domain.NewSession(userID, user.Role, time.Now().Add(s.cfg.RefreshTokenTTL))
+	token := auth.NewRefreshToken()
+	if err := s.repo.CreateSession(ctx, session, token.Hash()); err != nil {
+		return domain.Session{}, "", fmt.Errorf("creating session: %w", err)
+	}
+	return session, token, nil
+}
+
+// RefreshSession rotates the refresh token. The presented token can't be used again.
+func (s *AuthService) RefreshSession(
+	ctx context.Context,
+	token auth.RefreshToken,
+) (domain.Session, auth.RefreshToken, error) {
+	next := auth.NewRefreshToken()
+	session, err := s.repo.RotateRefreshToken(ctx, token.Hash(), next.Hash(), time.Now().Add(s.cfg.RefreshTokenTTL))
+	if err != nil {
+		return domain.Session{}, "", fmt.Errorf("rotating refresh token: %w", err)
+	}
+	return session, next, nil
+}
+
+func (s *AuthService) EndSession(ctx context.Context, sessionID uuid.UUID) error {
+	if err := s.repo.RevokeSession(ctx, sessionID); err != nil {
+		return fmt.Errorf("ending session: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthService) SessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	active, err := s.repo.IsSessionActive(ctx, sessionID)
+	if err != nil {
+		return false, fmt.Errorf("checking session: %w", err)
+	}
+	return active, nil
+}
+
+// CreateAPIKey issues a named key limited to scopes. The key itself is returned only here.
+func (s *AuthService) CreateAPIKey(
+	ctx context.Context,
+	userID uuid.UUID,
+	name string,
+	scopes []domain.APIKeyScope,
+) (domain.APIKey, auth.APIKey, error) {
+	secret := auth.NewAPIKey()
+	key := domain.NewAPIKey(userID, name, secret.Prefix(), scopes)
+	key, err := s.repo.CreateAPIKey(ctx, key, secret.Hash())
+	if err != nil {
+		return domain.APIKey{}, "", fmt.Errorf("creating api key: %w", err)
+	}
+	return key, secret, nil
+}
+
+func (s *AuthService) GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]domain.APIKey, error) {
+	keys, err := s.repo.GetAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("getting api keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *AuthService) RevokeAPIKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID) error {
+	if err := s.repo.RevokeAPIKey(ctx, userID, keyID); err != nil {
+		return fmt.Errorf("revoking api key: %w", err)
+	}
+	return nil
+}
+
+// AuthenticateAPIKey resolves an active key. Revoked and unknown keys yield domain.ErrInvalidAPIKey.
+func (s *AuthService) AuthenticateAPIKey(ctx context.Context, secret auth.APIKey) (domain.APIKey, error) {
+	key, err := s.repo.UseAPIKey(ctx, secret.Hash())
+	if err != nil {
+		return domain.APIKey{}, fmt.Errorf("authenticating api key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	xerrors "github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// HoldWithdrawal reserves sum for the order until the hold is captured or released. A zero ttl means the
+// configured default.
+func (s *OrderService) HoldWithdrawal(
+	ctx context.Context,
+	userID uuid.UUID,
+	orderRaw string,
+	sum decimal.Decimal,
+	ttl time.Duration,
+) (domain.WithdrawalHold, error) {
+	if ttl == 0 {
+		ttl = s.cfg.HoldTTL
+	}
+	if ttl < 0 || ttl > s.cfg.MaxHoldTTL {
+		return domain.WithdrawalHold{}, domain.ErrInvalidHoldTTL
+	}
+	order, err := domain.NewOrderNumber(orderRaw)
+	if err != nil {
+		return domain.WithdrawalHold{}, fmt.Errorf("invalid order number: %w", err)
+	}
+	hold, err := s.repo.CreateHold(
+		ctx, domain.NewWithdrawalHold(userID, order, sum, time.Now().Add(ttl)), s.cfg.AllowWithdrawalOrderCollision,
+	)
+	if err != nil {
+		return domain.WithdrawalHold{}, fmt.Errorf("holding withdrawal: %w", err)
+	}
+	return hold, nil
+}
+
+func (s *OrderService) GetHold(ctx context.Context, userID uuid.UUID, holdID uuid.UUID) (domain.WithdrawalHold, error) {
+	hold, err := s.repo.GetHold(ctx, userID, holdID)
+	if err != nil {
+		return domain.WithdrawalHold{}, fmt.Errorf("getting hold: %w", err)
+	}
+	return hold, nil
+}
+
+// CaptureHold spends the held points as a withdrawal.
+func (s *OrderService) CaptureHold(
+	ctx context.Context,
+	userID uuid.UUID,
+	holdID uuid.UUID,
+) (domain.WithdrawalHold, error) {
+	hold, err := s.repo.CaptureHold(ctx, userID, holdID)
+	if err != nil {
+		return domain.WithdrawalHold{}, fmt.Errorf("capturing hold: %w", err)
+	}
+	return hold, nil
+}
+
+func (s *OrderService) ReleaseHold(
+	ctx context.Context,
+	userID uuid.UUID,
+	holdID uuid.UUID,
+) (domain.WithdrawalHold, error) {
+	hold, err := s.repo.ReleaseHold(ctx, userID, holdID)
+	if err != nil {
+		return domain.WithdrawalHold{}, fmt.Errorf("releasing hold: %w", err)
+	}
+	return hold, nil
+}
+
+type HoldExpirer interface {
+	ExpireHolds(ctx context.Context) (int64, error)
+}
+
+// HoldSweeper periodically expires holds that were neither captured nor released in time. Expired holds
+// no longer count against the balance even before they are swept, sweeping frees their order numbers.
+type HoldSweeper struct {
+	repo   HoldExpirer
+	freq   time.Duration
+	logger *slog.Logger
+}
+
+func NewHoldSweeper(repo HoldExpirer, freq time.Duration) *HoldSweeper {
+	return &HoldSweeper{
+		repo:   repo,
+		freq:   freq,
+		logger: slog.Default(),
+	}
+}
+
+func (s *HoldSweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.freq)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return xerrors.WithStack(ctx.Err())
+		case <-ticker.C:
+			n, err := s.repo.ExpireHolds(ctx)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "expiring holds", slog.Any("error", err))
+				continue
+			}
+			if n > 0 {
+				s.logger.InfoContext(ctx, "expired holds", slog.Int64("count", n))
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	xerrors "github.com/pkg/errors"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+const (
+	// idempotencyKeyTTL is how long a key is remembered. Afterwards it may be reused for another request.
+	idempotencyKeyTTL = 24 * time.Hour
+	// idempotencyKeyLock is how long the request that reserved a key has to complete it. If it crashed before,
+	// a retry takes the key over afterwards. It outlasts the server's write timeout.
+	idempotencyKeyLock = time.Minute
+)
+
+// BeginIdempotent claims the idempotency key for a request with the given fingerprint. It returns nil when
+// the request should be handled and the stored response when it is a retry of a completed request.
+func (s *OrderService) BeginIdempotent(
+	ctx context.Context,
+	userID uuid.UUID,
+	key string,
+	fingerprint string,
+) (*domain.IdempotentResponse, error) {
+	req, reserved, err := s.repo.ReserveIdempotencyKey(
+		ctx, userID, key, fingerprint, idempotencyKeyLock, time.Now().Add(-idempotencyKeyTTL),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reserving idempotency key: %w", err)
+	}
+	if reserved {
+		return nil, nil //nolint: nilnil //nothing to replay
+	}
+	if req.Fingerprint != fingerprint {
+		return nil, domain.ErrIdempotencyKeyReused
+	}
+	if req.Response == nil {
+		return nil, domain.ErrIdempotencyKeyInProgress
+	}
+	return req.Response, nil
+}
+
+func (s *OrderService) CompleteIdempotent(
+	ctx context.Context,
+	userID uuid.UUID,
+	key string,
+	resp domain.IdempotentResponse,
+) error {
+	if err := s.repo.CompleteIdempotencyKey(ctx, userID, key, resp); err != nil {
+		return fmt.Errorf("completing idempotent request: %w", err)
+	}
+	return nil
+}
+
+// AbortIdempotent releases the key of a request that failed so that it can be retried.
+func (s *OrderService) AbortIdempotent(ctx context.Context, userID uuid.UUID, key string) error {
+	if err := s.repo.ReleaseIdempotencyKey(ctx, userID, key); err != nil {
+		return fmt.Errorf("aborting idempotent request: %w", err)
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys deletes the keys past idempotencyKeyTTL and returns how many it deleted.
+func (s *OrderService) PurgeIdempotencyKeys(ctx context.Context) (int64, error) {
+	n, err := s.repo.PurgeIdempotencyKeys(ctx, time.Now().Add(-idempotencyKeyTTL))
+	if err != nil {
+		return n, fmt.Errorf("purging idempotency keys: %w", err)
+	}
+	return n, nil
+}
+
+type IdempotencyKeyPurger interface {
+	PurgeIdempotencyKeys(ctx context.Context) (int64, error)
+}
+
+// IdempotencySweeper periodically deletes expired idempotency keys so that the table doesn't grow forever.
+type IdempotencySweeper struct {
+	purger IdempotencyKeyPurger
+	freq   time.Duration
+	logger *slog.Logger
+}
+
+func NewIdempotencySweeper(purger IdempotencyKeyPurger, freq time.Duration) *IdempotencySweeper {
+	return &IdempotencySweeper{
+		purger: purger,
+		freq:   freq,
+		logger: slog.Default(),
+	}
+}
+
+func (s *IdempotencySweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.freq)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return xerrors.WithStack(ctx.Err())
+		case <-ticker.C:
+			n, err := s.purger.PurgeIdempotencyKeys(ctx)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "purging idempotency keys", slog.Any("error", err))
+				continue
+			}
+			if n > 0 {
+				s.logger.InfoContext(ctx, "purged idempotency keys", slog.Int64("keys", n))
+			}
+		}
+	}
+}
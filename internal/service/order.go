@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	xerrors "github.com/pkg/errors"
@@ -11,23 +13,89 @@ import (
 )
 
 type OrderRepo interface {
-	RegisterOrder(ctx context.Context, userID uuid.UUID, order domain.OrderNumber) (uuid.UUID, error)
-	GetOrders(ctx context.Context, userID uuid.UUID) ([]domain.Order, error)
+	RegisterOrder(ctx context.Context, userID uuid.UUID, order domain.OrderNumber, allowCollision bool) (uuid.UUID, error)
+	RegisterOrders(
+		ctx context.Context,
+		userID uuid.UUID,
+		orders []domain.OrderNumber,
+		allowCollision bool,
+	) (map[domain.OrderNumber]domain.OrderUploadResult, error)
+	GetOrders(ctx context.Context, userID uuid.UUID, filter domain.ListFilter) ([]domain.Order, error)
+	GetOrder(ctx context.Context, userID uuid.UUID, number domain.OrderNumber) (domain.Order, error)
 	GetBalance(ctx context.Context, userID uuid.UUID) (domain.Balance, error)
-	Withdraw(ctx context.Context, userID uuid.UUID, order domain.OrderNumber, sum decimal.Decimal) error
-	GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]domain.Withdrawal, error)
+	Withdraw(
+		ctx context.Context,
+		userID uuid.UUID,
+		order domain.OrderNumber,
+		sum decimal.Decimal,
+		allowCollision bool,
+	) error
+	GetWithdrawals(ctx context.Context, userID uuid.UUID, filter domain.ListFilter) ([]domain.Withdrawal, error)
+	CreateAdjustment(ctx context.Context, adj domain.Adjustment) (domain.Adjustment, error)
+	GetAdjustments(ctx context.Context, userID uuid.UUID) ([]domain.Adjustment, error)
+	ReconcileBalances(ctx context.Context) ([]domain.BalanceMismatch, error)
+	GetStatement(ctx context.Context, userID uuid.UUID, filter domain.StatementFilter) ([]domain.StatementEntry, error)
+	ReserveIdempotencyKey(
+		ctx context.Context,
+		userID uuid.UUID,
+		key string,
+		fingerprint string,
+		lock time.Duration,
+		expiredBefore time.Time,
+	) (domain.IdempotentRequest, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, userID uuid.UUID, key string, resp domain.IdempotentResponse) error
+	ReleaseIdempotencyKey(ctx context.Context, userID uuid.UUID, key string) error
+	PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int64, error)
+	CreateHold(ctx context.Context, hold domain.WithdrawalHold, allowCollision bool) (domain.WithdrawalHold, error)
+	GetHold(ctx context.Context, userID uuid.UUID, holdID uuid.UUID) (domain.WithdrawalHold, error)
+	CaptureHold(ctx context.Context, userID uuid.UUID, holdID uuid.UUID) (domain.WithdrawalHold, error)
+	ReleaseHold(ctx context.Context, userID uuid.UUID, holdID uuid.UUID) (domain.WithdrawalHold, error)
+	ReverseWithdrawal(ctx context.Context, rev domain.WithdrawalReversal) (domain.WithdrawalReversal, bool, error)
+	GetPointLots(ctx context.Context, userID uuid.UUID, accruedBefore time.Time) ([]domain.PointLot, error)
+	ExpirePoints(ctx context.Context, accruedBefore time.Time) (int64, error)
+	GetStuckOrders(ctx context.Context, limit int32, offset int32) ([]domain.Order, error)
+	RequeueOrder(ctx context.Context, number domain.OrderNumber) (domain.Order, error)
+}
+
+type OrderConfig struct {
+	// AllowWithdrawalOrderCollision lets a withdrawal use the number of an uploaded order and an upload the
+	// number of a withdrawal.
+	AllowWithdrawalOrderCollision bool
+	// HoldTTL is how long a hold lasts unless the client asks for another expiry, at most MaxHoldTTL.
+	HoldTTL    time.Duration
+	MaxHoldTTL time.Duration
+	// PointsTTLMonths is how many months after they're credited points expire. Zero disables expiry.
+	PointsTTLMonths int
+	// ExpiringSoonWindow is how far ahead the balance reports points about to expire.
+	ExpiringSoonWindow time.Duration
+	// Now is the clock points expire by.
+	Now func() time.Time
+}
+
+func DefaultOrderConfig() OrderConfig {
+	return OrderConfig{
+		AllowWithdrawalOrderCollision: false,
+		HoldTTL:                       15 * time.Minute, //nolint: mnd //fine
+		MaxHoldTTL:                    24 * time.Hour,   //nolint: mnd //fine
+		PointsTTLMonths:               0,
+		ExpiringSoonWindow:            30 * 24 * time.Hour, //nolint: mnd //fine
+		Now:                           time.Now,
+	}
 }
 
 type OrderService struct {
 	repo OrderRepo
+	cfg  OrderConfig
 }
 
-func NewOrderService(repo OrderRepo) *OrderService {
+func NewOrderService(repo OrderRepo, cfg OrderConfig) *OrderService {
 	return &OrderService{
 		repo: repo,
+		cfg:  cfg,
 	}
 }
 
+// RegisterOrder uploads an order. Unless configured otherwise its number can't be one used for a withdrawal.
 func (s *OrderService) RegisterOrder(
 	ctx context.Context,
 	userID uuid.UUID,
@@ -37,29 +105,102 @@ func (s *OrderService) RegisterOrder(
 	if err != nil {
 		return uuid.UUID{}, fmt.Errorf("invalid order number: %w", err)
 	}
-	id, err := s.repo.RegisterOrder(ctx, userID, order)
+	id, err := s.repo.RegisterOrder(ctx, userID, order, s.cfg.AllowWithdrawalOrderCollision)
 	if err != nil {
 		return uuid.UUID{}, fmt.Errorf("register order: %w", err)
 	}
 	return id, nil
 }
 
-func (s *OrderService) GetOrders(ctx context.Context, userID uuid.UUID) ([]domain.Order, error) {
-	orders, err := s.repo.GetOrders(ctx, userID)
+// RegisterOrders uploads a batch of order numbers. Results follow the order of the input. A number repeated
+// within the batch gets the result of its first occurrence, with accepted turning into duplicate_own.
+func (s *OrderService) RegisterOrders(
+	ctx context.Context,
+	userID uuid.UUID,
+	ordersRaw []string,
+) ([]domain.OrderUpload, error) {
+	uploads := make([]domain.OrderUpload, 0, len(ordersRaw))
+	valid := make([]domain.OrderNumber, 0, len(ordersRaw))
+	seen := make(map[domain.OrderNumber]struct{}, len(ordersRaw))
+	for _, i := range ordersRaw {
+		order, err := domain.NewOrderNumber(i)
+		if err != nil {
+			uploads = append(uploads, domain.OrderUpload{Number: i, Result: domain.OrderUploadResultMalformed})
+			continue
+		}
+		uploads = append(uploads, domain.OrderUpload{Number: i, Result: domain.OrderUploadResultAccepted})
+		if _, ok := seen[order]; !ok {
+			seen[order] = struct{}{}
+			valid = append(valid, order)
+		}
+	}
+	if len(valid) == 0 {
+		return uploads, nil
+	}
+	results, err := s.repo.RegisterOrders(ctx, userID, valid, s.cfg.AllowWithdrawalOrderCollision)
+	if err != nil {
+		return nil, fmt.Errorf("register orders: %w", err)
+	}
+	reported := make(map[domain.OrderNumber]struct{}, len(valid))
+	for i, upload := range uploads {
+		if upload.Result == domain.OrderUploadResultMalformed {
+			continue
+		}
+		order := domain.OrderNumber(upload.Number)
+		result := results[order]
+		if _, ok := reported[order]; ok && result == domain.OrderUploadResultAccepted {
+			result = domain.OrderUploadResultDuplicateOwn
+		}
+		reported[order] = struct{}{}
+		uploads[i].Result = result
+	}
+	return uploads, nil
+}
+
+func (s *OrderService) GetOrders(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter domain.ListFilter,
+) ([]domain.Order, error) {
+	orders, err := s.repo.GetOrders(ctx, userID, filter)
 	if err != nil {
 		return nil, fmt.Errorf("getting orders: %w", err)
 	}
 	return orders, nil
 }
 
+func (s *OrderService) GetOrder(
+	ctx context.Context,
+	userID uuid.UUID,
+	number domain.OrderNumber,
+) (domain.Order, error) {
+	order, err := s.repo.GetOrder(ctx, userID, number)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("getting order: %w", err)
+	}
+	return order, nil
+}
+
+// GetBalance returns the user's balance. When points expire, it includes the ones expiring within
+// ExpiringSoonWindow.
 func (s *OrderService) GetBalance(ctx context.Context, userID uuid.UUID) (domain.Balance, error) {
 	balance, err := s.repo.GetBalance(ctx, userID)
 	if err != nil {
 		return domain.Balance{}, xerrors.WithStack(err)
 	}
+	if s.cfg.PointsTTLMonths <= 0 {
+		return balance, nil
+	}
+	lots, err := s.repo.GetPointLots(ctx, userID, s.expiryCutoff().Add(s.cfg.ExpiringSoonWindow))
+	if err != nil {
+		return domain.Balance{}, fmt.Errorf("getting expiring points: %w", err)
+	}
+	balance.ExpiringSoon = domain.NewExpiringPoints(lots, balance.Held, s.cfg.PointsTTLMonths)
 	return balance, nil
 }
 
+// Withdraw spends sum on the order. Unless configured otherwise its number can't be the number of an uploaded
+// order.
 func (s *OrderService) Withdraw(
 	ctx context.Context,
 	userID uuid.UUID,
@@ -70,17 +211,82 @@ func (s *OrderService) Withdraw(
 	if err != nil {
 		return fmt.Errorf("invalid order number: %w", err)
 	}
-	err = s.repo.Withdraw(ctx, userID, order, sum)
+	err = s.repo.Withdraw(ctx, userID, order, sum, s.cfg.AllowWithdrawalOrderCollision)
 	if err != nil {
 		return fmt.Errorf("withdrawal: %w", err)
 	}
 	return nil
 }
 
-func (s *OrderService) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]domain.Withdrawal, error) {
-	withdrawals, err := s.repo.GetWithdrawals(ctx, userID)
+func (s *OrderService) GetWithdrawals(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter domain.ListFilter,
+) ([]domain.Withdrawal, error) {
+	withdrawals, err := s.repo.GetWithdrawals(ctx, userID, filter)
 	if err != nil {
 		return nil, fmt.Errorf("getting withdrawals: %w", err)
 	}
 	return withdrawals, nil
 }
+
+// AdjustBalance credits or debits the user's balance by hand. A reason is mandatory and amounts
+// are limited to whole cents.
+func (s *OrderService) AdjustBalance(ctx context.Context, adj domain.Adjustment) (domain.Adjustment, error) {
+	const centsPlaces = 2
+	if adj.Amount.IsZero() || !adj.Amount.Equal(adj.Amount.Round(centsPlaces)) || strings.TrimSpace(adj.Reason) == "" {
+		return domain.Adjustment{}, domain.ErrInvalidAdjustment
+	}
+	adj, err := s.repo.CreateAdjustment(ctx, adj)
+	if err != nil {
+		return domain.Adjustment{}, fmt.Errorf("adjusting balance: %w", err)
+	}
+	return adj, nil
+}
+
+// ReverseWithdrawal refunds a withdrawal in full or, given an Amount, in part. The reversal is applied once
+// per Reference, a repeated one returns the earlier reversal and false.
+func (s *OrderService) ReverseWithdrawal(
+	ctx context.Context,
+	rev domain.WithdrawalReversal,
+) (domain.WithdrawalReversal, bool, error) {
+	const centsPlaces = 2
+	if rev.Amount.IsNegative() || !rev.Amount.Equal(rev.Amount.Round(centsPlaces)) || strings.TrimSpace(rev.Reason) == "" {
+		return domain.WithdrawalReversal{}, false, domain.ErrInvalidReversal
+	}
+	rev, created, err := s.repo.ReverseWithdrawal(ctx, rev)
+	if err != nil {
+		return domain.WithdrawalReversal{}, false, fmt.Errorf("reversing withdrawal: %w", err)
+	}
+	return rev, created, nil
+}
+
+func (s *OrderService) GetAdjustments(ctx context.Context, userID uuid.UUID) ([]domain.Adjustment, error) {
+	adjustments, err := s.repo.GetAdjustments(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("getting adjustments: %w", err)
+	}
+	return adjustments, nil
+}
+
+func (s *OrderService) GetStatement(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter domain.StatementFilter,
+) ([]domain.StatementEntry, error) {
+	entries, err := s.repo.GetStatement(ctx, userID, filter)
+	if err != nil {
+		return nil, fmt.Errorf("getting statement: %w", err)
+	}
+	return entries, nil
+}
+
+// ReconcileBalances checks every balance snapshot against the sum of the user's ledger entries and returns
+// the ones that differ.
+func (s *OrderService) ReconcileBalances(ctx context.Context) ([]domain.BalanceMismatch, error) {
+	mismatches, err := s.repo.ReconcileBalances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reconciling balances: %w", err)
+	}
+	return mismatches, nil
+}
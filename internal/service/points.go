@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	xerrors "github.com/pkg/errors"
+)
+
+// ExpirePoints expires the points credited more than PointsTTLMonths ago that haven't been spent and returns
+// how many users lost points. It does nothing when points don't expire.
+func (s *OrderService) ExpirePoints(ctx context.Context) (int64, error) {
+	if s.cfg.PointsTTLMonths <= 0 {
+		return 0, nil
+	}
+	n, err := s.repo.ExpirePoints(ctx, s.expiryCutoff())
+	if err != nil {
+		return n, fmt.Errorf("expiring points: %w", err)
+	}
+	return n, nil
+}
+
+// expiryCutoff is the time before which credited points have expired by now.
+func (s *OrderService) expiryCutoff() time.Time {
+	return s.cfg.Now().AddDate(0, -s.cfg.PointsTTLMonths, 0)
+}
+
+type PointsExpirer interface {
+	ExpirePoints(ctx context.Context) (int64, error)
+}
+
+// PointsSweeper periodically posts expiry entries for points that weren't spent in time.
+type PointsSweeper struct {
+	expirer PointsExpirer
+	freq    time.Duration
+	logger  *slog.Logger
+}
+
+func NewPointsSweeper(expirer PointsExpirer, freq time.Duration) *PointsSweeper {
+	return &PointsSweeper{
+		expirer: expirer,
+		freq:    freq,
+		logger:  slog.Default(),
+	}
+}
+
+func (s *PointsSweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.freq)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return xerrors.WithStack(ctx.Err())
+		case <-ticker.C:
+			n, err := s.expirer.ExpirePoints(ctx)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "expiring points", slog.Any("error", err))
+				continue
+			}
+			if n > 0 {
+				s.logger.InfoContext(ctx, "expired points", slog.Int64("users", n))
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// GetStuckOrders lists the orders the accrual worker gave up on, longest stuck first.
+func (s *OrderService) GetStuckOrders(ctx context.Context, limit int32, offset int32) ([]domain.Order, error) {
+	orders, err := s.repo.GetStuckOrders(ctx, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("getting stuck orders: %w", err)
+	}
+	return orders, nil
+}
+
+// RequeueOrder hands a stuck order back to the accrual worker.
+func (s *OrderService) RequeueOrder(ctx context.Context, number domain.OrderNumber) (domain.Order, error) {
+	order, err := s.repo.RequeueOrder(ctx, number)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("requeueing order: %w", err)
+	}
+	return order, nil
+}
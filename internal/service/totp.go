@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ttl256/gophermart-loyalty/internal/auth"
+	"github.com/ttl256/gophermart-loyalty/internal/domain"
+)
+
+// EnrollTOTP generates a new secret for the user. It takes effect once confirmed with a code.
+func (s *AuthService) EnrollTOTP(ctx context.Context, userID uuid.UUID) (auth.TOTPSecret, string, error) {
+	if s.cfg.TOTPCipher == nil {
+		return nil, "", domain.ErrTOTPUnavailable
+	}
+	user, _, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("getting user: %w", err)
+	}
+	secret := auth.NewTOTPSecret()
+	if err = s.repo.SaveTOTPSecret(ctx, userID, s.cfg.TOTPCipher.Seal(secret, userID[:])); err != nil {
+		return nil, "", fmt.Errorf("saving totp secret: %w", err)
+	}
+	return secret, secret.URI(s.cfg.TOTPIssuer, user.Login), nil
+}
+
+// ConfirmTOTP enables two-factor authentication and returns recovery codes. They can't be retrieved later.
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]auth.RecoveryCode, error) {
+	cred, secret, err := s.totpSecret(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Confirmed {
+		return nil, domain.ErrTOTPAlreadyEnabled
+	}
+	step, ok := secret.Verify(code, time.Now())
+	if !ok {
+		return nil, domain.ErrInvalidOTP
+	}
+	codes := auth.NewRecoveryCodes(s.cfg.RecoveryCodes)
+	hashes := make([]string, 0, len(codes))
+	for _, i := range codes {
+		hashes = append(hashes, i.Hash())
+	}
+	if err = s.repo.ConfirmTOTP(ctx, userID, step, hashes); err != nil {
+		return nil, fmt.Errorf("confirming totp: %w", err)
+	}
+	return codes, nil
+}
+
+// DisableTOTP removes the enrollment and recovery codes after checking a code.
+func (s *AuthService) DisableTOTP(ctx context.Context, userID uuid.UUID, code string, address string) error {
+	if err := s.verifySecondFactor(ctx, userID, code, address); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteTOTP(ctx, userID); err != nil {
+		return fmt.Errorf("deleting totp: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthService) TOTPEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	cred, err := s.repo.GetTOTPCredential(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrTOTPNotEnabled) {
+			return false, nil
+		}
+		return false, fmt.Errorf("getting totp credential: %w", err)
+	}
+	return cred.Confirmed, nil
+}
+
+// ChallengeSecondFactor opens an MFA challenge if the user has two-factor authentication enabled.
+// The returned token is exchanged for a session with VerifyMFAChallenge.
+func (s *AuthService) ChallengeSecondFactor(ctx context.Context, userID uuid.UUID) (auth.MFAToken, bool, error) {
+	enabled, err := s.TOTPEnabled(ctx, userID)
+	if err != nil {
+		return "", false, err
+	}
+	if !enabled {
+		return "", false, nil
+	}
+	token := auth.NewMFAToken()
+	if err = s.repo.CreateMFAChallenge(ctx, token.Hash(), userID, time.Now().Add(s.cfg.MFAChallengeTTL)); err != nil {
+		return "", false, fmt.Errorf("creating mfa challenge: %w", err)
+	}
+	return token, true, nil
+}
+
+// VerifyMFAChallenge completes a login with a TOTP or recovery code. A wrong code leaves the challenge open.
+func (s *AuthService) VerifyMFAChallenge(
+	ctx context.Context,
+	token auth.MFAToken,
+	code string,
+	address string,
+) (uuid.UUID, error) {
+	userID, err := s.repo.GetMFAChallenge(ctx, token.Hash())
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("getting mfa challenge: %w", err)
+	}
+	if err = s.verifySecondFactor(ctx, userID, code, address); err != nil {
+		return uuid.UUID{}, err
+	}
+	if err = s.repo.DeleteMFAChallenge(ctx, token.Hash()); err != nil {
+		return uuid.UUID{}, fmt.Errorf("consuming mfa challenge: %w", err)
+	}
+	return userID, nil
+}
+
+// VerifyStepUp requires a fresh code from users with two-factor authentication enabled.
+// Users without it pass unchallenged.
+func (s *AuthService) VerifyStepUp(ctx context.Context, userID uuid.UUID, code string, address string) error {
+	enabled, err := s.TOTPEnabled(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+	if code == "" {
+		return domain.ErrTOTPRequired
+	}
+	return s.verifySecondFactor(ctx, userID, code, address)
+}
+
+// verifySecondFactor checks a code under the same throttling as passwords, failures count towards the lockout.
+func (s *AuthService) verifySecondFactor(ctx context.Context, userID uuid.UUID, code string, address string) error {
+	user, _, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+	now := time.Now()
+	attempt, err := s.reserveAttempt(ctx, user.Login, address, now)
+	if err != nil {
+		return err
+	}
+	ok, err := s.checkSecondFactor(ctx, userID, code, now)
+	if err != nil {
+		return errors.Join(err, s.refundAttempt(ctx, attempt))
+	}
+	if !ok {
+		return domain.ErrInvalidOTP
+	}
+	return s.refundAttempt(ctx, attempt)
+}
+
+// checkSecondFactor accepts a TOTP code not used before or an unused recovery code.
+func (s *AuthService) checkSecondFactor(
+	ctx context.Context,
+	userID uuid.UUID,
+	code string,
+	now time.Time,
+) (bool, error) {
+	cred, secret, err := s.totpSecret(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if !cred.Confirmed {
+		return false, domain.ErrTOTPNotEnabled
+	}
+	if step, ok := secret.Verify(code, now); ok {
+		used, errUse := s.repo.UseTOTPStep(ctx, userID, step)
+		if errUse != nil {
+			return false, fmt.Errorf("using totp code: %w", errUse)
+		}
+		return used, nil
+	}
+	used, err := s.repo.UseRecoveryCode(ctx, userID, auth.RecoveryCode(code).Hash())
+	if err != nil {
+		return false, fmt.Errorf("using recovery code: %w", err)
+	}
+	if used {
+		s.logger.InfoContext(ctx, "recovery code used", slog.String("user_id", userID.String()))
+	}
+	return used, nil
+}
+
+func (s *AuthService) totpSecret(
+	ctx context.Context,
+	userID uuid.UUID,
+) (domain.TOTPCredential, auth.TOTPSecret, error) {
+	if s.cfg.TOTPCipher == nil {
+		return domain.TOTPCredential{}, nil, domain.ErrTOTPUnavailable
+	}
+	cred, err := s.repo.GetTOTPCredential(ctx, userID)
+	if err != nil {
+		return domain.TOTPCredential{}, nil, fmt.Errorf("getting totp credential: %w", err)
+	}
+	secret, err := s.cfg.TOTPCipher.Open(cred.Secret, userID[:])
+	if err != nil {
+		return domain.TOTPCredential{}, nil, fmt.Errorf("decrypting totp secret: %w", err)
+	}
+	return cred, secret, nil
+}
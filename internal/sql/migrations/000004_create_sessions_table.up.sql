@@ -0,0 +1,14 @@
+create table if not exists sessions (
+    id uuid primary key,
+    user_id uuid not null references users(id),
+    created_at timestamptz not null default now(),
+    revoked_at timestamptz
+);
+
+create table if not exists refresh_tokens (
+    token_hash text primary key,
+    session_id uuid not null references sessions(id) on delete cascade,
+    expires_at timestamptz not null,
+    used_at timestamptz,
+    created_at timestamptz not null default now()
+);
@@ -0,0 +1,8 @@
+create table if not exists login_attempts (
+    scope text not null,
+    key text not null,
+    failures integer not null default 0,
+    last_failure_at timestamptz not null default now(),
+    locked_until timestamptz,
+    primary key (scope, key)
+);
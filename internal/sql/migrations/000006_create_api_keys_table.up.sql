@@ -0,0 +1,11 @@
+create table if not exists api_keys (
+    id uuid primary key,
+    user_id uuid not null references users(id),
+    name text not null,
+    prefix text not null,
+    key_hash text unique not null,
+    scopes text[] not null,
+    created_at timestamptz not null default now(),
+    last_used_at timestamptz,
+    revoked_at timestamptz
+);
@@ -0,0 +1,3 @@
+drop table if exists mfa_challenges;
+drop table if exists totp_recovery_codes;
+drop table if exists totp_credentials;
@@ -0,0 +1,21 @@
+create table if not exists totp_credentials (
+    user_id uuid primary key references users(id),
+    secret bytea not null,
+    last_used_step bigint not null default 0,
+    confirmed_at timestamptz,
+    created_at timestamptz not null default now()
+);
+
+create table if not exists totp_recovery_codes (
+    user_id uuid not null references users(id),
+    code_hash text not null,
+    used_at timestamptz,
+    primary key (user_id, code_hash)
+);
+
+create table if not exists mfa_challenges (
+    token_hash text primary key,
+    user_id uuid not null references users(id),
+    expires_at timestamptz not null,
+    created_at timestamptz not null default now()
+);
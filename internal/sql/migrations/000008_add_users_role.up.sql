@@ -0,0 +1,3 @@
+alter table users
+    add column if not exists role text not null default 'user',
+    add column if not exists blocked_at timestamptz;
@@ -0,0 +1,10 @@
+create table if not exists adjustments (
+    id uuid primary key,
+    user_id uuid not null references users(id),
+    amount numeric(12, 2) not null check (amount <> 0),
+    reason text not null check (reason <> ''),
+    operator_id uuid references users(id),
+    created_at timestamptz not null default now()
+);
+
+create index if not exists adjustments_user_id_idx on adjustments (user_id, created_at);
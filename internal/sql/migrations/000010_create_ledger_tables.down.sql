@@ -0,0 +1,3 @@
+drop table if exists balances;
+drop table if exists ledger_entries;
+drop function if exists ledger_entries_append_only();
@@ -0,0 +1,54 @@
+create table if not exists ledger_entries (
+    id bigserial primary key,
+    user_id uuid not null references users(id),
+    kind text not null,
+    amount numeric(12, 2) not null check (amount <> 0),
+    order_number text,
+    adjustment_id uuid references adjustments(id),
+    created_at timestamptz not null default now()
+);
+
+create index if not exists ledger_entries_user_id_idx on ledger_entries (user_id, id);
+create unique index if not exists ledger_entries_accrual_uniq on ledger_entries (order_number)
+    where kind = 'accrual';
+
+create or replace function ledger_entries_append_only() returns trigger as $$
+begin
+    raise exception 'ledger_entries is append-only';
+end;
+$$ language plpgsql;
+
+create trigger ledger_entries_append_only
+before update or delete on ledger_entries
+for each row execute function ledger_entries_append_only();
+
+create table if not exists balances (
+    user_id uuid primary key references users(id),
+    current numeric(12, 2) not null default 0,
+    withdrawn numeric(12, 2) not null default 0,
+    updated_at timestamptz not null default now()
+);
+
+insert into ledger_entries (user_id, kind, amount, order_number, adjustment_id, created_at)
+select user_id, kind, amount, order_number, adjustment_id, created_at
+from (
+    select o.user_id, 'accrual' as kind, o.accrual as amount, o.number as order_number,
+        null::uuid as adjustment_id, o.uploaded_at as created_at
+    from orders o
+    where o.status = 'PROCESSED'
+        and o.accrual > 0
+    union all
+    select w.user_id, 'withdrawal', -w.sum, w.order_number, null, w.processed_at
+    from withdrawals w
+    union all
+    select a.user_id, 'adjustment', a.amount, null, a.id, a.created_at
+    from adjustments a
+) history
+order by created_at;
+
+insert into balances (user_id, current, withdrawn)
+select user_id,
+    sum(amount),
+    -coalesce(sum(amount) filter (where kind = 'withdrawal'), 0)
+from ledger_entries
+group by user_id;
@@ -0,0 +1,2 @@
+alter table orders
+    add column if not exists checked_at timestamptz;
@@ -0,0 +1,10 @@
+create table if not exists idempotency_keys (
+    user_id uuid not null references users(id),
+    key text not null,
+    fingerprint text not null,
+    status_code integer,
+    content_type text,
+    body bytea,
+    created_at timestamptz not null default now(),
+    primary key (user_id, key)
+);
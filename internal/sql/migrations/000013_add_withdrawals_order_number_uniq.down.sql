@@ -0,0 +1,4 @@
+drop index if exists withdrawals_order_number_uniq;
+
+alter table withdrawals
+    drop column if exists duplicate_of;
@@ -0,0 +1,17 @@
+alter table withdrawals
+    add column if not exists duplicate_of uuid references withdrawals(id);
+
+-- Order numbers of earlier withdrawals may repeat. The first withdrawal keeps the number, the later ones
+-- stay for the record and point to it.
+update withdrawals w
+set duplicate_of = f.id
+from (
+    select distinct on (order_number) id, order_number
+    from withdrawals
+    order by order_number, processed_at, id
+) f
+where w.order_number = f.order_number
+    and w.id <> f.id;
+
+create unique index if not exists withdrawals_order_number_uniq on withdrawals (order_number)
+    where duplicate_of is null;
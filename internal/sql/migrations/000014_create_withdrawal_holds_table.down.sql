@@ -0,0 +1 @@
+drop table if exists withdrawal_holds;
@@ -0,0 +1,15 @@
+create table if not exists withdrawal_holds (
+    id uuid primary key,
+    user_id uuid not null references users(id),
+    order_number text not null,
+    sum numeric(12, 2) not null check (sum > 0),
+    status text not null default 'held',
+    expires_at timestamptz not null,
+    created_at timestamptz not null default now(),
+    settled_at timestamptz,
+    withdrawal_id uuid references withdrawals(id)
+);
+
+create index if not exists withdrawal_holds_user_id_idx on withdrawal_holds (user_id) where status = 'held';
+create index if not exists withdrawal_holds_expires_at_idx on withdrawal_holds (expires_at) where status = 'held';
+create unique index if not exists withdrawal_holds_order_number_uniq on withdrawal_holds (order_number) where status = 'held';
@@ -0,0 +1,9 @@
+alter table ledger_entries
+    drop column if exists reversal_id;
+
+alter table withdrawals
+    drop constraint if exists withdrawals_reversed_check;
+alter table withdrawals
+    drop column if exists reversed;
+
+drop table if exists withdrawal_reversals;
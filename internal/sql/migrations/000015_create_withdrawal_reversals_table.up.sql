@@ -0,0 +1,18 @@
+create table if not exists withdrawal_reversals (
+    id uuid primary key,
+    withdrawal_id uuid not null references withdrawals(id),
+    amount numeric(12, 2) not null check (amount > 0),
+    reason text not null,
+    reference text,
+    operator_id uuid references users(id),
+    created_at timestamptz not null default now(),
+    unique (withdrawal_id, reference)
+);
+
+alter table withdrawals
+    add column if not exists reversed numeric(12, 2) not null default 0;
+alter table withdrawals
+    add constraint withdrawals_reversed_check check (reversed >= 0 and reversed <= sum);
+
+alter table ledger_entries
+    add column if not exists reversal_id uuid references withdrawal_reversals(id);
@@ -0,0 +1,4 @@
+drop index if exists orders_processed_at_idx;
+
+alter table orders
+    drop column if exists processed_at;
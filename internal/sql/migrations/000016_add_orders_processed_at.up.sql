@@ -0,0 +1,10 @@
+alter table orders
+    add column if not exists processed_at timestamptz;
+
+update orders
+set processed_at = coalesce(checked_at, uploaded_at)
+where status = 'PROCESSED'
+    and processed_at is null;
+
+create index if not exists orders_processed_at_idx on orders (processed_at)
+    where status = 'PROCESSED';
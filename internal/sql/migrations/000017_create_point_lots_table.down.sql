@@ -0,0 +1,3 @@
+drop table if exists point_lot_consumptions;
+
+drop table if exists point_lots;
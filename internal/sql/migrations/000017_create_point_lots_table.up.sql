@@ -0,0 +1,26 @@
+create table if not exists point_lots (
+    id bigserial primary key,
+    user_id uuid not null references users(id),
+    ledger_entry_id bigint references ledger_entries(id),
+    amount numeric(12, 2) not null check (amount > 0),
+    remaining numeric(12, 2) not null check (remaining >= 0 and remaining <= amount),
+    created_at timestamptz not null default now()
+);
+
+create index if not exists point_lots_user_id_idx on point_lots (user_id, created_at, id)
+    where remaining > 0;
+create index if not exists point_lots_created_at_idx on point_lots (created_at)
+    where remaining > 0;
+
+create table if not exists point_lot_consumptions (
+    lot_id bigint not null references point_lots(id),
+    ledger_entry_id bigint not null references ledger_entries(id),
+    amount numeric(12, 2) not null check (amount > 0),
+    primary key (lot_id, ledger_entry_id)
+);
+
+-- Points on the balance so far start to age from now on.
+insert into point_lots (user_id, amount, remaining)
+select user_id, current, current
+from balances
+where current > 0;
@@ -0,0 +1,5 @@
+drop index if exists orders_pending_idx;
+
+alter table orders
+    drop column if exists lease_until,
+    drop column if exists claimed_by;
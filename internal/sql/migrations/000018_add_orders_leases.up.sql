@@ -0,0 +1,6 @@
+alter table orders
+    add column if not exists claimed_by text,
+    add column if not exists lease_until timestamptz;
+
+create index if not exists orders_pending_idx on orders (uploaded_at)
+    where status in ('NEW', 'PROCESSING');
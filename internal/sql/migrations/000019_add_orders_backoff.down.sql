@@ -0,0 +1,7 @@
+drop index if exists orders_next_attempt_at_idx;
+create index if not exists orders_pending_idx on orders (uploaded_at)
+    where status in ('NEW', 'PROCESSING');
+
+alter table orders
+    drop column if exists next_attempt_at,
+    drop column if exists attempts;
@@ -0,0 +1,8 @@
+-- checked_at already is the time of the last check, attempts and next_attempt_at schedule the next one.
+alter table orders
+    add column if not exists attempts integer not null default 0,
+    add column if not exists next_attempt_at timestamptz not null default now();
+
+drop index if exists orders_pending_idx;
+create index if not exists orders_next_attempt_at_idx on orders (next_attempt_at)
+    where status in ('NEW', 'PROCESSING');
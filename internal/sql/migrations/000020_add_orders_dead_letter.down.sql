@@ -0,0 +1,7 @@
+update orders set status = 'PROCESSING' where status = 'STUCK';
+
+drop index if exists orders_stuck_at_idx;
+
+alter table orders
+    drop column if exists stuck_at,
+    drop column if exists queued_at;
@@ -0,0 +1,9 @@
+-- queued_at is when the order started waiting on the accrual system, a requeue starts the wait over.
+alter table orders
+    add column if not exists queued_at timestamptz not null default now(),
+    add column if not exists stuck_at timestamptz;
+
+update orders set queued_at = uploaded_at;
+
+create index if not exists orders_stuck_at_idx on orders (stuck_at)
+    where status = 'STUCK';
@@ -0,0 +1,7 @@
+-- locked_until is how long the request that reserved a key has to complete it before a retry may take over.
+alter table idempotency_keys
+    add column if not exists locked_until timestamptz;
+
+update idempotency_keys set locked_until = now() where status_code is null;
+
+create index if not exists idempotency_keys_created_at_idx on idempotency_keys (created_at);
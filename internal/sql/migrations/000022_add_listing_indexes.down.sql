@@ -0,0 +1,2 @@
+drop index if exists withdrawals_user_id_processed_at_idx;
+drop index if exists orders_user_id_uploaded_at_idx;
@@ -0,0 +1,3 @@
+-- Order and withdrawal lists are paged by (time, key) per user.
+create index if not exists orders_user_id_uploaded_at_idx on orders (user_id, uploaded_at, number);
+create index if not exists withdrawals_user_id_processed_at_idx on withdrawals (user_id, processed_at, id);
@@ -0,0 +1,2 @@
+alter table ledger_entries
+    drop column if exists balance_after;
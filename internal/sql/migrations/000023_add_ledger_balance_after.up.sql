@@ -0,0 +1,16 @@
+-- balance_after is the user's balance right after the entry, so statements don't have to sum the whole ledger.
+alter table ledger_entries
+    add column if not exists balance_after numeric(12, 2);
+
+alter table ledger_entries disable trigger ledger_entries_append_only;
+update ledger_entries e
+set balance_after = s.balance
+from (
+    select id, sum(amount) over (partition by user_id order by id) as balance
+    from ledger_entries
+) s
+where s.id = e.id;
+alter table ledger_entries enable trigger ledger_entries_append_only;
+
+alter table ledger_entries
+    alter column balance_after set not null;
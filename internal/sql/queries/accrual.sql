@@ -1,11 +1,134 @@
--- name: GetOrdersForProcessing :many
-select number, user_id, status, accrual, uploaded_at
+-- name: ClaimOrdersForProcessing :many
+with claimable as (
+    select number
+    from orders
+    where status in ('NEW','PROCESSING')
+        and next_attempt_at <= now()
+        and (lease_until is null or lease_until < now())
+    order by next_attempt_at asc
+    limit sqlc.arg(row_limit)
+    for update skip locked
+)
+update orders o
+set claimed_by = sqlc.arg(claimed_by)::text,
+    lease_until = now() + make_interval(secs => sqlc.arg(lease_seconds)::float8)
+from claimable c
+where o.number = c.number
+returning o.number, o.user_id, o.status, o.accrual, o.uploaded_at, o.checked_at, o.processed_at, o.claimed_by,
+    o.lease_until, o.attempts, o.next_attempt_at, o.queued_at, o.stuck_at;
+
+-- name: RenewOrderLeases :execrows
+update orders
+set lease_until = now() + make_interval(secs => sqlc.arg(lease_seconds)::float8)
+where number = any(sqlc.arg(numbers)::text[])
+    and claimed_by = sqlc.arg(claimed_by)::text
+    and status in ('NEW','PROCESSING');
+
+-- name: ClaimOrdersForRecheck :many
+-- The check is recorded as the orders are claimed, so other replicas skip them until they're due again.
+with claimable as (
+    select number
+    from orders
+    where status = 'PROCESSED'
+        and processed_at >= sqlc.arg(processed_after)
+        and (checked_at is null or checked_at < sqlc.arg(checked_before))
+    order by checked_at asc nulls first
+    limit sqlc.arg(row_limit)
+    for update skip locked
+)
+update orders o
+set checked_at = now()
+from claimable c
+where o.number = c.number
+returning o.number, o.user_id, o.status, o.accrual, o.uploaded_at, o.checked_at, o.processed_at, o.claimed_by,
+    o.lease_until, o.attempts, o.next_attempt_at, o.queued_at, o.stuck_at;
+
+-- name: UpdateOrderStatus :one
+-- The retry schedule starts over when the status changes.
+update orders
+set status = sqlc.arg(status),
+    accrual = sqlc.arg(accrual),
+    checked_at = now(),
+    processed_at = case when sqlc.arg(status) = 'PROCESSED' then now() end,
+    attempts = case when status = sqlc.arg(status) then attempts + 1 else 1 end,
+    next_attempt_at = now() + make_interval(secs => least(
+        sqlc.arg(retry_base_seconds)::float8 * power(2, least(case when status = sqlc.arg(status) then attempts else 0 end, 30)),
+        sqlc.arg(retry_max_seconds)::float8
+    )),
+    claimed_by = null,
+    lease_until = null
+where number = sqlc.arg(number)
+    and status in ('NEW','PROCESSING')
+returning user_id;
+
+-- name: GetProcessedOrderForUpdate :one
+select user_id, accrual
 from orders
-where status in ('NEW','PROCESSING')
-order by uploaded_at asc;
+where number = $1
+    and status = 'PROCESSED'
+for update;
 
--- name: UpdateOrderStatus :exec
+-- name: ReviseOrder :exec
 update orders
 set status = $2,
-    accrual = $3
+    accrual = $3,
+    checked_at = now()
 where number = $1;
+
+-- name: MarkOrderChecked :exec
+update orders
+set checked_at = now(),
+    attempts = attempts + 1,
+    next_attempt_at = now() + make_interval(secs => least(
+        sqlc.arg(retry_base_seconds)::float8 * power(2, least(attempts, 30)),
+        sqlc.arg(retry_max_seconds)::float8
+    )),
+    claimed_by = null,
+    lease_until = null
+where number = sqlc.arg(number)
+    and claimed_by = sqlc.arg(claimed_by)::text
+    and status in ('NEW','PROCESSING');
+
+-- name: PostponeOrder :exec
+update orders
+set attempts = attempts + 1,
+    next_attempt_at = now() + make_interval(secs => least(
+        sqlc.arg(retry_base_seconds)::float8 * power(2, least(attempts, 30)),
+        sqlc.arg(retry_max_seconds)::float8
+    )),
+    claimed_by = null,
+    lease_until = null
+where number = sqlc.arg(number)
+    and claimed_by = sqlc.arg(claimed_by)::text
+    and status in ('NEW','PROCESSING');
+
+-- name: MarkOrdersStuck :execrows
+update orders
+set status = 'STUCK',
+    stuck_at = now()
+where status in ('NEW','PROCESSING')
+    and (lease_until is null or lease_until < now())
+    and (
+        (sqlc.arg(max_attempts)::integer > 0 and attempts >= sqlc.arg(max_attempts)::integer)
+        or queued_at < sqlc.narg(queued_before)
+    );
+
+-- name: GetStuckOrders :many
+select number, user_id, status, accrual, uploaded_at, checked_at, processed_at, claimed_by, lease_until, attempts,
+    next_attempt_at, queued_at, stuck_at
+from orders
+where status = 'STUCK'
+order by stuck_at, number
+limit $1 offset $2;
+
+-- name: RequeueOrder :one
+update orders
+set status = 'PROCESSING',
+    attempts = 0,
+    next_attempt_at = now(),
+    queued_at = now(),
+    stuck_at = null
+where number = $1
+    and status = 'STUCK'
+returning number, user_id, status, accrual, uploaded_at, checked_at, processed_at, claimed_by, lease_until, attempts,
+    next_attempt_at, queued_at, stuck_at;
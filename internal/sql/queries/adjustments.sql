@@ -0,0 +1,10 @@
+-- name: InsertAdjustment :one
+insert into adjustments (id, user_id, amount, reason, operator_id)
+values ($1, $2, $3, $4, $5)
+returning created_at;
+
+-- name: GetAdjustments :many
+select id, amount, reason, operator_id, created_at
+from adjustments
+where user_id = $1
+order by created_at desc;
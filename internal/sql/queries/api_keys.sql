@@ -0,0 +1,28 @@
+-- name: InsertAPIKey :one
+insert into api_keys (id, user_id, name, prefix, key_hash, scopes)
+values ($1, $2, $3, $4, $5, $6)
+returning created_at;
+
+-- name: SelectAPIKeysByUser :many
+select id, name, prefix, scopes, created_at, last_used_at
+from api_keys
+where user_id = $1
+    and revoked_at is null
+order by created_at;
+
+-- name: TouchAPIKey :one
+update api_keys k
+set last_used_at = now()
+from users u
+where k.key_hash = $1
+    and k.revoked_at is null
+    and u.id = k.user_id
+    and u.blocked_at is null
+returning k.id, k.user_id, k.name, k.prefix, k.scopes, k.created_at, k.last_used_at;
+
+-- name: RevokeAPIKey :execrows
+update api_keys
+set revoked_at = now()
+where id = $1
+    and user_id = $2
+    and revoked_at is null;
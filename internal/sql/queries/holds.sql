@@ -0,0 +1,58 @@
+-- name: InsertHold :one
+insert into withdrawal_holds (id, user_id, order_number, sum, expires_at)
+values ($1, $2, $3, $4, $5)
+returning id, user_id, order_number, sum, status, expires_at, created_at, settled_at, withdrawal_id;
+
+-- name: GetHold :one
+select id, user_id, order_number, sum, status, expires_at, created_at, settled_at, withdrawal_id
+from withdrawal_holds
+where id = $1;
+
+-- name: GetHoldForUpdate :one
+select id, user_id, order_number, sum, status, expires_at, created_at, settled_at, withdrawal_id
+from withdrawal_holds
+where id = $1
+for update;
+
+-- name: SettleHold :one
+update withdrawal_holds
+set status = $2,
+    settled_at = now(),
+    withdrawal_id = $3
+where id = $1
+returning id, user_id, order_number, sum, status, expires_at, created_at, settled_at, withdrawal_id;
+
+-- name: ExpireHolds :execrows
+update withdrawal_holds
+set status = 'expired',
+    settled_at = now()
+where status = 'held'
+    and expires_at <= now();
+
+-- name: GetWithdrawalOrdersTaken :many
+select number
+from unnest(sqlc.arg(numbers)::text[]) as number
+where exists (
+    select 1
+    from withdrawals w
+    where w.order_number = number
+        and w.duplicate_of is null
+) or exists (
+    select 1
+    from withdrawal_holds h
+    where h.order_number = number
+        and h.status = 'held'
+);
+
+-- name: WithdrawalOrderTaken :one
+select exists (
+    select 1
+    from withdrawals
+    where order_number = $1
+        and duplicate_of is null
+) or exists (
+    select 1
+    from withdrawal_holds
+    where order_number = $1
+        and status = 'held'
+);
@@ -0,0 +1,47 @@
+-- name: InsertIdempotencyKey :execrows
+-- An expired key is claimed anew. A key whose request never completed is taken over by a retry of that request
+-- once its lock has run out.
+insert into idempotency_keys (user_id, key, fingerprint, locked_until)
+values (
+    sqlc.arg(user_id),
+    sqlc.arg(key),
+    sqlc.arg(fingerprint),
+    now() + make_interval(secs => sqlc.arg(lock_seconds)::float8)
+)
+on conflict (user_id, key) do update
+set fingerprint = excluded.fingerprint,
+    status_code = null,
+    content_type = null,
+    body = null,
+    created_at = now(),
+    locked_until = excluded.locked_until
+where idempotency_keys.created_at < sqlc.arg(expired_before)
+    or (
+        idempotency_keys.status_code is null
+        and idempotency_keys.locked_until < now()
+        and idempotency_keys.fingerprint = excluded.fingerprint
+    );
+
+-- name: GetIdempotencyKey :one
+select fingerprint, status_code, content_type, body
+from idempotency_keys
+where user_id = $1
+    and key = $2;
+
+-- name: CompleteIdempotencyKey :exec
+update idempotency_keys
+set status_code = $3,
+    content_type = $4,
+    body = $5,
+    locked_until = null
+where user_id = $1
+    and key = $2;
+
+-- name: DeleteIdempotencyKey :exec
+delete from idempotency_keys
+where user_id = $1
+    and key = $2;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+delete from idempotency_keys
+where created_at < $1;
@@ -0,0 +1,43 @@
+-- name: InsertLedgerEntry :one
+insert into ledger_entries (user_id, kind, amount, order_number, adjustment_id, reversal_id, balance_after)
+values ($1, $2, $3, $4, $5, $6, $7)
+returning id;
+
+-- name: ApplyToBalance :one
+insert into balances (user_id, current, withdrawn)
+values (sqlc.arg(user_id), sqlc.arg(amount), sqlc.arg(withdrawn))
+on conflict (user_id) do update
+set current = balances.current + excluded.current,
+    withdrawn = balances.withdrawn + excluded.withdrawn,
+    updated_at = now()
+returning current;
+
+-- name: ReconcileBalances :many
+with ledger as (
+    select user_id,
+        sum(amount) as current,
+        -coalesce(sum(amount) filter (where kind in ('withdrawal', 'reversal')), 0) as withdrawn
+    from ledger_entries
+    group by user_id
+)
+select
+    coalesce(b.user_id, l.user_id)::uuid as user_id,
+    coalesce(b.current, 0)::numeric(12,2) as snapshot_current,
+    coalesce(b.withdrawn, 0)::numeric(12,2) as snapshot_withdrawn,
+    coalesce(l.current, 0)::numeric(12,2) as ledger_current,
+    coalesce(l.withdrawn, 0)::numeric(12,2) as ledger_withdrawn
+from balances b
+full join ledger l on l.user_id = b.user_id
+where coalesce(b.current, 0) <> coalesce(l.current, 0)
+    or coalesce(b.withdrawn, 0) <> coalesce(l.withdrawn, 0);
+
+-- name: GetStatement :many
+select e.id, e.kind, e.amount, e.order_number, e.adjustment_id, a.reason, e.created_at, e.balance_after
+from ledger_entries e
+left join adjustments a on a.id = e.adjustment_id
+where e.user_id = sqlc.arg(user_id)
+    and (sqlc.narg(before_id)::bigint is null or e.id < sqlc.narg(before_id)::bigint)
+    and (sqlc.narg(from_time)::timestamptz is null or e.created_at >= sqlc.narg(from_time)::timestamptz)
+    and (sqlc.narg(to_time)::timestamptz is null or e.created_at < sqlc.narg(to_time)::timestamptz)
+order by e.id desc
+limit sqlc.arg(row_limit);
@@ -0,0 +1,47 @@
+-- name: GetLoginAttempts :one
+select failures, last_failure_at, locked_until
+from login_attempts
+where scope = $1
+    and key = $2;
+
+-- name: ReserveLoginAttempt :one
+-- Returns no row if the key is locked or its failures aren't the seen ones.
+insert into login_attempts as la (scope, key, failures, last_failure_at, locked_until)
+values (
+    sqlc.arg(scope),
+    sqlc.arg(key),
+    1,
+    sqlc.arg(now),
+    case when sqlc.arg(max_failures)::int = 1 then sqlc.arg(lock_until)::timestamptz end
+)
+on conflict (scope, key) do update
+set failures = case
+        when la.last_failure_at < sqlc.arg(window_start) then 1
+        else la.failures + 1
+    end,
+    last_failure_at = sqlc.arg(now),
+    locked_until = case
+        when sqlc.arg(max_failures)::int > 0
+            and case
+                when la.last_failure_at < sqlc.arg(window_start) then 1
+                else la.failures + 1
+            end >= sqlc.arg(max_failures)::int
+        then sqlc.arg(lock_until)::timestamptz
+        else la.locked_until
+    end
+where (la.locked_until is null or la.locked_until <= sqlc.arg(now))
+    and (sqlc.narg(seen_failures)::int is null or la.failures = sqlc.narg(seen_failures)::int)
+returning failures, last_failure_at, locked_until;
+
+-- name: RefundLoginAttempt :exec
+-- Gives back a reserved attempt that didn't fail, along with the lock it set.
+update login_attempts
+set failures = greatest(failures - 1, 0),
+    locked_until = case when locked_until = sqlc.narg(reserved_lock)::timestamptz then null else locked_until end
+where scope = sqlc.arg(scope)
+    and key = sqlc.arg(key);
+
+-- name: ResetLoginAttempts :exec
+delete from login_attempts
+where scope = $1
+    and key = $2;
@@ -4,44 +4,102 @@ values ($1, $2, $3, $4)
 on conflict(number) do nothing
 returning user_id;
 
+-- name: InsertOrders :many
+insert into orders (number, user_id, status, accrual)
+select unnest(sqlc.arg(numbers)::text[]), sqlc.arg(user_id)::uuid, 'NEW', 0
+on conflict(number) do nothing
+returning number;
+
+-- name: NotifyNewOrders :exec
+notify new_orders;
+
+-- name: ListenNewOrders :exec
+listen new_orders;
+
+-- name: GetOrderOwners :many
+select number, user_id
+from orders
+where number = any(sqlc.arg(numbers)::text[]);
+
 -- name: GetOrderOwner :one
 select user_id
 from orders
 where number = $1;
 
--- name: GetOrders :many
+-- name: GetOrder :one
+select number, user_id, status, accrual, uploaded_at, checked_at, processed_at, claimed_by, lease_until, attempts,
+    next_attempt_at, queued_at, stuck_at
+from orders
+where number = $1;
+
+-- name: GetOrdersAsc :many
+select number, status, accrual, uploaded_at
+from orders
+where user_id = sqlc.arg(user_id)
+    and (cardinality(sqlc.arg(statuses)::text[]) = 0 or status = any(sqlc.arg(statuses)::text[]))
+    and uploaded_at >= coalesce(sqlc.narg(from_time)::timestamptz, '-infinity')
+    and uploaded_at < coalesce(sqlc.narg(to_time)::timestamptz, 'infinity')
+    and (uploaded_at, number) > (coalesce(sqlc.narg(after_time)::timestamptz, '-infinity'), sqlc.arg(after_number)::text)
+order by uploaded_at asc, number asc
+limit sqlc.narg(row_limit)::int;
+
+-- name: GetOrdersDesc :many
 select number, status, accrual, uploaded_at
 from orders
-where user_id = $1
-order by uploaded_at desc;
+where user_id = sqlc.arg(user_id)
+    and (cardinality(sqlc.arg(statuses)::text[]) = 0 or status = any(sqlc.arg(statuses)::text[]))
+    and uploaded_at >= coalesce(sqlc.narg(from_time)::timestamptz, '-infinity')
+    and uploaded_at < coalesce(sqlc.narg(to_time)::timestamptz, 'infinity')
+    and (uploaded_at, number) < (coalesce(sqlc.narg(after_time)::timestamptz, 'infinity'), sqlc.arg(after_number)::text)
+order by uploaded_at desc, number desc
+limit sqlc.narg(row_limit)::int;
 
 -- name: GetBalance :one
-with
-accr as (
-    select coalesce(sum(o.accrual), 0::numeric(12,2)) as total
-    from orders o
-    where o.user_id = $1
-        and o.status = 'PROCESSED'
-),
-wd as (
-    select coalesce(sum(w.sum), 0::numeric(12,2)) as total
-    from withdrawals w
-    where w.user_id = $1
-)
-select
-    (accr.total - wd.total)::numeric(12,2) as current,
-    wd.total::numeric(12,2) as withdrawn
-from accr, wd;
-
--- name: InsertWithdrawal :exec
+select b.current, b.withdrawn,
+    (
+        select coalesce(sum(h.sum), 0)
+        from withdrawal_holds h
+        where h.user_id = b.user_id
+            and h.status = 'held'
+            and h.expires_at > now()
+    )::numeric(12,2) as held
+from balances b
+where b.user_id = $1;
+
+-- name: InsertWithdrawal :one
 insert into withdrawals (user_id, order_number, sum)
-values ($1, $2, $3);
+values ($1, $2, $3)
+returning id;
 
 -- name: AcquireUserLock :exec
 select pg_advisory_xact_lock(hashtextextended(sqlc.arg(user_id)::uuid::text, 0));
 
--- name: GetWithdrawals :many
-select order_number, sum, processed_at
+-- name: AcquireOrderNumberLocks :exec
+-- Serializes uploads and withdrawals of the same order numbers. Locks are taken in order so that transactions
+-- locking overlapping batches don't deadlock.
+select pg_advisory_xact_lock(hashtextextended('order:' || n.number, 0))
+from (
+    select number
+    from unnest(sqlc.arg(numbers)::text[]) as number
+    order by number
+) n;
+
+-- name: GetWithdrawalsAsc :many
+select id, order_number, sum, processed_at, reversed
+from withdrawals
+where user_id = sqlc.arg(user_id)
+    and processed_at >= coalesce(sqlc.narg(from_time)::timestamptz, '-infinity')
+    and processed_at < coalesce(sqlc.narg(to_time)::timestamptz, 'infinity')
+    and (processed_at, id) > (coalesce(sqlc.narg(after_time)::timestamptz, '-infinity'), sqlc.arg(after_id)::uuid)
+order by processed_at asc, id asc
+limit sqlc.narg(row_limit)::int;
+
+-- name: GetWithdrawalsDesc :many
+select id, order_number, sum, processed_at, reversed
 from withdrawals
-where user_id = $1
-order by processed_at desc;
+where user_id = sqlc.arg(user_id)
+    and processed_at >= coalesce(sqlc.narg(from_time)::timestamptz, '-infinity')
+    and processed_at < coalesce(sqlc.narg(to_time)::timestamptz, 'infinity')
+    and (processed_at, id) < (coalesce(sqlc.narg(after_time)::timestamptz, 'infinity'), sqlc.arg(after_id)::uuid)
+order by processed_at desc, id desc
+limit sqlc.narg(row_limit)::int;
@@ -0,0 +1,41 @@
+-- name: InsertPointLot :exec
+insert into point_lots (user_id, ledger_entry_id, amount, remaining)
+values (sqlc.arg(user_id), sqlc.arg(ledger_entry_id), sqlc.arg(amount), sqlc.arg(amount));
+
+-- name: GetOpenPointLotsForUpdate :many
+select id, remaining
+from point_lots
+where user_id = $1
+    and remaining > 0
+order by created_at asc, id asc
+for update;
+
+-- name: ConsumePointLot :exec
+update point_lots
+set remaining = remaining - sqlc.arg(amount)
+where id = sqlc.arg(id);
+
+-- name: InsertPointLotConsumption :exec
+insert into point_lot_consumptions (lot_id, ledger_entry_id, amount)
+values ($1, $2, $3);
+
+-- name: GetPointLots :many
+select id, user_id, ledger_entry_id, amount, remaining, created_at
+from point_lots
+where user_id = sqlc.arg(user_id)
+    and remaining > 0
+    and created_at < sqlc.arg(accrued_before)
+order by created_at asc, id asc;
+
+-- name: GetUsersWithExpiredPoints :many
+select distinct user_id
+from point_lots
+where remaining > 0
+    and created_at < $1;
+
+-- name: GetExpiredPoints :one
+select coalesce(sum(remaining), 0)::numeric(12,2) as expired
+from point_lots
+where user_id = sqlc.arg(user_id)
+    and remaining > 0
+    and created_at < sqlc.arg(accrued_before);
@@ -0,0 +1,22 @@
+-- name: GetWithdrawalForUpdate :one
+select id, user_id, order_number, sum, processed_at, duplicate_of, reversed
+from withdrawals
+where order_number = $1
+    and duplicate_of is null
+for update;
+
+-- name: GetReversalByReference :one
+select id, withdrawal_id, amount, reason, reference, operator_id, created_at
+from withdrawal_reversals
+where withdrawal_id = $1
+    and reference = $2;
+
+-- name: InsertReversal :one
+insert into withdrawal_reversals (id, withdrawal_id, amount, reason, reference, operator_id)
+values ($1, $2, $3, $4, $5, $6)
+returning created_at;
+
+-- name: AddWithdrawalReversed :exec
+update withdrawals
+set reversed = reversed + $2
+where id = $1;
@@ -0,0 +1,47 @@
+-- name: InsertSession :exec
+insert into sessions (id, user_id)
+values ($1, $2);
+
+-- name: InsertRefreshToken :exec
+insert into refresh_tokens (token_hash, session_id, expires_at)
+values ($1, $2, $3);
+
+-- name: SelectRefreshTokenForUpdate :one
+select rt.session_id, rt.expires_at, rt.used_at, s.user_id, s.revoked_at, u.role, u.blocked_at
+from refresh_tokens rt
+join sessions s on s.id = rt.session_id
+join users u on u.id = s.user_id
+where rt.token_hash = $1
+for update of rt;
+
+-- name: MarkRefreshTokenUsed :exec
+update refresh_tokens
+set used_at = now()
+where token_hash = $1;
+
+-- name: RevokeSession :exec
+update sessions
+set revoked_at = now()
+where id = $1
+    and revoked_at is null;
+
+-- name: IsSessionActive :one
+select exists (
+    select 1
+    from sessions
+    where id = $1
+        and revoked_at is null
+);
+
+-- name: RevokeOtherSessions :exec
+update sessions
+set revoked_at = now()
+where user_id = sqlc.arg(user_id)
+    and id <> sqlc.arg(keep_id)
+    and revoked_at is null;
+
+-- name: RevokeUserSessions :exec
+update sessions
+set revoked_at = now()
+where user_id = $1
+    and revoked_at is null;
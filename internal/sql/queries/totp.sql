@@ -0,0 +1,63 @@
+-- name: UpsertTOTPCredential :execrows
+insert into totp_credentials as tc (user_id, secret)
+values ($1, $2)
+on conflict (user_id) do update
+set secret = excluded.secret,
+    last_used_step = 0,
+    created_at = now()
+where tc.confirmed_at is null;
+
+-- name: SelectTOTPCredential :one
+select secret, last_used_step, confirmed_at
+from totp_credentials
+where user_id = $1;
+
+-- name: ConfirmTOTPCredential :execrows
+update totp_credentials
+set confirmed_at = now(),
+    last_used_step = $2
+where user_id = $1
+    and confirmed_at is null;
+
+-- name: UseTOTPStep :execrows
+update totp_credentials
+set last_used_step = sqlc.arg(step)
+where user_id = sqlc.arg(user_id)
+    and last_used_step < sqlc.arg(step);
+
+-- name: DeleteTOTPCredential :exec
+delete from totp_credentials
+where user_id = $1;
+
+-- name: InsertRecoveryCodes :exec
+insert into totp_recovery_codes (user_id, code_hash)
+select sqlc.arg(user_id)::uuid, unnest(sqlc.arg(code_hashes)::text[]);
+
+-- name: UseRecoveryCode :execrows
+update totp_recovery_codes
+set used_at = now()
+where user_id = $1
+    and code_hash = $2
+    and used_at is null;
+
+-- name: DeleteRecoveryCodes :exec
+delete from totp_recovery_codes
+where user_id = $1;
+
+-- name: InsertMFAChallenge :exec
+insert into mfa_challenges (token_hash, user_id, expires_at)
+values ($1, $2, $3);
+
+-- name: SelectMFAChallenge :one
+select user_id
+from mfa_challenges
+where token_hash = $1
+    and expires_at > now();
+
+-- name: DeleteMFAChallenge :execrows
+delete from mfa_challenges
+where token_hash = $1;
+
+-- name: DeleteExpiredMFAChallenges :exec
+delete from mfa_challenges
+where expires_at <= now();
@@ -1,9 +1,41 @@
 -- name: InsertUser :one
-insert into users (id, login, password_hash)
-values ($1, $2, $3)
+insert into users (id, login, password_hash, role)
+values ($1, $2, $3, $4)
 returning id;
 
 -- name: SelectUserByLogin :one
-select id, login, password_hash, created_at
+select id, login, password_hash, created_at, role, blocked_at
 from users
 where login = $1;
+
+-- name: SelectUserByID :one
+select id, login, password_hash, created_at, role, blocked_at
+from users
+where id = $1;
+
+-- name: SelectUsers :many
+select id, login, role, blocked_at, created_at
+from users
+order by created_at, id
+limit $1 offset $2;
+
+-- name: UpdatePasswordHash :execrows
+update users
+set password_hash = sqlc.arg(new_hash)
+where id = sqlc.arg(id)
+    and password_hash = sqlc.arg(old_hash);
+
+-- name: UpdateUserRole :execrows
+update users
+set role = $2
+where id = $1;
+
+-- name: BlockUser :execrows
+update users
+set blocked_at = coalesce(blocked_at, now())
+where id = $1;
+
+-- name: UnblockUser :execrows
+update users
+set blocked_at = null
+where id = $1;